@@ -0,0 +1,634 @@
+/*
+	Package asm is a small 6502 assembler, in ca65 syntax, for writing tests
+	and patching code from the debugger. Source such as
+
+		        .org $0200
+		loop:   LDA (ptr),Y
+		        BEQ done
+		        JSR putc
+		        INY
+		        BNE loop
+		done:   RTS
+		ptr = $10
+		putc = $FFEE
+
+	assembles with labels and constants, expressions, and the .byte, .word,
+	.res, .org and .setcpu directives. Instructions use the variant's
+	instruction set, choosing zero-page addressing where the address is known
+	to fit; prefix an address with a: to force absolute addressing, or z: for
+	zero page.
+*/
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pda/go6502/cpu"
+	"github.com/pda/go6502/disasm"
+)
+
+// Error is an error in a line of source.
+type Error struct {
+	Line int // numbered from 1.
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Line %d: %v", e.Line, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Segment is code assembled to consecutive addresses.
+type Segment struct {
+	Origin uint16
+	Code   []byte
+}
+
+// Program is assembled code, a segment per .org, and its symbols.
+type Program struct {
+	Segments []Segment
+	Symbols  map[string]uint16
+}
+
+// Writer is memory a Program can be loaded into, e.g. memory.Ram or
+// bus.Bus.
+type Writer interface {
+	Write(address uint16, value byte)
+}
+
+// Load writes the program into w.
+func (p *Program) Load(w Writer) {
+	for _, s := range p.Segments {
+		for i, b := range s.Code {
+			w.Write(s.Origin+uint16(i), b)
+		}
+	}
+}
+
+// Bytes returns the code of all the segments, one after the other.
+func (p *Program) Bytes() (code []byte) {
+	for _, s := range p.Segments {
+		code = append(code, s.Code...)
+	}
+	return code
+}
+
+// Assembler assembles source for a CPU variant.
+type Assembler struct {
+	Variant cpu.Variant
+
+	// Symbols, if not nil, resolves symbols the source doesn't define, e.g.
+	// from debug symbols.
+	Symbols func(name string) (uint16, bool)
+}
+
+// Assemble assembles source for variant v, starting at origin.
+func Assemble(v cpu.Variant, origin uint16, source string) (*Program, error) {
+	a := &Assembler{Variant: v}
+	return a.Assemble(origin, source)
+}
+
+// AssembleInto assembles source for variant v, starting at origin, and
+// loads it into w.
+func AssembleInto(w Writer, v cpu.Variant, origin uint16, source string) (*Program, error) {
+	p, err := Assemble(v, origin, source)
+	if err != nil {
+		return nil, err
+	}
+	p.Load(w)
+	return p, nil
+}
+
+// statement is a line of source.
+type statement struct {
+	line     int
+	label    string
+	constant string // the name, for "name = value".
+	op       string // a mnemonic, upper case, or a directive, lower case.
+	operand  string
+
+	// optype is decided on the first pass, and kept for the second, so
+	// that addresses don't change between passes.
+	optype cpu.OpType
+}
+
+// assembly is the state of an Assemble.
+type assembly struct {
+	*Assembler
+	variant  cpu.Variant
+	opcodes  map[string]map[string]cpu.OpType
+	symbols  map[string]int
+	final    bool // the second pass, when every symbol must be defined.
+	program  *Program
+	pc       uint16
+	start    uint16 // the address of the statement, for *.
+	overflow bool   // pc has passed $FFFF.
+}
+
+// Assemble assembles source, starting at origin. Errors are *Error.
+func (a *Assembler) Assemble(origin uint16, source string) (*Program, error) {
+	var statements []*statement
+	for i, text := range strings.Split(source, "\n") {
+		if s := parseLine(text); s != nil {
+			s.line = i + 1
+			statements = append(statements, s)
+		}
+	}
+
+	as := &assembly{
+		Assembler: a,
+		symbols:   make(map[string]int),
+	}
+	for _, final := range []bool{false, true} {
+		as.final = final
+		as.pc = origin
+		as.overflow = false
+		as.setVariant(a.Variant)
+		as.program = &Program{Segments: []Segment{{Origin: origin}}}
+		for _, s := range statements {
+			if err := as.statement(s); err != nil {
+				return nil, &Error{s.line, err}
+			}
+		}
+	}
+
+	p := as.program
+	segments := p.Segments[:0]
+	for _, s := range p.Segments {
+		if len(s.Code) > 0 {
+			segments = append(segments, s)
+		}
+	}
+	p.Segments = segments
+	p.Symbols = make(map[string]uint16, len(as.symbols))
+	for name, value := range as.symbols {
+		p.Symbols[name] = uint16(value)
+	}
+	return p, nil
+}
+
+// parseLine splits a line of source into its label, operation and operand,
+// returning nil for a blank line.
+func parseLine(text string) *statement {
+	text = strings.TrimSpace(stripComment(text))
+	if text == "" {
+		return nil
+	}
+	s := &statement{}
+	if i := strings.IndexByte(text, ':'); i > 0 && isName(text[:i]) {
+		s.label = text[:i]
+		text = strings.TrimSpace(text[i+1:])
+	}
+	if i := strings.IndexByte(text, '='); i > 0 {
+		if name := strings.TrimSpace(text[:i]); isName(name) {
+			s.constant = name
+			s.operand = strings.TrimSpace(text[i+1:])
+			return s
+		}
+	}
+	if text == "" {
+		return s
+	}
+	s.op = text
+	if i := strings.IndexAny(text, " \t"); i > 0 {
+		s.op, s.operand = text[:i], strings.TrimSpace(text[i+1:])
+	}
+	if strings.HasPrefix(s.op, ".") {
+		s.op = strings.ToLower(s.op)
+	} else {
+		s.op = strings.ToUpper(s.op)
+	}
+	return s
+}
+
+// stripComment removes a ; comment, if it's not in quotes.
+func stripComment(text string) string {
+	quote := byte(0)
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ';':
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// setVariant indexes the variant's instruction set by mnemonic and
+// addressing mode. Where opcodes share both, the NMOS 6502's documented
+// opcode is used if there is one, or else the lowest.
+func (as *assembly) setVariant(v cpu.Variant) {
+	as.variant = v
+	as.opcodes = make(map[string]map[string]cpu.OpType)
+	for opcode := 0; opcode < 0x100; opcode++ {
+		ot, ok := v.Lookup(uint8(opcode))
+		if !ok {
+			continue
+		}
+		modes := as.opcodes[ot.Name()]
+		if modes == nil {
+			modes = make(map[string]cpu.OpType)
+			as.opcodes[ot.Name()] = modes
+		}
+		if prev, ok := modes[ot.Addressing()]; ok && (documented(prev) || !documented(ot)) {
+			continue
+		}
+		modes[ot.Addressing()] = ot
+	}
+	// ca65's name for SBX.
+	if modes, ok := as.opcodes["SBX"]; ok {
+		as.opcodes["AXS"] = modes
+	}
+}
+
+// documented is true if ot is in the NMOS 6502's documented instruction set.
+func documented(ot cpu.OpType) bool {
+	nmos, ok := cpu.NMOS6502.Lookup(ot.Opcode)
+	return ok && nmos == ot
+}
+
+func (as *assembly) lookup(name string) (int, bool) {
+	if value, ok := as.symbols[name]; ok {
+		return value, true
+	}
+	if as.Symbols != nil {
+		if address, ok := as.Symbols(name); ok {
+			return int(address), true
+		}
+	}
+	return 0, false
+}
+
+// evaluate returns the value of an expression. On the first pass, known is
+// false if it uses a symbol not yet defined; on the second, that's an
+// error.
+func (as *assembly) evaluate(expr string) (value int, known bool, err error) {
+	value, undefined, err := evaluate(expr, as.start, as.lookup)
+	if err != nil {
+		return 0, false, err
+	}
+	if undefined && as.final {
+		return 0, false, fmt.Errorf("Undefined symbol in %q", expr)
+	}
+	return value, !undefined, nil
+}
+
+// define sets a symbol's value, which mustn't change between passes.
+func (as *assembly) define(name string, value int) error {
+	if prev, ok := as.symbols[name]; ok && !as.final {
+		return fmt.Errorf("Symbol %s already defined as $%04X", name, prev)
+	}
+	as.symbols[name] = value
+	return nil
+}
+
+// emit appends bytes to the current segment.
+func (as *assembly) emit(bytes ...byte) error {
+	if as.overflow || int(as.pc)+len(bytes) > 0x10000 {
+		return fmt.Errorf("Code runs past $FFFF")
+	}
+	seg := &as.program.Segments[len(as.program.Segments)-1]
+	seg.Code = append(seg.Code, bytes...)
+	as.pc += uint16(len(bytes))
+	as.overflow = as.pc == 0 && len(bytes) > 0
+	return nil
+}
+
+func (as *assembly) statement(s *statement) error {
+	as.start = as.pc
+	if s.label != "" {
+		if err := as.define(s.label, int(as.pc)); err != nil {
+			return err
+		}
+	}
+	if s.constant != "" {
+		value, known, err := as.evaluate(s.operand)
+		if err != nil {
+			return err
+		}
+		if known {
+			return as.define(s.constant, value)
+		}
+		return nil
+	}
+	switch {
+	case s.op == "":
+		return nil
+	case strings.HasPrefix(s.op, "."):
+		return as.directive(s)
+	}
+	return as.instruction(s)
+}
+
+func (as *assembly) directive(s *statement) error {
+	switch s.op {
+	case ".byte", ".byt":
+		for _, arg := range splitOperand(s.operand) {
+			if len(arg) >= 2 && arg[0] == '"' && arg[len(arg)-1] == '"' {
+				if err := as.emit([]byte(arg[1 : len(arg)-1])...); err != nil {
+					return err
+				}
+				continue
+			}
+			value, err := as.operandValue(arg, 1)
+			if err != nil {
+				return err
+			}
+			if err := as.emit(byte(value)); err != nil {
+				return err
+			}
+		}
+	case ".word", ".addr":
+		for _, arg := range splitOperand(s.operand) {
+			value, err := as.operandValue(arg, 2)
+			if err != nil {
+				return err
+			}
+			if err := as.emit(byte(value), byte(value>>8)); err != nil {
+				return err
+			}
+		}
+	case ".res":
+		args := splitOperand(s.operand)
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf(".res expects a count and optional fill value")
+		}
+		count, known, err := as.evaluate(args[0])
+		if err != nil {
+			return err
+		}
+		if !known || count < 0 || count > 0x10000 {
+			return fmt.Errorf("Invalid .res count %q", args[0])
+		}
+		fill := 0
+		if len(args) == 2 {
+			if fill, err = as.operandValue(args[1], 1); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < count; i++ {
+			if err := as.emit(byte(fill)); err != nil {
+				return err
+			}
+		}
+	case ".org":
+		value, known, err := as.evaluate(s.operand)
+		if err != nil {
+			return err
+		}
+		if !known || value < 0 || value > 0xFFFF {
+			return fmt.Errorf("Invalid .org address %q", s.operand)
+		}
+		as.pc = uint16(value)
+		as.overflow = false
+		as.program.Segments = append(as.program.Segments, Segment{Origin: as.pc})
+	case ".setcpu":
+		name, err := strconv.Unquote(s.operand)
+		if err != nil {
+			return fmt.Errorf("Expected a quoted CPU name, got %s", s.operand)
+		}
+		for v := cpu.NMOS6502; v <= cpu.WDC65C02; v++ {
+			if strings.EqualFold(name, disasm.SetCPU(v)) {
+				as.setVariant(v)
+				return nil
+			}
+		}
+		return fmt.Errorf("Unknown CPU %q", name)
+	default:
+		return fmt.Errorf("Unknown directive %s", s.op)
+	}
+	return nil
+}
+
+// operandValue evaluates an operand which must fit the given number of
+// bytes, signed or unsigned.
+func (as *assembly) operandValue(expr string, size int) (int, error) {
+	value, _, err := as.evaluate(expr)
+	if err != nil {
+		return 0, err
+	}
+	limit := 1 << (8 * size)
+	if value < -limit/2 || value >= limit {
+		return 0, fmt.Errorf("Value %d of %q doesn't fit in %d byte(s)", value, expr, size)
+	}
+	return value & (limit - 1), nil
+}
+
+// splitOperand splits an operand at the commas which aren't in parentheses
+// or quotes.
+func splitOperand(operand string) (parts []string) {
+	depth, quote, start := 0, byte(0), 0
+	for i := 0; i < len(operand); i++ {
+		switch c := operand[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(operand[start:i]))
+			start = i + 1
+		}
+	}
+	if operand = strings.TrimSpace(operand[start:]); operand != "" || len(parts) > 0 {
+		parts = append(parts, operand)
+	}
+	return parts
+}
+
+// parenthesised returns the inside of s, if it's wholly in parentheses.
+func parenthesised(s string) (string, bool) {
+	if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return "", false
+	}
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 && i < len(s)-1 {
+				return "", false
+			}
+		}
+	}
+	return s[1 : len(s)-1], true
+}
+
+// An addressing is the syntax of an operand, and the modes it may assemble
+// to: in zero page, or absolute.
+type addressing struct {
+	zeropage, absolute string
+}
+
+var (
+	indexedIndirect = addressing{"(indirect,X)", "(absolute,X)"}
+	indirectIndexed = addressing{"(indirect),Y", ""}
+	indirect        = addressing{"(zeropage)", "(indirect)"}
+	indexedX        = addressing{"zeropageX", "absoluteX"}
+	indexedY        = addressing{"zeropageY", "absoluteY"}
+	direct          = addressing{"zeropage", "absolute"}
+)
+
+func (as *assembly) instruction(s *statement) error {
+	modes, ok := as.opcodes[s.op]
+	if !ok {
+		return fmt.Errorf("Unknown instruction %s for %v", s.op, as.variant)
+	}
+	address := s.operand
+	var syntax addressing
+	parts := splitOperand(s.operand)
+	inner, inParens := parenthesised(s.operand)
+	switch {
+	case len(parts) == 0:
+		if _, ok := modes["implied"]; ok {
+			return as.encode(s, modes["implied"])
+		}
+		return as.encode(s, modes["accumulator"])
+	case strings.EqualFold(s.operand, "A"):
+		return as.encode(s, modes["accumulator"])
+	case strings.HasPrefix(s.operand, "#"):
+		return as.encode(s, modes["immediate"], s.operand[1:])
+	case inParens:
+		innerParts := splitOperand(inner)
+		switch {
+		case len(innerParts) == 2 && strings.EqualFold(innerParts[1], "X"):
+			syntax, address = indexedIndirect, innerParts[0]
+		case len(innerParts) == 1:
+			syntax, address = indirect, inner
+		default:
+			return fmt.Errorf("Invalid operand %s", s.operand)
+		}
+	case len(parts) == 2 && strings.EqualFold(parts[1], "Y"):
+		if inner, ok := parenthesised(parts[0]); ok {
+			syntax, address = indirectIndexed, inner
+		} else {
+			syntax, address = indexedY, parts[0]
+		}
+	case len(parts) == 2 && strings.EqualFold(parts[1], "X"):
+		syntax, address = indexedX, parts[0]
+	case len(parts) == 2:
+		return as.encode(s, modes["zeropage,relative"], parts...)
+	case len(parts) == 1:
+		if ot, ok := modes["relative"]; ok {
+			return as.encode(s, ot, parts[0])
+		}
+		syntax = direct
+	default:
+		return fmt.Errorf("Invalid operand %s", s.operand)
+	}
+
+	if !as.final {
+		mode, err := as.chooseMode(modes, syntax, address)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.op, err)
+		}
+		s.optype = modes[mode]
+	}
+	return as.encode(s, s.optype, withoutPrefix(address))
+}
+
+// withoutPrefix returns an address without its a: or z: prefix.
+func withoutPrefix(address string) string {
+	if prefix := strings.ToLower(address); strings.HasPrefix(prefix, "a:") || strings.HasPrefix(prefix, "z:") {
+		return strings.TrimSpace(address[2:])
+	}
+	return address
+}
+
+// chooseMode returns the addressing mode for an address operand: zero page
+// if the instruction has it and the address is known to fit, or absolute.
+// An a: or z: prefix forces the choice.
+func (as *assembly) chooseMode(modes map[string]cpu.OpType, syntax addressing, address string) (string, error) {
+	_, hasZeropage := modes[syntax.zeropage]
+	_, hasAbsolute := modes[syntax.absolute]
+	switch strings.ToLower(address[:len(address)-len(withoutPrefix(address))]) {
+	case "a:":
+		hasZeropage = false
+	case "z:":
+		hasAbsolute = false
+	default:
+		value, known, err := as.evaluate(address)
+		if err != nil {
+			return "", err
+		}
+		if hasZeropage && hasAbsolute && (!known || value < 0 || value > 0xFF) {
+			hasZeropage = false
+		}
+	}
+	switch {
+	case hasZeropage:
+		return syntax.zeropage, nil
+	case hasAbsolute:
+		return syntax.absolute, nil
+	}
+	return "", fmt.Errorf("No %s addressing", strings.TrimSuffix(syntax.zeropage+" or "+syntax.absolute, " or "))
+}
+
+// encode emits the instruction ot, with the operands given.
+func (as *assembly) encode(s *statement, ot cpu.OpType, operands ...string) error {
+	if ot.Bytes == 0 {
+		return fmt.Errorf("Invalid operand %q for %s", s.operand, s.op)
+	}
+	s.optype = ot
+	pc := as.pc
+	code := []byte{ot.Opcode}
+	switch ot.Addressing() {
+	case "relative":
+		offset, err := as.branchOffset(operands[0], pc+2)
+		if err != nil {
+			return err
+		}
+		code = append(code, offset)
+	case "zeropage,relative":
+		zp, err := as.operandValue(operands[0], 1)
+		if err != nil {
+			return err
+		}
+		offset, err := as.branchOffset(operands[1], pc+3)
+		if err != nil {
+			return err
+		}
+		code = append(code, byte(zp), offset)
+	default:
+		if ot.Bytes > 1 {
+			value, err := as.operandValue(operands[0], int(ot.Bytes)-1)
+			if err != nil {
+				return err
+			}
+			code = append(code, byte(value), byte(value>>8))
+			code = code[:ot.Bytes]
+		}
+	}
+	return as.emit(code...)
+}
+
+// branchOffset returns the offset of a branch to target from next, the
+// address following the branch.
+func (as *assembly) branchOffset(target string, next uint16) (byte, error) {
+	value, known, err := as.evaluate(target)
+	if err != nil || !known {
+		return 0, err
+	}
+	offset := value - int(next)
+	if offset < -128 || offset > 127 {
+		return 0, fmt.Errorf("Branch to %s is out of range by %d bytes", target, offset)
+	}
+	return byte(offset), nil
+}
@@ -0,0 +1,149 @@
+package asm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/pda/go6502/cpu"
+	"github.com/pda/go6502/disasm"
+	"github.com/pda/go6502/memory"
+)
+
+func TestAssemble(t *testing.T) {
+	for _, tt := range []struct {
+		v        cpu.Variant
+		source   string
+		expected []byte
+	}{
+		{cpu.NMOS6502, "LDA #$10", []byte{0xA9, 0x10}},
+		{cpu.NMOS6502, "lda #-1", []byte{0xA9, 0xFF}},
+		{cpu.NMOS6502, "LDA $10", []byte{0xA5, 0x10}},
+		{cpu.NMOS6502, "LDA a:$10", []byte{0xAD, 0x10, 0x00}},
+		{cpu.NMOS6502, "LDA $1234,X", []byte{0xBD, 0x34, 0x12}},
+		{cpu.NMOS6502, "LDA $12,Y", []byte{0xB9, 0x12, 0x00}}, // no zeropage,Y
+		{cpu.NMOS6502, "LDX $12,Y", []byte{0xB6, 0x12}},
+		{cpu.NMOS6502, "STA ($20),Y", []byte{0x91, 0x20}},
+		{cpu.NMOS6502, "STA ($20,X)", []byte{0x81, 0x20}},
+		{cpu.NMOS6502, "JMP ($FFFC)", []byte{0x6C, 0xFC, 0xFF}},
+		{cpu.NMOS6502, "JMP ($10)", []byte{0x6C, 0x10, 0x00}},
+		{cpu.NMOS6502, "ASL", []byte{0x0A}},
+		{cpu.NMOS6502, "ASL A", []byte{0x0A}},
+		{cpu.NMOS6502, "LDA #<($1234+1)", []byte{0xA9, 0x35}},
+		{cpu.NMOS6502, "LDA #>$1234", []byte{0xA9, 0x12}},
+		{cpu.NMOS6502, "LDA (1+2)*3", []byte{0xA5, 0x09}},
+		{cpu.NMOS6502, "BNE *", []byte{0xD0, 0xFE}},
+		{cpu.NMOS6502, "NOP", []byte{0xEA}},
+		{cpu.NMOS6502X, "NOP", []byte{0xEA}},
+		{cpu.NMOS6502X, "SBC #1", []byte{0xE9, 0x01}},
+		{cpu.NMOS6502X, "AXS #5", []byte{0xCB, 0x05}},
+		{cpu.CMOS65C02, "LDA ($10)", []byte{0xB2, 0x10}},
+		{cpu.CMOS65C02, "JMP ($1234,X)", []byte{0x7C, 0x34, 0x12}},
+		{cpu.CMOS65C02, "INC A", []byte{0x1A}},
+		{cpu.WDC65C02, "BBS7 $10,*", []byte{0xFF, 0x10, 0xFD}},
+		{cpu.WDC65C02, "RMB3 $20", []byte{0x37, 0x20}},
+		{cpu.NMOS6502, ".byte 1, $FF, \"Hi\", 'x'", []byte{0x01, 0xFF, 'H', 'i', 'x'}},
+		{cpu.NMOS6502, ".word $1234, * ; comment", []byte{0x34, 0x12, 0x00, 0x02}},
+		{cpu.NMOS6502, ".res 3, $EA", []byte{0xEA, 0xEA, 0xEA}},
+		{cpu.NMOS6502, ".setcpu \"W65C02\"\nWAI", []byte{0xCB}},
+	} {
+		p, err := Assemble(tt.v, 0x0200, tt.source)
+		if err != nil {
+			t.Errorf("%v %q: %v", tt.v, tt.source, err)
+			continue
+		}
+		if got := p.Bytes(); !bytes.Equal(got, tt.expected) {
+			t.Errorf("%v %q: expected % X, got % X", tt.v, tt.source, tt.expected, got)
+		}
+	}
+}
+
+func TestAssembleLabels(t *testing.T) {
+	source := `
+		.org $0200
+	loop:	LDA (ptr),Y	; ptr is defined later, but is zero page.
+		BEQ done
+		JSR putc
+		INY
+		BNE loop
+	done:	RTS
+		.org $FFFC
+		.word loop
+	ptr = $10
+	putc = $FFEE
+	`
+	p, err := Assemble(cpu.NMOS6502, 0, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Segment{
+		{0x0200, []byte{0xB1, 0x10, 0xF0, 0x06, 0x20, 0xEE, 0xFF, 0xC8, 0xD0, 0xF6, 0x60}},
+		{0xFFFC, []byte{0x00, 0x02}},
+	}
+	if len(p.Segments) != len(expected) {
+		t.Fatalf("expected %d segments, got %v", len(expected), p.Segments)
+	}
+	for i, s := range p.Segments {
+		if s.Origin != expected[i].Origin || !bytes.Equal(s.Code, expected[i].Code) {
+			t.Errorf("segment %d: expected $%04X % X, got $%04X % X",
+				i, expected[i].Origin, expected[i].Code, s.Origin, s.Code)
+		}
+	}
+	if p.Symbols["done"] != 0x020A || p.Symbols["putc"] != 0xFFEE {
+		t.Errorf("unexpected symbols %v", p.Symbols)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	for _, source := range []string{
+		"FOO",
+		"LDA",
+		"LDA undefined",
+		"LDA #$100",
+		"STP",
+		"BNE *+200",
+		"x: NOP\nx: NOP",
+		".org $FFFF\n.word 0",
+		".bogus",
+	} {
+		_, err := Assemble(cpu.NMOS6502, 0x0200, source)
+		var asmErr *Error
+		if !errors.As(err, &asmErr) {
+			t.Errorf("%q: expected *Error, got %v", source, err)
+		}
+	}
+}
+
+func TestAssembleInto(t *testing.T) {
+	ram := &memory.Ram{}
+	if _, err := AssembleInto(ram, cpu.NMOS6502, 0x1000, "LDA #1\nSTA $2000"); err != nil {
+		t.Fatal(err)
+	}
+	if got := ram[0x1000:0x1005]; !bytes.Equal(got, []byte{0xA9, 0x01, 0x8D, 0x00, 0x20}) {
+		t.Errorf("unexpected RAM % X", got)
+	}
+}
+
+// TestDisassembly assembles the disassembly of every opcode, which should
+// give the same bytes.
+func TestDisassembly(t *testing.T) {
+	for v := cpu.NMOS6502; v <= cpu.WDC65C02; v++ {
+		d := &disasm.Disassembler{Variant: v}
+		for opcode := 0; opcode < 0x100; opcode++ {
+			ot, ok := v.Lookup(uint8(opcode))
+			if !ok {
+				continue
+			}
+			code := []byte{byte(opcode), 0x12, 0x34}[:ot.Bytes]
+			line := d.Disassemble(code, 0x0200)[0]
+			p, err := Assemble(v, 0x0200, line.Text)
+			if err != nil {
+				t.Errorf("%v %q: %v", v, line.Text, err)
+				continue
+			}
+			if got := p.Bytes(); !bytes.Equal(got, code) {
+				t.Errorf("%v %q: expected % X, got % X", v, line.Text, code, got)
+			}
+		}
+	}
+}
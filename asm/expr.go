@@ -0,0 +1,227 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parser evaluates an expression, e.g. "table+2", "<vector" or "*-1".
+//
+// Operators, from lowest to highest precedence, are | ^ & << >> + - * / %
+// and the unary - ~ < (low byte) and > (high byte). Operands are numbers,
+// in decimal or $hex or %binary, 'c' characters, symbols, * for the current
+// address, and parenthesised expressions.
+type parser struct {
+	s      string
+	pos    int
+	pc     uint16
+	lookup func(name string) (int, bool)
+
+	// undefined is set if a symbol the expression uses isn't defined; its
+	// value is taken as zero.
+	undefined bool
+}
+
+// evaluate returns the value of the expression s, with pc as the current
+// address. undefined is true if it uses a symbol lookup doesn't know.
+func evaluate(s string, pc uint16, lookup func(string) (int, bool)) (value int, undefined bool, err error) {
+	p := &parser{s: s, pc: pc, lookup: lookup}
+	value, err = p.binary(0)
+	if err == nil {
+		p.space()
+		if p.pos < len(p.s) {
+			err = fmt.Errorf("Unexpected %q in expression %q", p.s[p.pos:], s)
+		}
+	}
+	return value, p.undefined, err
+}
+
+// binaryOperators are in order of increasing precedence.
+var binaryOperators = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) space() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// operator consumes and returns the next operator, if it's one of ops.
+func (p *parser) operator(ops []string) (string, bool) {
+	p.space()
+	for _, op := range ops {
+		if strings.HasPrefix(p.s[p.pos:], op) {
+			p.pos += len(op)
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// binary parses operators of the given precedence and above.
+func (p *parser) binary(precedence int) (int, error) {
+	if precedence == len(binaryOperators) {
+		return p.unary()
+	}
+	left, err := p.binary(precedence + 1)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op, ok := p.operator(binaryOperators[precedence])
+		if !ok {
+			return left, nil
+		}
+		right, err := p.binary(precedence + 1)
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case "|":
+			left |= right
+		case "^":
+			left ^= right
+		case "&":
+			left &= right
+		case "<<":
+			left <<= uint(right)
+		case ">>":
+			left >>= uint(right)
+		case "+":
+			left += right
+		case "-":
+			left -= right
+		case "*":
+			left *= right
+		case "/", "%":
+			if right == 0 {
+				if p.undefined {
+					return 0, nil
+				}
+				return 0, fmt.Errorf("Division by zero in %q", p.s)
+			}
+			if op == "/" {
+				left /= right
+			} else {
+				left %= right
+			}
+		}
+	}
+}
+
+func (p *parser) unary() (int, error) {
+	op, ok := p.operator([]string{"-", "~", "<", ">"})
+	if !ok {
+		return p.primary()
+	}
+	value, err := p.unary()
+	switch op {
+	case "-":
+		value = -value
+	case "~":
+		value = ^value
+	case "<":
+		value &= 0xFF
+	case ">":
+		value = value >> 8 & 0xFF
+	}
+	return value, err
+}
+
+func (p *parser) primary() (int, error) {
+	p.space()
+	if p.pos == len(p.s) {
+		return 0, fmt.Errorf("Expected a value at the end of %q", p.s)
+	}
+	start := p.pos
+	switch c := p.s[p.pos]; {
+	case c == '(':
+		p.pos++
+		value, err := p.binary(0)
+		if err != nil {
+			return 0, err
+		}
+		if _, ok := p.operator([]string{")"}); !ok {
+			return 0, fmt.Errorf("Expected ) in %q", p.s)
+		}
+		return value, nil
+	case c == '*':
+		p.pos++
+		return int(p.pc), nil
+	case c == '\'':
+		if p.pos+2 >= len(p.s) || p.s[p.pos+2] != '\'' {
+			return 0, fmt.Errorf("Invalid character constant in %q", p.s)
+		}
+		p.pos += 3
+		return int(p.s[start+1]), nil
+	case c == '$' || c == '%':
+		p.pos++
+		base := 16
+		if c == '%' {
+			base = 2
+		}
+		for p.pos < len(p.s) && isAlnum(p.s[p.pos]) {
+			p.pos++
+		}
+		return parseNumber(p.s[start+1:p.pos], base)
+	case c >= '0' && c <= '9':
+		for p.pos < len(p.s) && isAlnum(p.s[p.pos]) {
+			p.pos++
+		}
+		if digits := p.s[start:p.pos]; len(digits) > 2 && strings.EqualFold(digits[:2], "0x") {
+			return parseNumber(digits[2:], 16)
+		}
+		return parseNumber(p.s[start:p.pos], 10)
+	case isSymbolStart(c):
+		for p.pos < len(p.s) && isSymbol(p.s[p.pos]) {
+			p.pos++
+		}
+		name := p.s[start:p.pos]
+		value, ok := p.lookup(name)
+		if !ok {
+			p.undefined = true
+		}
+		return value, nil
+	}
+	return 0, fmt.Errorf("Unexpected %q in expression %q", p.s[p.pos:], p.s)
+}
+
+func parseNumber(s string, base int) (int, error) {
+	value, err := strconv.ParseUint(s, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid number %q", s)
+	}
+	return int(value), nil
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+func isSymbolStart(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '_' || c == '@' || c == '.'
+}
+
+func isSymbol(c byte) bool {
+	return isSymbolStart(c) || c >= '0' && c <= '9'
+}
+
+// isName is true if s is a valid symbol name.
+func isName(s string) bool {
+	if s == "" || !isSymbolStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isSymbol(s[i]) {
+			return false
+		}
+	}
+	return true
+}
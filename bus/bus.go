@@ -5,23 +5,72 @@
 package bus
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/pda/go6502/memory"
 )
 
+// Reasons Attach refuses a mapping.
+var (
+	ErrZeroSize   = errors.New("Memory has zero size")
+	ErrOutOfRange = errors.New("Memory extends beyond $FFFF")
+	ErrOverlap    = errors.New("Memory overlaps existing mapping")
+)
+
 type busEntry struct {
-	mem   memory.Memory
-	name  string
-	start uint16
-	end   uint16
+	mem     memory.Memory
+	checker memory.Checker // nil unless mem implements it.
+	static  bool           // mem implements memory.Static, and is.
+	inert   bool           // mem implements memory.Inert, and is.
+	name    string
+	start   uint16
+	end     uint16
 }
 
 // Bus is a 16-bit address, 8-bit data bus, which maps reads and writes
 // at different locations to different backend Memory. For example the
 // lower 32K could be RAM, the upper 8KB ROM, and some I/O in the middle.
+//
+// Accesses to addresses with no backend, or refused by their backend, don't
+// panic; they fault, and the fault is recorded for TakeFault.
 type Bus struct {
-	entries []busEntry
+	entries        []busEntry
+	fault          *Fault
+	readObservers  []func(uint16, byte)
+	writeObservers []func(uint16, byte)
+}
+
+// Access is the direction of a bus access.
+type Access uint8
+
+const (
+	ReadAccess Access = iota
+	WriteAccess
+)
+
+func (a Access) String() string {
+	if a == WriteAccess {
+		return "write"
+	}
+	return "read"
+}
+
+// A Fault is a bus access to an address with no backend, or one refused by
+// its backend. A faulting read returns zero, and a faulting write is
+// discarded.
+type Fault struct {
+	Access  Access
+	Address uint16
+	Err     error
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("Bus fault on %v of $%04X: %v", f.Access, f.Address, f.Err)
+}
+
+func (f *Fault) Unwrap() error {
+	return f.Err
 }
 
 func (b *Bus) String() string {
@@ -33,24 +82,135 @@ func CreateBus() (*Bus, error) {
 }
 
 // Attach maps a bus address range to a backend Memory implementation,
-// which could be RAM, ROM, I/O device etc.
+// which could be RAM, ROM, I/O device etc. It refuses memory of zero size,
+// memory extending beyond $FFFF, and memory overlapping any already
+// attached; see AttachOverlay for memory which should shadow another.
 func (b *Bus) Attach(mem memory.Memory, name string, offset uint16) error {
-	om := OffsetMemory{Offset: offset, Memory: mem}
-	end := offset + uint16(mem.Size()-1)
-	entry := busEntry{mem: om, name: name, start: offset, end: end}
+	entry, err := newEntry(mem, name, offset)
+	if err != nil {
+		return err
+	}
+	for _, be := range b.entries {
+		if entry.start <= be.end && be.start <= entry.end {
+			return fmt.Errorf("%w: %s at $%04X-$%04X overlaps %s at $%04X-$%04X",
+				ErrOverlap, name, entry.start, entry.end, be.name, be.start, be.end)
+		}
+	}
 	b.entries = append(b.entries, entry)
 	return nil
 }
 
-func (b *Bus) backendFor(a uint16) (memory.Memory, error) {
-	for _, be := range b.entries {
-		if a >= be.start && a <= be.end {
-			return be.mem, nil
+// AttachOverlay maps memory over any already attached, which it shadows
+// where they overlap; accesses there go to the overlay. Later overlays
+// shadow earlier ones. As for Attach, it refuses memory of zero size and
+// memory extending beyond $FFFF.
+func (b *Bus) AttachOverlay(mem memory.Memory, name string, offset uint16) error {
+	entry, err := newEntry(mem, name, offset)
+	if err != nil {
+		return err
+	}
+	b.entries = append([]busEntry{entry}, b.entries...)
+	return nil
+}
+
+// newEntry returns the bus entry for mem at offset, checking that it fits.
+func newEntry(mem memory.Memory, name string, offset uint16) (busEntry, error) {
+	size := mem.Size()
+	if size <= 0 {
+		return busEntry{}, fmt.Errorf("%w: %s at $%04X", ErrZeroSize, name, offset)
+	}
+	if int(offset)+size > 0x10000 {
+		return busEntry{}, fmt.Errorf("%w: %s at $%04X is %d bytes", ErrOutOfRange, name, offset, size)
+	}
+	om := OffsetMemory{Offset: offset, Memory: mem}
+	entry := busEntry{mem: om, name: name, start: offset, end: offset + uint16(size-1)}
+	entry.checker, _ = mem.(memory.Checker)
+	if s, ok := mem.(memory.Static); ok {
+		entry.static = s.Static()
+	}
+	if i, ok := mem.(memory.Inert); ok {
+		entry.inert = i.Inert()
+	}
+	return entry, nil
+}
+
+func (b *Bus) backendFor(a uint16) (*busEntry, error) {
+	for i := range b.entries {
+		if be := &b.entries[i]; a >= be.start && a <= be.end {
+			return be, nil
 		}
 	}
 	return nil, fmt.Errorf("No backend for address 0x%04X", a)
 }
 
+// check finds the backend for an access, and checks that it allows it.
+// A fault is recorded for a refused access.
+func (b *Bus) check(access Access, a uint16) (*busEntry, bool) {
+	be, err := b.backendFor(a)
+	if err == nil && be.checker != nil {
+		if access == WriteAccess {
+			err = be.checker.CheckWrite(a - be.start)
+		} else {
+			err = be.checker.CheckRead(a - be.start)
+		}
+	}
+	if err != nil {
+		if b.fault == nil {
+			b.fault = &Fault{Access: access, Address: a, Err: err}
+		}
+		return nil, false
+	}
+	return be, true
+}
+
+// ObserveReads registers f to be called with the address and value of each
+// read made through the bus, after it's made.
+func (b *Bus) ObserveReads(f func(address uint16, value byte)) {
+	b.readObservers = append(b.readObservers, f)
+}
+
+// ObserveWrites registers f to be called with the address and value of each
+// write made through the bus, after it's made.
+func (b *Bus) ObserveWrites(f func(address uint16, value byte)) {
+	b.writeObservers = append(b.writeObservers, f)
+}
+
+// Static returns true if the n bytes from address a are all backed by
+// memory.Static memory, which only changes when written through the bus, or
+// loaded directly.
+func (b *Bus) Static(a uint16, n uint8) bool {
+	for i := uint16(0); i < uint16(n); i++ {
+		be, err := b.backendFor(a + i)
+		if err != nil || !be.static {
+			return false
+		}
+	}
+	return true
+}
+
+// Peek returns the byte at address a without making a bus access; no
+// observer is told of it, and it can't fault. Only memory.Inert memory may
+// be peeked, as reading other memory, e.g. I/O registers, may change it; ok
+// is false for other addresses.
+func (b *Bus) Peek(a uint16) (value byte, ok bool) {
+	be, err := b.backendFor(a)
+	if err != nil || !be.inert {
+		return 0, false
+	}
+	if be.checker != nil && be.checker.CheckRead(a-be.start) != nil {
+		return 0, false
+	}
+	return be.mem.Read(a), true
+}
+
+// TakeFault returns the first fault since it was last called, or nil if
+// there hasn't been one, and clears it.
+func (b *Bus) TakeFault() *Fault {
+	f := b.fault
+	b.fault = nil
+	return f
+}
+
 // Shutdown tells the address bus a shutdown is occurring, and to pass the
 // message on to subordinates.
 func (b *Bus) Shutdown() {
@@ -63,11 +223,14 @@ func (b *Bus) Shutdown() {
 // e.g. if ROM is mapped to 0xC000, then Read(0xC0FF) returns the byte at
 // 0x00FF in that RAM device.
 func (b *Bus) Read(a uint16) byte {
-	mem, err := b.backendFor(a)
-	if err != nil {
-		panic(err)
+	be, ok := b.check(ReadAccess, a)
+	if !ok {
+		return 0
+	}
+	value := be.mem.Read(a)
+	for _, f := range b.readObservers {
+		f(a, value)
 	}
-	value := mem.Read(a)
 	return value
 }
 
@@ -81,11 +244,14 @@ func (b *Bus) Read16(a uint16) uint16 {
 
 // Write the byte to the device mapped to the given address.
 func (b *Bus) Write(a uint16, value byte) {
-	mem, err := b.backendFor(a)
-	if err != nil {
-		panic(err)
+	be, ok := b.check(WriteAccess, a)
+	if !ok {
+		return
+	}
+	be.mem.Write(a, value)
+	for _, f := range b.writeObservers {
+		f(a, value)
 	}
-	mem.Write(a, value)
 }
 
 // Write16 writes the given 16-bit value to the specifie address, storing it
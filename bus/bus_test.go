@@ -0,0 +1,78 @@
+package bus
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pda/go6502/memory"
+)
+
+// sized is memory of a given size, whose every byte reads as its value.
+type sized struct {
+	size  int
+	value byte
+}
+
+func (m *sized) Read(a uint16) byte         { return m.value }
+func (m *sized) Write(a uint16, value byte) {}
+func (m *sized) Size() int                  { return m.size }
+func (m *sized) Shutdown()                  {}
+
+func TestAttachRefusesBadMappings(t *testing.T) {
+	tests := []struct {
+		mem      memory.Memory
+		offset   uint16
+		expected error
+	}{
+		{&sized{size: 0}, 0x9000, ErrZeroSize},
+		{&sized{size: 0x2000}, 0xF000, ErrOutOfRange},
+		{&memory.Ram{}, 0x9000, ErrOutOfRange},
+		{&sized{size: 0x10}, 0x7FF0, ErrOverlap},
+		{&sized{size: 0x1000}, 0xD800, ErrOverlap},
+		{&sized{size: 0x10000}, 0x0000, ErrOverlap},
+	}
+	for _, tt := range tests {
+		b, _ := CreateBus()
+		if err := b.Attach(&memory.Ram{}, "ram", 0x0000); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Attach(&sized{size: 0x1000}, "rom", 0xE000); err != nil {
+			t.Fatal(err)
+		}
+		err := b.Attach(tt.mem, "new", tt.offset)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%d bytes at $%04X: expected %v, got %v", tt.mem.Size(), tt.offset, tt.expected, err)
+		}
+	}
+}
+
+func TestAttachAdjacent(t *testing.T) {
+	b, _ := CreateBus()
+	for _, offset := range []uint16{0x0000, 0x8000} {
+		if err := b.Attach(&memory.Ram{}, "ram", offset); err != nil {
+			t.Errorf("$%04X: %v", offset, err)
+		}
+	}
+	if err := b.Attach(&sized{size: 1}, "byte", 0xFFFF); !errors.Is(err, ErrOverlap) {
+		t.Errorf("expected overlap, got %v", err)
+	}
+}
+
+func TestAttachOverlay(t *testing.T) {
+	b, _ := CreateBus()
+	b.Attach(&sized{size: 0x100, value: 1}, "low", 0xFF00)
+	if err := b.AttachOverlay(&sized{size: 0x10, value: 2}, "overlay", 0xFF80); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AttachOverlay(&sized{size: 0x01, value: 3}, "top", 0xFF8F); err != nil {
+		t.Fatal(err)
+	}
+	for a, expected := range map[uint16]byte{0xFF7F: 1, 0xFF80: 2, 0xFF8E: 2, 0xFF8F: 3, 0xFF90: 1} {
+		if v := b.Read(a); v != expected {
+			t.Errorf("$%04X: expected %d, got %d", a, expected, v)
+		}
+	}
+	if err := b.AttachOverlay(&sized{size: 0x200}, "big", 0xFF00); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("expected out of range, got %v", err)
+	}
+}
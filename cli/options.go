@@ -13,12 +13,25 @@ import (
 
 // Options stores the value of command line options after they're parsed.
 type Options struct {
+	BusOverlay      bool
+	Clock           string
+	Coverage        string
+	Cpu             string
+	CycleAccurate   bool
 	Debug           bool
 	DebugCmds       commandList
 	DebugSymbolFile string
+	HostSeed        int64
+	HostServices    int // -1 for none.
 	Ili9340         bool
+	Lockstep        bool
+	OnFault         string
+	Profile         string
+	ProfileFolded   string
 	SdCard          string
 	Speedometer     bool
+	Trace           string
+	TraceCompare    string
 	ViaDumpAscii    bool
 	ViaDumpBinary   bool
 	ViaSsd1306      bool
@@ -28,15 +41,28 @@ type Options struct {
 func ParseFlags() *Options {
 	opt := &Options{}
 
+	flag.BoolVar(&opt.BusOverlay, "bus-overlay", false, "Let devices attached by flags, e.g. --host-services, shadow the memory they overlap rather than failing")
+	flag.StringVar(&opt.Clock, "clock", "", "Throttle to a clock frequency, e.g. 1MHz; unthrottled by default")
+	flag.StringVar(&opt.Coverage, "coverage", "", "Record coverage to file, merged with any coverage already in it")
+	flag.StringVar(&opt.Cpu, "cpu", "6502", "CPU variant: 6502, 6502X, 65C02, R65C02 or W65C02")
+	flag.BoolVar(&opt.CycleAccurate, "cycle-accurate", false, "Make every bus access per cycle, including dummy accesses")
 	flag.BoolVar(&opt.Debug, "debug", false, "Run debugger")
 	flag.Var(&opt.DebugCmds, "debug-commands", "Debugger commands to run, semicolon separated.")
 	flag.StringVar(&opt.DebugSymbolFile, "debug-symbol-file", "", "ld65 debug file to load.")
+	flag.IntVar(&opt.HostServices, "host-services", -1, "Attach the host services device, for exit, stdin/stdout etc, at an address, e.g. 0x8000")
+	flag.Int64Var(&opt.HostSeed, "host-seed", 0, "Seed for the host services' random numbers; seeded by the time if zero")
+	flag.StringVar(&opt.Profile, "profile", "", "Write a pprof profile of cycles per address and routine to file, for go tool pprof")
+	flag.StringVar(&opt.ProfileFolded, "profile-folded", "", "Write the cycles per call stack to file, folded for flamegraph.pl")
 	flag.StringVar(&opt.SdCard, "sd-card", "", "Load file as SD card")
 	flag.BoolVar(&opt.Speedometer, "speedometer", false, "Measure effective clock speed")
+	flag.StringVar(&opt.Trace, "trace", "", "Write a line per instruction to file, in nestest.log format")
+	flag.StringVar(&opt.TraceCompare, "trace-compare", "", "Compare the --trace with a reference trace file, halting where they differ")
 	flag.BoolVar(&opt.ViaDumpBinary, "via-dump-binary", false, "6522 dumps binary output")
 	flag.BoolVar(&opt.ViaDumpAscii, "via-dump-ascii", false, "6522 dumps ASCII output")
 	flag.BoolVar(&opt.ViaSsd1306, "via-ssd1306", false, "SSD1306 OLED display on 6522")
 	flag.BoolVar(&opt.Ili9340, "ili9340", false, "ILI9340 TFT display on 6522")
+	flag.BoolVar(&opt.Lockstep, "lockstep", false, "Compare the fast and cycle-accurate cores, halting where they diverge")
+	flag.StringVar(&opt.OnFault, "on-fault", "halt", "Fault policy: halt, ignore or trap (to debugger)")
 
 	flag.Parse()
 	return opt
@@ -56,3 +82,113 @@ func (cl *commandList) Set(value string) error {
 func (cl *commandList) String() string {
 	return fmt.Sprint(*cl)
 }
+
+// DisasmOptions stores the options of the disasm subcommand.
+type DisasmOptions struct {
+	Cpu             string
+	DebugSymbolFile string
+	Origin          int // -1 to end the file at $FFFF.
+	Listing         bool
+	File            string
+}
+
+// ParseDisasmFlags parses the arguments of the disasm subcommand, which
+// follow "disasm" on the command line.
+func ParseDisasmFlags(args []string) (*DisasmOptions, error) {
+	opt := &DisasmOptions{}
+	fs := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: go6502 disasm [flags] file")
+		fs.PrintDefaults()
+	}
+
+	fs.StringVar(&opt.Cpu, "cpu", "6502", "CPU variant: 6502, 6502X, 65C02, R65C02 or W65C02")
+	fs.StringVar(&opt.DebugSymbolFile, "debug-symbol-file", "", "ld65 debug file to read labels from.")
+	fs.IntVar(&opt.Origin, "origin", -1, "Address the file is loaded at, e.g. 0xF000; by default it ends at $FFFF")
+	fs.BoolVar(&opt.Listing, "listing", false, "Write a listing of addresses and bytes rather than ca65 source")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return nil, fmt.Errorf("Expected one file to disassemble, got %d", fs.NArg())
+	}
+	opt.File = fs.Arg(0)
+	return opt, nil
+}
+
+// CoverageOptions stores the options of the coverage subcommand.
+type CoverageOptions struct {
+	DebugSymbolFile string
+	Html            string
+	Merged          string
+	SourceDir       string
+	Files           []string
+}
+
+// ParseCoverageFlags parses the arguments of the coverage subcommand, which
+// follow "coverage" on the command line.
+func ParseCoverageFlags(args []string) (*CoverageOptions, error) {
+	opt := &CoverageOptions{}
+	fs := flag.NewFlagSet("coverage", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: go6502 coverage --debug-symbol-file=file [flags] coverage-file...")
+		fs.PrintDefaults()
+	}
+
+	fs.StringVar(&opt.DebugSymbolFile, "debug-symbol-file", "", "ld65 debug file describing the program's source.")
+	fs.StringVar(&opt.Html, "html", "", "Write an HTML summary per source file and symbol to file")
+	fs.StringVar(&opt.Merged, "merged", "", "Write the merged coverage to file")
+	fs.StringVar(&opt.SourceDir, "source-dir", ".", "Directory the debug file's source file names are relative to")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() == 0 || len(opt.DebugSymbolFile) == 0 && len(opt.Merged) == 0 {
+		fs.Usage()
+		return nil, fmt.Errorf("Expected coverage files, and a debug file or --merged")
+	}
+	opt.Files = fs.Args()
+	return opt, nil
+}
+
+// Sim65Options stores the options of the sim65 subcommand.
+type Sim65Options struct {
+	Cycles          bool
+	Debug           bool
+	DebugCmds       commandList
+	DebugSymbolFile string
+	Trace           string
+	Program         string
+	Args            []string // the program's arguments, starting with Program.
+}
+
+// ParseSim65Flags parses the arguments of the sim65 subcommand, which
+// follow "sim65" on the command line. Arguments after the program are the
+// program's own.
+func ParseSim65Flags(args []string) (*Sim65Options, error) {
+	opt := &Sim65Options{}
+	fs := flag.NewFlagSet("sim65", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: go6502 sim65 [flags] program [arguments...]")
+		fs.PrintDefaults()
+	}
+
+	fs.BoolVar(&opt.Cycles, "cycles", false, "Print the number of cycles executed to stderr on exit")
+	fs.BoolVar(&opt.Debug, "debug", false, "Run debugger")
+	fs.Var(&opt.DebugCmds, "debug-commands", "Debugger commands to run, semicolon separated.")
+	fs.StringVar(&opt.DebugSymbolFile, "debug-symbol-file", "", "ld65 debug file to load.")
+	fs.StringVar(&opt.Trace, "trace", "", "Write a line per instruction to file, in nestest.log format")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return nil, fmt.Errorf("Expected a sim65 program to run")
+	}
+	opt.Program = fs.Arg(0)
+	opt.Args = fs.Args()
+	return opt, nil
+}
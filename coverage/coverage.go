@@ -0,0 +1,166 @@
+/*
+	Package coverage records which bytes of memory a cpu.Cpu executes as
+	instructions, which ways its branches go, and which bytes it reads and
+	writes as data, e.g. to find the parts of a ROM a test run didn't reach.
+
+	Coverage is saved in a text file, which accumulates the coverage of
+	several runs when they're merged into it. Reports annotate the source
+	lines of an ld65 debug file, and summarise coverage per source file and
+	per symbol in HTML.
+*/
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pda/go6502/cpu"
+)
+
+// Flags are what's been done with a byte of memory.
+type Flags uint8
+
+const (
+	Executed Flags = 1 << iota // the opcode of an instruction executed.
+	Operand                    // the operand of an instruction executed.
+	Taken                      // a conditional branch which was taken.
+	NotTaken                   // a conditional branch which wasn't taken.
+	Read                       // read as data.
+	Written                    // written as data.
+)
+
+// flagLetters are the letters for Flags in coverage files, in bit order.
+const flagLetters = "XOTNRW"
+
+func (f Flags) String() string {
+	var s []byte
+	for i := 0; i < len(flagLetters); i++ {
+		if f&(1<<i) != 0 {
+			s = append(s, flagLetters[i])
+		}
+	}
+	if len(s) == 0 {
+		return "-"
+	}
+	return string(s)
+}
+
+// parseFlags parses Flags formatted by String.
+func parseFlags(s string) (f Flags, err error) {
+	if s == "-" {
+		return 0, nil
+	}
+	for _, c := range s {
+		i := strings.IndexRune(flagLetters, c)
+		if i < 0 {
+			return 0, fmt.Errorf("Unknown coverage flag %q", c)
+		}
+		f |= 1 << i
+	}
+	return f, nil
+}
+
+// fileHeader is the first line of a coverage file.
+const fileHeader = "go6502 coverage"
+
+// Coverage is a cpu.ExecuteMonitor recording the Flags of each address.
+type Coverage struct {
+	flags [0x10000]Flags
+}
+
+// NewCoverage returns an empty Coverage, to be attached to a cpu.Cpu as a
+// monitor.
+func NewCoverage() *Coverage {
+	return &Coverage{}
+}
+
+// BeforeExecute meets the cpu.Monitor interface; instructions are recorded
+// once they've executed.
+func (c *Coverage) BeforeExecute(in cpu.Instruction) {
+}
+
+// AfterExecute records the bytes of in as executed, which way it branched,
+// and the data it read and wrote.
+func (c *Coverage) AfterExecute(in cpu.Instruction, e *cpu.Effects) {
+	pc := e.Before.PC
+	c.flags[pc] |= Executed
+	for i := uint16(1); i < uint16(in.Bytes); i++ {
+		c.flags[pc+i] |= Operand
+	}
+	switch in.Addressing() {
+	case "relative", "zeropage,relative":
+		next := pc + uint16(in.Bytes)
+		switch target := in.BranchTarget(pc); {
+		case in.Name() == "BRA":
+			// Unconditional.
+		case target == next:
+			c.flags[pc] |= Taken | NotTaken // indistinguishable.
+		case e.After.PC == target:
+			c.flags[pc] |= Taken
+		default:
+			c.flags[pc] |= NotTaken
+		}
+	}
+	for _, a := range e.Accesses {
+		if a.Write {
+			c.flags[a.Address] |= Written
+		} else {
+			c.flags[a.Address] |= Read
+		}
+	}
+}
+
+// Shutdown meets the cpu.Monitor interface.
+func (c *Coverage) Shutdown() {
+}
+
+// Flags returns what's been done with the byte at address.
+func (c *Coverage) Flags(address uint16) Flags {
+	return c.flags[address]
+}
+
+// Write writes the coverage as text: a header line, then a line for each
+// address covered, with its address and flags in hex, e.g. "F000 XT".
+func (c *Coverage) Write(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, fileHeader)
+	for a, f := range c.flags {
+		if f != 0 {
+			fmt.Fprintf(b, "%04X %v\n", a, f)
+		}
+	}
+	return b.Flush()
+}
+
+// Merge adds the coverage written by Write to r.
+func (c *Coverage) Merge(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	if !s.Scan() || s.Text() != fileHeader {
+		if err := s.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("Not a coverage file; expected %q header", fileHeader)
+	}
+	for line := 2; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("Coverage line %d: expected address and flags: %q", line, s.Text())
+		}
+		a, err := strconv.ParseUint(fields[0], 16, 16)
+		if err != nil {
+			return fmt.Errorf("Coverage line %d: %v", line, err)
+		}
+		f, err := parseFlags(fields[1])
+		if err != nil {
+			return fmt.Errorf("Coverage line %d: %v", line, err)
+		}
+		c.flags[a] |= f
+	}
+	return s.Err()
+}
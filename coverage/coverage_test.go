@@ -0,0 +1,142 @@
+package coverage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pda/go6502/asm"
+	"github.com/pda/go6502/bus"
+	"github.com/pda/go6502/cpu"
+	"github.com/pda/go6502/debugger"
+	"github.com/pda/go6502/memory"
+)
+
+// runProgram runs testdata/prog.s until it has looped at skip.
+func runProgram(t *testing.T) *Coverage {
+	source, err := os.ReadFile(filepath.Join("testdata", "prog.s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ram := &memory.Ram{}
+	p, err := asm.AssembleInto(ram, cpu.NMOS6502, 0, string(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := bus.CreateBus()
+	b.Attach(ram, "ram", 0x0000)
+	c := &cpu.Cpu{Bus: b}
+	c.PC = p.Symbols["reset"]
+	coverage := NewCoverage()
+	c.AttachMonitor(coverage)
+	for i := 0; i < 100 && c.PC != p.Symbols["skip"]; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	return coverage
+}
+
+func TestCoverage(t *testing.T) {
+	c := runProgram(t)
+	for _, tt := range []struct {
+		address uint16
+		flags   Flags
+	}{
+		{0x0200, Executed},
+		{0x0201, Operand},
+		{0x0203, Executed | Taken | NotTaken},
+		{0x0208, Executed | Taken},
+		{0x020A, 0},
+		{0x020E, Read},
+	} {
+		if f := c.Flags(tt.address); f != tt.flags {
+			t.Errorf("$%04X: expected %v, got %v", tt.address, tt.flags, f)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	c := NewCoverage()
+	c.flags[0xF000] = Executed | NotTaken
+	c.flags[0xFFFF] = Read
+	var b strings.Builder
+	if err := c.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "go6502 coverage\nF000 XN\nFFFF R\n"; b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+
+	merged := NewCoverage()
+	merged.flags[0xF000] = Executed | Taken
+	if err := merged.Merge(strings.NewReader(b.String())); err != nil {
+		t.Fatal(err)
+	}
+	if f := merged.Flags(0xF000); f != Executed|Taken|NotTaken {
+		t.Errorf("expected XTN merged, got %v", f)
+	}
+	if f := merged.Flags(0xFFFF); f != Read {
+		t.Errorf("expected R merged, got %v", f)
+	}
+	if err := merged.Merge(strings.NewReader("junk\n")); err == nil {
+		t.Error("expected an error merging junk")
+	}
+}
+
+func TestReport(t *testing.T) {
+	info, err := debugger.ReadDebugInfo(filepath.Join("testdata", "prog.dbg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReport(runProgram(t), info)
+
+	var b strings.Builder
+	readFile := func(name string) ([]byte, error) {
+		return os.ReadFile(filepath.Join("testdata", name))
+	}
+	if err := r.WriteAnnotated(&b, readFile); err != nil {
+		t.Fatal(err)
+	}
+	expected := "" +
+		"--- prog.s: 7 of 9 lines covered (77.8%), 1 partially\n" +
+		"          1: ; A test program, assembled at $0200.\n" +
+		"          2: \t.org $0200\n" +
+		"exec      3: reset:\tLDX #3\n" +
+		"exec      4: loop:\tDEX\n" +
+		"exec      5: \tBNE loop\n" +
+		"exec      6: \tLDA table\n" +
+		"part      7: \tBEQ skip\n" +
+		"####      8: \tNOP\n" +
+		"exec      9: skip:\tJMP skip\n" +
+		"data     10: table:\t.byte 0\n" +
+		"####     11: unused:\tRTS\n"
+	if b.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+
+	symbols := r.Symbols()
+	if len(symbols) != 5 {
+		t.Fatalf("expected 5 symbols, got %v", symbols)
+	}
+	if s := symbols[0]; s.Name != "reset" || s.Size != 2 || s.Executed != 2 {
+		t.Errorf("unexpected %+v", s)
+	}
+	if s := symbols[1]; s.Name != "loop" || s.Size != 9 || s.Executed != 8 {
+		t.Errorf("unexpected %+v", s)
+	}
+
+	b.Reset()
+	if err := r.WriteHTML(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"<td>prog.s</td>", "<td>unused</td><td>$020F</td>"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("expected %q in HTML", s)
+		}
+	}
+}
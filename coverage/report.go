@@ -0,0 +1,269 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pda/go6502/debugger"
+)
+
+// Report is the coverage of a program's source, as described by its ld65
+// debug info.
+type Report struct {
+	coverage *Coverage
+	info     *debugger.DebugInfo
+}
+
+// NewReport returns a report of c for the program described by info.
+func NewReport(c *Coverage, info *debugger.DebugInfo) *Report {
+	return &Report{coverage: c, info: info}
+}
+
+// lineStatus is the coverage of a source line.
+type lineStatus uint8
+
+const (
+	noCode   lineStatus = iota
+	missed              // neither executed nor accessed as data.
+	executed            // executed, with any branch going both ways.
+	partial             // executed, but a branch only went one way.
+	accessed            // read or written as data, not executed.
+)
+
+// markers are shown beside source lines of each status.
+var markers = [...]string{
+	noCode:   "",
+	missed:   "####",
+	executed: "exec",
+	partial:  "part",
+	accessed: "data",
+}
+
+// status returns the coverage of a line assembled to spans.
+func (r *Report) status(spans []debugger.Span) lineStatus {
+	var union Flags
+	branchedOneWay := false
+	for _, span := range spans {
+		for i := 0; i < span.Size; i++ {
+			f := r.coverage.Flags(span.Start + uint16(i))
+			union |= f
+			if f&Executed != 0 {
+				if branch := f & (Taken | NotTaken); branch == Taken || branch == NotTaken {
+					branchedOneWay = true
+				}
+			}
+		}
+	}
+	switch {
+	case union&Executed != 0 && branchedOneWay:
+		return partial
+	case union&Executed != 0:
+		return executed
+	case union&(Read|Written) != 0:
+		return accessed
+	}
+	return missed
+}
+
+// fileLines returns the status of each line of each source file with code,
+// by file index and line number.
+func (r *Report) fileLines() []map[int]lineStatus {
+	files := make([]map[int]lineStatus, len(r.info.Files))
+	for i := range files {
+		files[i] = make(map[int]lineStatus)
+	}
+	for _, l := range r.info.Lines {
+		status := r.status(l.Spans)
+		// A line assembled more than once, e.g. in a macro, is as well
+		// covered as its least covered instance.
+		if prev, ok := files[l.File][l.Line]; !ok || status == missed || status == partial && prev != missed {
+			files[l.File][l.Line] = status
+		}
+	}
+	return files
+}
+
+// FileSummary is the coverage of a source file's lines with code.
+type FileSummary struct {
+	Name     string
+	Lines    int // lines with code or data.
+	Covered  int // lines executed or accessed.
+	Partial  int // lines executed but only branching one way.
+	Executed int // lines executed, including partially.
+}
+
+// Percent is the percentage of lines covered.
+func (s FileSummary) Percent() float64 {
+	return percent(s.Covered, s.Lines)
+}
+
+// Files summarises the coverage of each source file with code.
+func (r *Report) Files() []FileSummary {
+	var summaries []FileSummary
+	for i, lines := range r.fileLines() {
+		if len(lines) > 0 {
+			summaries = append(summaries, summarize(r.info.Files[i], lines))
+		}
+	}
+	return summaries
+}
+
+func summarize(name string, lines map[int]lineStatus) FileSummary {
+	s := FileSummary{Name: name, Lines: len(lines)}
+	for _, status := range lines {
+		switch status {
+		case partial:
+			s.Partial++
+			s.Executed++
+			s.Covered++
+		case executed:
+			s.Executed++
+			s.Covered++
+		case accessed:
+			s.Covered++
+		}
+	}
+	return s
+}
+
+// SymbolSummary is the coverage of the bytes from a symbol to the next.
+type SymbolSummary struct {
+	Name     string
+	Address  uint16
+	Size     int
+	Executed int // bytes executed as opcodes or operands.
+	Accessed int // bytes read or written as data.
+}
+
+// Percent is the percentage of bytes executed or accessed.
+func (s SymbolSummary) Percent() float64 {
+	return percent(s.Executed+s.Accessed, s.Size)
+}
+
+// Symbols summarises the coverage of each label in the program's segments.
+// A label spans the bytes up to the next label, or the end of its segment.
+// Labels of the same address are summarised together.
+func (r *Report) Symbols() []SymbolSummary {
+	names := r.info.Symbols.ByAddress()
+	var summaries []SymbolSummary
+	for _, seg := range r.info.Segments {
+		var addresses []uint16
+		for a := range names {
+			if seg.Contains(a) {
+				addresses = append(addresses, a)
+			}
+		}
+		sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+		for i, a := range addresses {
+			end := int(seg.Start) + seg.Size
+			if i+1 < len(addresses) {
+				end = int(addresses[i+1])
+			}
+			sort.Strings(names[a])
+			s := SymbolSummary{Name: strings.Join(names[a], ", "), Address: a, Size: end - int(a)}
+			for b := int(a); b < end; b++ {
+				switch f := r.coverage.Flags(uint16(b)); {
+				case f&(Executed|Operand) != 0:
+					s.Executed++
+				case f&(Read|Written) != 0:
+					s.Accessed++
+				}
+			}
+			summaries = append(summaries, s)
+		}
+	}
+	return summaries
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// WriteAnnotated writes each source file with code, each line marked with
+// its coverage:
+//
+//	exec  executed
+//	part  executed, but a branch only went one way
+//	data  read or written as data
+//	####  neither executed nor accessed
+//
+// readFile reads the source files, by the names in the debug info; if it
+// fails, a file's lines with code are listed without their source.
+func (r *Report) WriteAnnotated(w io.Writer, readFile func(name string) ([]byte, error)) error {
+	b := bufio.NewWriter(w)
+	for i, fileLines := range r.fileLines() {
+		if len(fileLines) == 0 {
+			continue
+		}
+		s := summarize(r.info.Files[i], fileLines)
+		fmt.Fprintf(b, "--- %s: %d of %d lines covered (%.1f%%), %d partially\n",
+			s.Name, s.Covered, s.Lines, s.Percent(), s.Partial)
+		source, err := readFile(s.Name)
+		if err != nil {
+			fmt.Fprintf(b, "(source unavailable: %v)\n", err)
+			numbers := make([]int, 0, len(fileLines))
+			for n := range fileLines {
+				numbers = append(numbers, n)
+			}
+			sort.Ints(numbers)
+			for _, n := range numbers {
+				fmt.Fprintf(b, "%-5s%6d:\n", markers[fileLines[n]], n)
+			}
+			continue
+		}
+		text := strings.TrimSuffix(string(source), "\n")
+		for i, line := range strings.Split(text, "\n") {
+			fmt.Fprintf(b, "%-5s%6d: %s\n", markers[fileLines[i+1]], i+1, strings.TrimSuffix(line, "\r"))
+		}
+	}
+	return b.Flush()
+}
+
+var htmlReport = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>go6502 coverage</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { padding: 0.2em 0.8em; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+tr:nth-child(even) { background: #f4f4f4; }
+</style>
+</head>
+<body>
+<h1>go6502 coverage</h1>
+<h2>Source files</h2>
+<table>
+<tr><th>File</th><th>Lines</th><th>Covered</th><th>Partial</th><th>%</th></tr>
+{{- range .Files}}
+<tr><td>{{.Name}}</td><td>{{.Lines}}</td><td>{{.Covered}}</td><td>{{.Partial}}</td><td>{{printf "%.1f" .Percent}}</td></tr>
+{{- end}}
+</table>
+<h2>Symbols</h2>
+<table>
+<tr><th>Symbol</th><th>Address</th><th>Bytes</th><th>Executed</th><th>Data</th><th>%</th></tr>
+{{- range .Symbols}}
+<tr><td>{{.Name}}</td><td>{{printf "$%04X" .Address}}</td><td>{{.Size}}</td><td>{{.Executed}}</td><td>{{.Accessed}}</td><td>{{printf "%.1f" .Percent}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// WriteHTML writes a summary of the coverage per source file and per
+// symbol, as an HTML page.
+func (r *Report) WriteHTML(w io.Writer) error {
+	return htmlReport.Execute(w, struct {
+		Files   []FileSummary
+		Symbols []SymbolSummary
+	}{r.Files(), r.Symbols()})
+}
@@ -0,0 +1,11 @@
+; A test program, assembled at $0200.
+	.org $0200
+reset:	LDX #3
+loop:	DEX
+	BNE loop
+	LDA table
+	BEQ skip
+	NOP
+skip:	JMP skip
+table:	.byte 0
+unused:	RTS
@@ -0,0 +1,204 @@
+package cpu
+
+import "testing"
+
+// arithmeticResult is the accumulator and flags after ADC or SBC.
+type arithmeticResult struct {
+	ac                         uint8
+	carry, zero, overflow, neg bool
+}
+
+func resultOf(c *Cpu) arithmeticResult {
+	return arithmeticResult{
+		ac:       c.AC,
+		carry:    c.getStatus(sCarry),
+		zero:     c.getStatus(sZero),
+		overflow: c.getStatus(sOverflow),
+		neg:      c.getStatus(sNegative),
+	}
+}
+
+// The reference models below are independent formulations of ADC and SBC,
+// following the VICE emulator for decimal mode, rather than copies of the
+// implementation.
+
+func referenceAdc(v Variant, decimal bool, a, b uint8, carry bool) (r arithmeticResult) {
+	c := 0
+	if carry {
+		c = 1
+	}
+	signed := int(int8(a)) + int(int8(b)) + c
+	binary := int(a) + int(b) + c
+	if !decimal {
+		return arithmeticResult{
+			ac:       uint8(binary),
+			carry:    binary > 0xFF,
+			zero:     uint8(binary) == 0,
+			overflow: signed < -128 || signed > 127,
+			neg:      uint8(binary)&0x80 != 0,
+		}
+	}
+
+	tmp := int(a&0xF) + int(b&0xF) + c
+	if tmp > 0x9 {
+		tmp += 6
+	}
+	if tmp <= 0x0F {
+		tmp = tmp&0xF + int(a&0xF0) + int(b&0xF0)
+	} else {
+		tmp = tmp&0xF + int(a&0xF0) + int(b&0xF0) + 0x10
+	}
+	r.zero = uint8(binary) == 0
+	r.neg = tmp&0x80 != 0
+	r.overflow = (int(a)^tmp)&0x80 != 0 && (a^b)&0x80 == 0
+	if tmp&0x1F0 > 0x90 {
+		tmp += 0x60
+	}
+	r.carry = tmp&0xFF0 > 0xF0
+	r.ac = uint8(tmp)
+	if v.isCmos() {
+		r.zero = r.ac == 0
+		r.neg = r.ac&0x80 != 0
+	}
+	return
+}
+
+func referenceSbc(v Variant, decimal bool, a, b uint8, carry bool) (r arithmeticResult) {
+	borrow := 1
+	if carry {
+		borrow = 0
+	}
+	binary := uint(a) - uint(b) - uint(borrow)
+	signed := int(int8(a)) - int(int8(b)) - borrow
+	r = arithmeticResult{
+		ac:       uint8(binary),
+		carry:    binary < 0x100,
+		zero:     uint8(binary) == 0,
+		overflow: signed < -128 || signed > 127,
+		neg:      uint8(binary)&0x80 != 0,
+	}
+	if !decimal {
+		return
+	}
+
+	if v.isCmos() {
+		// Bruce Clark's 65C02 sequence; adjust the whole binary result.
+		result := int(a) - int(b) - borrow
+		if result < 0 {
+			result -= 0x60
+		}
+		if int(a&0xF)-int(b&0xF)-borrow < 0 {
+			result -= 0x06
+		}
+		r.ac = uint8(result)
+		r.zero = r.ac == 0
+		r.neg = r.ac&0x80 != 0
+		return
+	}
+
+	tmp := int(a&0xF) - int(b&0xF) - borrow
+	if tmp&0x10 != 0 {
+		tmp = (tmp-6)&0xF | (int(a&0xF0) - int(b&0xF0) - 0x10)
+	} else {
+		tmp = tmp&0xF | (int(a&0xF0) - int(b&0xF0))
+	}
+	if tmp&0x100 != 0 {
+		tmp -= 0x60
+	}
+	r.ac = uint8(tmp)
+	return
+}
+
+// TestArithmeticExhaustive sweeps every accumulator, operand and carry input
+// through ADC and SBC, in binary and decimal mode, for each variant.
+func TestArithmeticExhaustive(t *testing.T) {
+	c := createCpu()
+	adc := Instruction{OpType: optypes[0x69]}
+	sbc := Instruction{OpType: optypes[0xE9]}
+
+	for _, variant := range []Variant{NMOS6502, CMOS65C02} {
+		c.Variant = variant
+		for _, decimal := range []bool{false, true} {
+			for a := 0; a < 256; a++ {
+				for b := 0; b < 256; b++ {
+					for _, carry := range []bool{false, true} {
+						adc.Op8 = uint8(b)
+						sbc.Op8 = uint8(b)
+
+						c.SR = 0x30
+						c.setStatus(sDecimal, decimal)
+						c.setStatus(sCarry, carry)
+						c.AC = uint8(a)
+						c.ADC(adc)
+						expected := referenceAdc(variant, decimal, uint8(a), uint8(b), carry)
+						if actual := resultOf(c); actual != expected {
+							t.Fatalf("%v decimal:%t ADC $%02X + $%02X carry:%t\nexpected %+v\n     got %+v",
+								variant, decimal, a, b, carry, expected, actual)
+						}
+
+						c.SR = 0x30
+						c.setStatus(sDecimal, decimal)
+						c.setStatus(sCarry, carry)
+						c.AC = uint8(a)
+						c.SBC(sbc)
+						expected = referenceSbc(variant, decimal, uint8(a), uint8(b), carry)
+						if actual := resultOf(c); actual != expected {
+							t.Fatalf("%v decimal:%t SBC $%02X - $%02X carry:%t\nexpected %+v\n     got %+v",
+								variant, decimal, a, b, carry, expected, actual)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestOverflowInstructions(t *testing.T) {
+	runInstructionTests(t, []instructionTest{
+		{
+			name:    "ADC positive overflow",
+			program: []byte{0x69, 0x50},
+			before:  registers{AC: 0x50, SR: 0x30},
+			after:   registers{PC: 0x0202, AC: 0xA0, SR: 0xF0},
+		},
+		{
+			name:    "ADC negative overflow",
+			program: []byte{0x69, 0x90},
+			before:  registers{AC: 0xD0, SR: 0x30},
+			after:   registers{PC: 0x0202, AC: 0x60, SR: 0x71},
+		},
+		{
+			name:    "SBC overflow",
+			program: []byte{0xE9, 0x70},
+			before:  registers{AC: 0xD0, SR: 0x31},
+			after:   registers{PC: 0x0202, AC: 0x60, SR: 0x71},
+		},
+		{
+			name:    "SBC clears overflow",
+			program: []byte{0xE9, 0x01},
+			before:  registers{AC: 0x01, SR: 0x71},
+			after:   registers{PC: 0x0202, AC: 0x00, SR: 0x33},
+		},
+		{
+			name:    "BIT sets V from bit 6",
+			program: []byte{0x24, 0x10},
+			before:  registers{AC: 0xFF, SR: 0x30},
+			memory:  map[uint16]byte{0x0010: 0x40},
+			after:   registers{PC: 0x0202, AC: 0xFF, SR: 0x70},
+		},
+		{
+			name:    "BIT clears V from bit 6",
+			program: []byte{0x2C, 0x00, 0x03},
+			before:  registers{AC: 0x00, SR: 0x70},
+			memory:  map[uint16]byte{0x0300: 0x80},
+			after:   registers{PC: 0x0203, AC: 0x00, SR: 0xB2},
+		},
+		{
+			name:    "ADC overflow then BVS",
+			program: []byte{0x69, 0x01, 0x70, 0x10},
+			steps:   2,
+			before:  registers{AC: 0x7F, SR: 0x30},
+			after:   registers{PC: 0x0214, AC: 0x80, SR: 0xF0},
+		},
+	})
+}
@@ -0,0 +1,66 @@
+package cpu_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pda/go6502/asm"
+	"github.com/pda/go6502/bus"
+	"github.com/pda/go6502/cpu"
+	"github.com/pda/go6502/memory"
+)
+
+// TestAssembledProgram runs a program assembled with the asm package, which
+// imports cpu, so can only be used from tests outside the package.
+func TestAssembledProgram(t *testing.T) {
+	ram := &memory.Ram{}
+	p, err := asm.AssembleInto(ram, cpu.WDC65C02, 0x0200, `
+		LDX #0
+	loop:	LDA message,X
+		BEQ done
+		STA $1000,X
+		INX
+		BRA loop
+	done:	STP
+	message:
+		.byte "6502", 0
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := bus.CreateBus()
+	b.Attach(ram, "ram", 0x0000)
+	c := &cpu.Cpu{Bus: b, Variant: cpu.WDC65C02}
+	c.PC = 0x0200
+	for i := 0; i < 100 && c.PC != p.Symbols["done"]; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := string(ram[0x1000:0x1004]); got != "6502" {
+		t.Errorf("expected 6502 copied to $1000, got %q", got)
+	}
+}
+
+// TestReassembleIntoRam assembles over an instruction which has executed,
+// writing the RAM directly rather than through the bus, and expects the new
+// instruction to execute once the CPU's decoded instructions are flushed.
+func TestReassembleIntoRam(t *testing.T) {
+	ram := &memory.Ram{}
+	b, _ := bus.CreateBus()
+	b.Attach(ram, "ram", 0x0000)
+	c := &cpu.Cpu{Bus: b}
+	for _, value := range []byte{1, 2} {
+		if _, err := asm.AssembleInto(ram, cpu.NMOS6502, 0x0200, fmt.Sprintf("LDA #%d", value)); err != nil {
+			t.Fatal(err)
+		}
+		c.FlushDecoded()
+		c.PC = 0x0200
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+		if c.AC != value {
+			t.Errorf("expected AC %d, got %d", value, c.AC)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package cpu
+
+import (
+	"testing"
+
+	"github.com/pda/go6502/bus"
+	"github.com/pda/go6502/memory"
+)
+
+// benchmarkProgram is a loop of typical instructions: it increments each
+// byte of page 3 in turn.
+var benchmarkProgram = []byte{
+	0xA2, 0x00, // LDX #$00
+	0xBD, 0x00, 0x03, // LDA $0300,X
+	0x69, 0x01, // ADC #$01
+	0x9D, 0x00, 0x03, // STA $0300,X
+	0xE8,       // INX
+	0xD0, 0xF5, // BNE $0202
+	0x4C, 0x00, 0x02, // JMP $0200
+}
+
+// uncachedRam is RAM which isn't memory.Static, so instructions decoded from
+// it aren't cached.
+type uncachedRam struct {
+	*memory.Ram
+}
+
+func (uncachedRam) Static() bool { return false }
+
+func benchmarkStep(b *testing.B, variant Variant, accurate bool) {
+	benchmarkStepIn(b, createCpu(), variant, accurate)
+}
+
+func benchmarkStepIn(b *testing.B, c *Cpu, variant Variant, accurate bool) {
+	c.Variant = variant
+	c.CycleAccurate = accurate
+	c.PC = programStart
+	for i, v := range benchmarkProgram {
+		c.Bus.Write(programStart+uint16(i), v)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Step()
+	}
+}
+
+func BenchmarkStep(b *testing.B) {
+	benchmarkStep(b, NMOS6502, false)
+}
+
+// BenchmarkStepUncached is BenchmarkStep without the decode cache.
+func BenchmarkStepUncached(b *testing.B) {
+	addressBus, _ := bus.CreateBus()
+	addressBus.Attach(uncachedRam{&memory.Ram{}}, "ram", 0x0000)
+	benchmarkStepIn(b, &Cpu{Bus: addressBus}, NMOS6502, false)
+}
+
+func BenchmarkStepCmos(b *testing.B) {
+	benchmarkStep(b, WDC65C02, false)
+}
+
+func BenchmarkStepCycleAccurate(b *testing.B) {
+	benchmarkStep(b, NMOS6502, true)
+}
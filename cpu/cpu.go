@@ -3,14 +3,27 @@
 
 	cpu.Cpu requires a bus.Bus to read/write 8-bit data to 16-bit addresses.
 
-	cpu.Cpu also provides a monitor hook, allowing external code to observe
-	and block on instructions before they're executed.
+	cpu.Cpu also provides monitor hooks, allowing a chain of external code to
+	observe and block on instructions before they're executed, and to see
+	their effects afterwards.
+
+	Cpu.Run executes instructions until cancelled, or until the program exits
+	or faults. It can be paused from other goroutines, to safely inspect the
+	CPU and its memory.
+
+	Devices interrupt the CPU by driving its IRQ and NMI lines with
+	Cpu.SetIRQ and Cpu.SetNMI, and drive its SO, RDY and RESB inputs with
+	Cpu.SetSO, Cpu.SetRDY and Cpu.SetRESB.
+
+	Setting Cpu.CycleAccurate selects a cycle-stepped core, which makes every
+	bus access the processor does, in order, for devices sensitive to them.
 */
 package cpu
 
 import (
 	"fmt"
 	"strings"
+	"sync/atomic"
 
 	"github.com/pda/go6502/bus"
 )
@@ -52,12 +65,70 @@ type Cpu struct {
 	// Status register; carry, zero, interrupt, bcd, brk, _, overflow, sign.
 	SR byte
 
+	// Variant selects the processor model being emulated; NMOS6502 unless
+	// otherwise specified.
+	Variant Variant
+
+	// CycleAccurate selects the cycle-stepped core, which makes each bus
+	// access the processor does, one per cycle, including dummy reads and
+	// writes. Otherwise only the accesses which affect the result are made.
+	CycleAccurate bool
+
+	// FaultPolicy selects what happens when an instruction faults, e.g. on
+	// an illegal opcode or an access to unmapped memory; FaultHalt unless
+	// otherwise specified.
+	FaultPolicy FaultPolicy
+
+	// Cycles is the number of clock cycles elapsed, including those taken by
+	// reset and interrupt sequences. It only ever increases.
+	Cycles uint64
+
 	// Bus is the system address bus, mapping 64K of address space to
 	// different back-end devices.
 	Bus *bus.Bus
 
-	monitor  Monitor
-	ExitChan chan int
+	monitors      []Monitor
+	cycleObserver CycleObserver
+	runState      runState
+	decoded       decodeCache
+
+	irq        interruptLine
+	nmi        interruptLine
+	nmiPending atomic.Bool
+	so         interruptLine
+	soPending  atomic.Bool
+	rdy        interruptLine
+	resb       interruptLine
+	resetting  atomic.Bool // RESB asserted; reset once it's released.
+
+	waiting bool  // WAI executed; awaiting an interrupt.
+	stopped bool  // STP executed; awaiting reset.
+	fault   error // halted by a fault; awaiting reset.
+
+	// indexing is set by memoryAddress for modes which add an index to an
+	// address in two steps; low byte, then carry into the high byte.
+	// pageCrossed is set if there was a carry, and unfixed holds the address
+	// before it was added.
+	indexing    bool
+	pageCrossed bool
+	unfixed     uint16
+
+	// lastAddress is the address of the latest bus access.
+	lastAddress uint16
+
+	// effects are recorded for ExecuteMonitors while tracing.
+	tracing bool
+	effects Effects
+
+	// interrupted is the vector of the interrupt taken by the latest Step,
+	// or zero, and fetchCycles the cycle count before its instruction was
+	// fetched; Lockstep aligns its shadow core by them.
+	interrupted uint16
+	fetchCycles uint64
+
+	// monitoring is set while monitors run; their bus accesses aren't the
+	// CPU's.
+	monitoring bool
 }
 
 // A Monitor is a blocking observer of instruction execution.
@@ -66,19 +137,22 @@ type Monitor interface {
 	Shutdown()
 }
 
-// AttachMonitor sets the given Monitor to observe instructions before they
+// AttachMonitor adds the given Monitor to observe instructions before they
 // execute, in a blocking manner. This allows for logging, analysis, and
-// interactive debugging.
+// interactive debugging. Monitors are called in the order attached.
 func (c *Cpu) AttachMonitor(m Monitor) {
-	c.monitor = m
+	c.monitors = append(c.monitors, m)
+	if _, ok := m.(ExecuteMonitor); ok {
+		c.tracing = true
+	}
 }
 
 // Shutdown tells the CPU to shut-down, and to pass the message on
 // to subordinates such as the address bus.
 func (c *Cpu) Shutdown() {
 	c.Bus.Shutdown()
-	if c.monitor != nil {
-		c.monitor.Shutdown()
+	for _, m := range c.monitors {
+		m.Shutdown()
 	}
 }
 
@@ -88,17 +162,121 @@ func (c *Cpu) Shutdown() {
 // Register (P) are initialized by hardware. ... The program counter is loaded
 // with the reset vector from locations FFFC (low byte) and FFFD (high byte).
 func (c *Cpu) Reset() {
-	c.PC = c.Bus.Read16(0xFFFC)
+	c.Bus.TakeFault()
+
+	// Reset follows the interrupt sequence with its writes suppressed.
+	c.tick(7)
+	c.dummyRead(c.PC)
+	c.dummyRead(c.PC)
+	for i := uint8(0); i < 3; i++ {
+		c.dummyRead(StackBase + uint16(c.SP-i))
+	}
+	c.PC = c.read16(ResetVector)
 	c.SR = 0x34 // Manual says xx1101xx, this sets 00110100.
+	c.nmiPending.Store(false)
+	c.soPending.Store(false)
+	c.endWait()
+	c.stopped = false
+	c.fault = nil
+	c.runState.exit.Store(nil)
+}
+
+// Step executes the next instruction, first taking any pending interrupt
+// so that the instruction is the first of its handler.
+// A fault is handled according to the FaultPolicy; Step returns it if that
+// halts the CPU, and until the CPU is reset. Likewise, Step returns an
+// ExitError once the program has exited. While RDY is held low, or RESB
+// asserted, Step spends a cycle instead.
+func (c *Cpu) Step() error {
+	if c.resb.asserted.Load() {
+		c.penalty(c.PC)
+		c.Bus.TakeFault()
+		return nil
+	}
+	if c.resetting.CompareAndSwap(true, false) {
+		c.Reset()
+	}
+	if c.fault != nil {
+		return c.fault
+	}
+	if err := c.exited(); err != nil {
+		return err
+	}
+	if c.stopped {
+		return nil
+	}
+	if c.soPending.CompareAndSwap(true, false) {
+		c.setStatus(sOverflow, true)
+	}
+	pc := c.PC
+	if c.waiting {
+		if !c.irq.asserted.Load() && !c.nmiPending.Load() {
+			c.penalty(c.PC)
+			return c.checkFault(c.busFault(pc))
+		}
+		c.endWait()
+	}
+	if c.rdy.asserted.Load() {
+		c.penalty(c.PC)
+		return c.checkFault(c.busFault(pc))
+	}
+	c.interrupted = 0
+	c.serviceInterrupts()
+	c.fetchCycles = c.Cycles
+	pc = c.PC
+	var (
+		in  Instruction
+		err error
+	)
+	next := c.PC
+	if c.CycleAccurate {
+		in, next, err = c.fetch(c.PC)
+	} else {
+		in, err = c.decode(c.PC)
+		next += uint16(in.Bytes)
+	}
+	if err == nil {
+		err = c.busFault(pc)
+	}
+	if err := c.checkFault(err); err != nil {
+		return err
+	}
+	c.monitoring = true
+	for _, m := range c.monitors {
+		m.BeforeExecute(in)
+		c.Bus.TakeFault() // the monitor's own accesses aren't the CPU's.
+		if c.fault != nil {
+			c.monitoring = false
+			return c.fault // halted by the monitor.
+		}
+	}
+	c.monitoring = false
+	if c.tracing {
+		c.startEffects()
+	}
+	c.PC = next
+	c.tick(in.Cycles)
+	c.execute(in)
+	err = c.busFault(pc)
+	if c.tracing {
+		c.afterExecute(in)
+		c.Bus.TakeFault()
+		if c.fault != nil {
+			return c.fault // halted by the monitor.
+		}
+	}
+	if err := c.checkFault(err); err != nil {
+		return err
+	}
+	return c.exited()
 }
 
-func (c *Cpu) Step() {
-	in := ReadInstruction(c.PC, c.Bus)
-	if c.monitor != nil {
-		c.monitor.BeforeExecute(in)
+// checkFault returns err if it has halted the CPU.
+func (c *Cpu) checkFault(err error) error {
+	if err != nil && c.faulted(err) {
+		return err
 	}
-	c.PC += uint16(in.Bytes)
-	c.execute(in)
+	return nil
 }
 
 func (c *Cpu) String() string {
@@ -109,8 +287,40 @@ func (c *Cpu) String() string {
 	)
 }
 
-func (c *Cpu) stackHead(offset int8) uint16 {
-	return uint16(StackBase) + uint16(c.SP) + uint16(offset)
+// push stores a byte at the head of the stack, then decrements the stack
+// pointer, wrapping within the stack page.
+func (c *Cpu) push(value byte) {
+	c.write(StackBase+uint16(c.SP), value)
+	c.SP--
+}
+
+// pull increments the stack pointer, wrapping within the stack page, then
+// reads the byte at the head of the stack.
+func (c *Cpu) pull() byte {
+	c.SP++
+	return c.read(StackBase + uint16(c.SP))
+}
+
+// push16 pushes a 16-bit value high byte first, leaving it little-endian in
+// memory.
+func (c *Cpu) push16(value uint16) {
+	c.push(byte(value >> 8))
+	c.push(byte(value))
+}
+
+// pull16 pulls a 16-bit value pushed by push16.
+func (c *Cpu) pull16() uint16 {
+	lo := uint16(c.pull())
+	hi := uint16(c.pull())
+	return hi<<8 | lo
+}
+
+// zeropageRead16 reads a little-endian 16-bit value from zero-page, with the
+// high byte wrapping from $FF to $00 rather than leaving the zero page.
+func (c *Cpu) zeropageRead16(a uint8) uint16 {
+	lo := uint16(c.read(uint16(a)))
+	hi := uint16(c.read(uint16(a + 1)))
+	return hi<<8 | lo
 }
 
 func (c *Cpu) resolveOperand(in Instruction) uint8 {
@@ -118,43 +328,114 @@ func (c *Cpu) resolveOperand(in Instruction) uint8 {
 	case immediate:
 		return in.Op8
 	default:
-		return c.Bus.Read(c.memoryAddress(in))
+		address := c.memoryAddress(in)
+		if c.pageCrossed {
+			c.penalty(c.idleAddress(c.unfixed))
+		}
+		return c.read(address)
+	}
+}
+
+// indexed adds index to base, noting whether a page boundary was crossed.
+func (c *Cpu) indexed(base uint16, index uint8) uint16 {
+	address := base + uint16(index)
+	c.indexing = true
+	c.pageCrossed = address&0xFF00 != base&0xFF00
+	c.unfixed = base&0xFF00 | address&0x00FF
+	return address
+}
+
+// writeAddress is memoryAddress for instructions which write to memory.
+// Reads only take a cycle to fix up an indexed address's high byte when
+// there's a carry, but writes can't be undone so always take it; except for
+// the 65C02's shifts and rotates.
+func (c *Cpu) writeAddress(in Instruction) uint16 {
+	address := c.memoryAddress(in)
+	if !c.indexing {
+		return address
+	}
+	switch {
+	case c.Variant.isCmos() && in.isShift():
+		if c.pageCrossed {
+			c.penalty(c.idleAddress(c.unfixed))
+		}
+	default:
+		c.dummyRead(c.idleAddress(c.unfixed))
 	}
+	return address
 }
 
+// memoryAddress returns the effective address of an instruction's memory
+// operand, making the accesses needed to calculate it.
 func (c *Cpu) memoryAddress(in Instruction) uint16 {
+	address := c.operandAddress(in)
+	if c.tracing {
+		c.effects.Address, c.effects.HasAddress = address, true
+	}
+	return address
+}
+
+func (c *Cpu) operandAddress(in Instruction) uint16 {
+	c.indexing = false
+	c.pageCrossed = false
 	switch in.addressing {
 	case absolute:
 		return in.Op16
 	case absoluteX:
-		return in.Op16 + uint16(c.X)
+		return c.indexed(in.Op16, c.X)
 	case absoluteY:
-		return in.Op16 + uint16(c.Y)
+		return c.indexed(in.Op16, c.Y)
+
+	// Indirect, only used by JMP.
+	// Operand is the absolute location of a little-endian 16-bit address.
+	// The NMOS 6502 doesn't carry into the high byte when fetching the
+	// address, so JMP ($10FF) reads its high byte from $1000. The 65C02
+	// fixed this.
+	case indirect:
+		if c.Variant.isCmos() {
+			c.dummyRead(c.lastAddress)
+			return c.read16(in.Op16)
+		}
+		lo := uint16(c.read(in.Op16))
+		hi := uint16(c.read(in.Op16&0xFF00 | uint16(uint8(in.Op16)+1)))
+		return hi<<8 | lo
+
+	// Absolute Indexed Indirect, only used by the 65C02 JMP (abs,X).
+	// The X register is added to the operand, giving the location of a
+	// little-endian 16-bit address.
+	case absoluteIndirectX:
+		c.dummyRead(c.lastAddress)
+		return c.read16(in.Op16 + uint16(c.X))
 
 	// Indexed Indirect (X)
 	// Operand is the zero-page location of a little-endian 16-bit base address.
 	// The X register is added (wrapping; discarding overflow) before loading.
 	// The resulting address loaded from (base+X) becomes the effective operand.
-	// (base + X) must be in zero-page.
+	// Both bytes of the address are read from zero-page, wrapping at $FF.
 	case indirectX:
-		location := uint16(in.Op8 + c.X)
-		if location == 0xFF {
-			panic("Indexed indirect high-byte not on zero page.")
-		}
-		return c.Bus.Read16(location)
+		c.dummyRead(c.idleAddress(uint16(in.Op8)))
+		return c.zeropageRead16(in.Op8 + c.X)
 
 	// Indirect Indexed (Y)
 	// Operand is the zero-page location of a little-endian 16-bit address.
 	// The address is loaded, and then the Y register is added to it.
 	// The resulting loaded_address + Y becomes the effective operand.
 	case indirectY:
-		return c.Bus.Read16(uint16(in.Op8)) + uint16(c.Y)
+		return c.indexed(c.zeropageRead16(in.Op8), c.Y)
+
+	// Zero Page Indirect (65C02)
+	// Operand is the zero-page location of a little-endian 16-bit address,
+	// which becomes the effective operand.
+	case zeropageIndirect:
+		return c.zeropageRead16(in.Op8)
 
 	case zeropage:
 		return uint16(in.Op8)
 	case zeropageX:
+		c.dummyRead(c.idleAddress(uint16(in.Op8)))
 		return uint16(in.Op8 + c.X)
 	case zeropageY:
+		c.dummyRead(c.idleAddress(uint16(in.Op8)))
 		return uint16(in.Op8 + c.Y)
 	default:
 		panic("unhandled addressing")
@@ -196,11 +477,17 @@ func (c *Cpu) statusString() string {
 }
 
 func (c *Cpu) branch(in Instruction) {
-	relative := int8(in.Op8) // signed
-	if relative >= 0 {
-		c.PC += uint16(relative)
-	} else {
-		c.PC -= uint16(-relative)
+	c.branchBy(in.Op8)
+}
+
+// branchBy adds a signed 8-bit offset to the program counter.
+// A taken branch costs an extra cycle, and another if it crosses a page.
+func (c *Cpu) branchBy(offset uint8) {
+	from := c.PC
+	c.penalty(from)
+	c.PC += uint16(int8(offset)) // sign-extended, wrapping
+	if from&0xFF00 != c.PC&0xFF00 {
+		c.penalty(c.idleAddress(from&0xFF00 | c.PC&0x00FF))
 	}
 }
 
@@ -208,10 +495,20 @@ func (c *Cpu) execute(in Instruction) {
 	switch in.id {
 	case adc:
 		c.ADC(in)
+	case alr:
+		c.ALR(in)
+	case anc:
+		c.ANC(in)
 	case and:
 		c.AND(in)
+	case arr:
+		c.ARR(in)
 	case asl:
 		c.ASL(in)
+	case bbr:
+		c.BBR(in)
+	case bbs:
+		c.BBS(in)
 	case bcc:
 		c.BCC(in)
 	case bcs:
@@ -226,20 +523,30 @@ func (c *Cpu) execute(in Instruction) {
 		c.BNE(in)
 	case bpl:
 		c.BPL(in)
+	case bra:
+		c.BRA(in)
 	case brk:
 		c.BRK(in)
+	case bvc:
+		c.BVC(in)
+	case bvs:
+		c.BVS(in)
 	case clc:
 		c.CLC(in)
 	case cld:
 		c.CLD(in)
 	case cli:
 		c.CLI(in)
+	case clv:
+		c.CLV(in)
 	case cmp:
 		c.CMP(in)
 	case cpx:
 		c.CPX(in)
 	case cpy:
 		c.CPY(in)
+	case dcp:
+		c.DCP(in)
 	case dec:
 		c.DEC(in)
 	case dex:
@@ -254,10 +561,18 @@ func (c *Cpu) execute(in Instruction) {
 		c.INX(in)
 	case iny:
 		c.INY(in)
+	case isc:
+		c.ISC(in)
+	case jam:
+		c.JAM(in)
 	case jmp:
 		c.JMP(in)
 	case jsr:
 		c.JSR(in)
+	case las:
+		c.LAS(in)
+	case lax:
+		c.LAX(in)
 	case lda:
 		c.LDA(in)
 	case ldx:
@@ -272,30 +587,70 @@ func (c *Cpu) execute(in Instruction) {
 		c.ORA(in)
 	case pha:
 		c.PHA(in)
+	case php:
+		c.PHP(in)
+	case phx:
+		c.PHX(in)
+	case phy:
+		c.PHY(in)
 	case pla:
 		c.PLA(in)
+	case plp:
+		c.PLP(in)
+	case plx:
+		c.PLX(in)
+	case ply:
+		c.PLY(in)
+	case rla:
+		c.RLA(in)
+	case rmb:
+		c.RMB(in)
 	case rol:
 		c.ROL(in)
 	case ror:
 		c.ROR(in)
+	case rra:
+		c.RRA(in)
+	case rti:
+		c.RTI(in)
 	case rts:
 		c.RTS(in)
+	case sax:
+		c.SAX(in)
 	case sbc:
 		c.SBC(in)
+	case sbx:
+		c.SBX(in)
 	case sec:
 		c.SEC(in)
+	case sed:
+		c.SED(in)
 	case sei:
 		c.SEI(in)
+	case slo:
+		c.SLO(in)
+	case smb:
+		c.SMB(in)
+	case sre:
+		c.SRE(in)
 	case sta:
 		c.STA(in)
+	case stp:
+		c.STP(in)
 	case stx:
 		c.STX(in)
 	case sty:
 		c.STY(in)
+	case stz:
+		c.STZ(in)
 	case tax:
 		c.TAX(in)
 	case tay:
 		c.TAY(in)
+	case trb:
+		c.TRB(in)
+	case tsb:
+		c.TSB(in)
 	case tsx:
 		c.TSX(in)
 	case txa:
@@ -304,8 +659,8 @@ func (c *Cpu) execute(in Instruction) {
 		c.TXS(in)
 	case tya:
 		c.TYA(in)
-	case _end:
-		c._END(in)
+	case wai:
+		c.WAI(in)
 	default:
 		panic(fmt.Sprintf("unhandled instruction: %v", in))
 	}
@@ -313,9 +668,39 @@ func (c *Cpu) execute(in Instruction) {
 
 // ADC: Add memory and carry to accumulator.
 func (c *Cpu) ADC(in Instruction) {
-	value16 := uint16(c.AC) + uint16(c.resolveOperand(in)) + uint16(c.getStatusInt(sCarry))
+	c.adc(c.resolveOperand(in))
+}
+
+// adc adds value and carry to the accumulator, in binary or decimal mode.
+// The 65C02 takes an extra cycle in decimal mode.
+func (c *Cpu) adc(value uint8) {
+	if c.getStatus(sDecimal) {
+		if c.Variant.isCmos() {
+			c.penalty(c.lastAddress)
+		}
+		c.adcDecimal(value)
+		return
+	}
+	c.addBinary(value)
+}
+
+// addBinary adds value and carry to the accumulator, setting all of the
+// arithmetic flags. It's the core of both ADC and SBC.
+func (c *Cpu) addBinary(value uint8) {
+	value16 := uint16(c.AC) + uint16(value) + uint16(c.getStatusInt(sCarry))
+	result := uint8(value16)
+
+	// v: Set if signed overflow; cleared if valid sign result.
+	// Overflow occurs when both inputs share a sign which the result doesn't.
+	c.setStatus(sOverflow, (c.AC^result)&(value^result)&0x80 != 0)
+
+	// c: Set if unsigned overflow.
 	c.setStatus(sCarry, value16 > 0xFF)
-	c.AC = uint8(value16)
+
+	c.AC = result
+
+	// n: Set if most significant bit of result is set; else cleared.
+	// z: Set if result is zero; else cleared.
 	c.updateStatus(c.AC)
 }
 
@@ -333,15 +718,45 @@ func (c *Cpu) ASL(in Instruction) {
 		c.AC <<= 1
 		c.updateStatus(c.AC)
 	default:
-		address := c.memoryAddress(in)
-		value := c.Bus.Read(address)
-		c.setStatus(sCarry, (value>>7) == 1) // carry = old bit 7
-		value <<= 1
-		c.Bus.Write(address, value)
+		value := c.modify(c.writeAddress(in), func(value uint8) uint8 {
+			c.setStatus(sCarry, (value>>7) == 1) // carry = old bit 7
+			return value << 1
+		})
 		c.updateStatus(value)
 	}
 }
 
+// BBR: Branch on bit reset (Rockwell 65C02).
+// Tests a bit of a zero-page location, branching if it's clear.
+func (c *Cpu) BBR(in Instruction) {
+	if set, offset := c.testBit(in); !set {
+		c.branchBy(offset)
+	}
+}
+
+// BBS: Branch on bit set (Rockwell 65C02).
+// Tests a bit of a zero-page location, branching if it's set.
+func (c *Cpu) BBS(in Instruction) {
+	if set, offset := c.testBit(in); set {
+		c.branchBy(offset)
+	}
+}
+
+// testBit reads the zero-page bit tested by BBR or BBS, returning it along
+// with the branch offset. The processor reads the location twice before
+// fetching the offset.
+func (c *Cpu) testBit(in Instruction) (set bool, offset uint8) {
+	address := uint16(uint8(in.Op16))
+	value := c.read(address)
+	c.dummyRead(address)
+	offset = uint8(in.Op16 >> 8)
+	if c.CycleAccurate {
+		offset = c.read(c.PC)
+		c.PC++
+	}
+	return value&(1<<in.bitNumber()) != 0, offset
+}
+
 // BCC: Branch if carry clear.
 func (c *Cpu) BCC(in Instruction) {
 	if !c.getStatus(sCarry) {
@@ -364,9 +779,14 @@ func (c *Cpu) BEQ(in Instruction) {
 }
 
 // BIT: Bit Test.
+// The 65C02 immediate mode only sets Z; there's no memory to take N and V
+// from.
 func (c *Cpu) BIT(in Instruction) {
 	value := c.resolveOperand(in)
 	c.setStatus(sZero, value&c.AC == 0)
+	if in.addressing == immediate {
+		return
+	}
 	c.setStatus(sOverflow, value&(1<<6) != 0)
 	c.setStatus(sNegative, value&(1<<7) != 0)
 }
@@ -392,10 +812,31 @@ func (c *Cpu) BPL(in Instruction) {
 	}
 }
 
-// BRK: software interrupt
+// BRK: Force break; a software interrupt through the IRQ vector.
+// BRK is followed by a padding byte which is skipped on return, so the
+// address pushed is that of the BRK plus two.
 func (c *Cpu) BRK(in Instruction) {
-	// temporarily used to dump status
-	fmt.Println("BRK:", c)
+	c.PC++
+	c.interrupt(IrqVector, true)
+}
+
+// BRA: Branch always (65C02).
+func (c *Cpu) BRA(in Instruction) {
+	c.branch(in)
+}
+
+// BVC: Branch if overflow clear.
+func (c *Cpu) BVC(in Instruction) {
+	if !c.getStatus(sOverflow) {
+		c.branch(in)
+	}
+}
+
+// BVS: Branch if overflow set.
+func (c *Cpu) BVS(in Instruction) {
+	if c.getStatus(sOverflow) {
+		c.branch(in)
+	}
 }
 
 // CLC: Clear carry flag.
@@ -410,7 +851,12 @@ func (c *Cpu) CLD(in Instruction) {
 
 // CLI: Clear interrupt-disable flag.
 func (c *Cpu) CLI(in Instruction) {
-	c.setStatus(sInterrupt, true)
+	c.setStatus(sInterrupt, false)
+}
+
+// CLV: Clear overflow flag.
+func (c *Cpu) CLV(in Instruction) {
+	c.setStatus(sOverflow, false)
 }
 
 // CMP: Compare accumulator with memory.
@@ -434,11 +880,16 @@ func (c *Cpu) CPY(in Instruction) {
 	c.updateStatus(c.Y - value)
 }
 
-// DEC: Decrement.
+// DEC: Decrement memory or (65C02) accumulator.
 func (c *Cpu) DEC(in Instruction) {
-	address := c.memoryAddress(in)
-	value := c.Bus.Read(address) - 1
-	c.Bus.Write(address, value)
+	if in.addressing == accumulator {
+		c.AC--
+		c.updateStatus(c.AC)
+		return
+	}
+	value := c.modify(c.writeAddress(in), func(value uint8) uint8 {
+		return value - 1
+	})
 	c.updateStatus(value)
 }
 
@@ -461,11 +912,16 @@ func (c *Cpu) EOR(in Instruction) {
 	c.updateStatus(c.AC)
 }
 
-// INC: Increment.
+// INC: Increment memory or (65C02) accumulator.
 func (c *Cpu) INC(in Instruction) {
-	address := c.memoryAddress(in)
-	value := c.Bus.Read(address) + 1
-	c.Bus.Write(address, value)
+	if in.addressing == accumulator {
+		c.AC++
+		c.updateStatus(c.AC)
+		return
+	}
+	value := c.modify(c.writeAddress(in), func(value uint8) uint8 {
+		return value + 1
+	})
 	c.updateStatus(value)
 }
 
@@ -487,9 +943,18 @@ func (c *Cpu) JMP(in Instruction) {
 }
 
 // JSR: Jump to subroutine.
+// The address pushed is that of the last byte of the JSR instruction.
+// The processor fetches that byte after pushing its address.
 func (c *Cpu) JSR(in Instruction) {
-	c.Bus.Write16(c.stackHead(-1), c.PC-1)
-	c.SP -= 2
+	if c.CycleAccurate {
+		c.dummyStackRead()
+		c.push16(c.PC)
+		// The push may have overwritten the high byte, if the JSR is on the
+		// stack page, replacing any peeked by fetch.
+		in.Op16 = in.Op16&0xFF | uint16(c.read(c.PC))<<8
+	} else {
+		c.push16(c.PC - 1)
+	}
 	c.PC = in.Op16
 }
 
@@ -519,17 +984,28 @@ func (c *Cpu) LSR(in Instruction) {
 		c.AC >>= 1
 		c.updateStatus(c.AC)
 	default:
-		address := c.memoryAddress(in)
-		value := c.Bus.Read(address)
-		c.setStatus(sCarry, value&1 == 1)
-		value >>= 1
-		c.Bus.Write(address, value)
+		value := c.modify(c.writeAddress(in), func(value uint8) uint8 {
+			c.setStatus(sCarry, value&1 == 1)
+			return value >> 1
+		})
 		c.updateStatus(value)
 	}
 }
 
 // NOP: No operation.
+// The undocumented NOPs with a memory operand read and discard it.
+// The 65C02's $5C reads its operand then idles for four more cycles.
 func (c *Cpu) NOP(in Instruction) {
+	switch in.addressing {
+	case implied, immediate:
+	default:
+		c.resolveOperand(in)
+		if in.Cycles == 8 {
+			for i := 0; i < 4; i++ {
+				c.dummyRead(c.lastAddress)
+			}
+		}
+	}
 }
 
 // ORA: OR accumulator with memory.
@@ -540,14 +1016,59 @@ func (c *Cpu) ORA(in Instruction) {
 
 // PHA: Push accumulator onto stack.
 func (c *Cpu) PHA(in Instruction) {
-	c.Bus.Write(0x0100+uint16(c.SP), c.AC)
-	c.SP--
+	c.push(c.AC)
+}
+
+// PHP: Push processor status onto stack.
+// The pushed copy always has the break bit and unused bit 5 set.
+func (c *Cpu) PHP(in Instruction) {
+	c.push(c.SR | 1<<sBreak | 1<<5)
+}
+
+// PHX: Push index register X onto stack (65C02).
+func (c *Cpu) PHX(in Instruction) {
+	c.push(c.X)
+}
+
+// PHY: Push index register Y onto stack (65C02).
+func (c *Cpu) PHY(in Instruction) {
+	c.push(c.Y)
 }
 
 // PLA: Pull accumulator from stack.
 func (c *Cpu) PLA(in Instruction) {
-	c.SP++
-	c.AC = c.Bus.Read(0x0100 + uint16(c.SP))
+	c.dummyStackRead()
+	c.AC = c.pull()
+	c.updateStatus(c.AC)
+}
+
+// PLP: Pull processor status from stack.
+// The break bit and bit 5 don't exist as flip-flops in the processor, so
+// they're unaffected by the pulled value.
+func (c *Cpu) PLP(in Instruction) {
+	c.dummyStackRead()
+	c.SR = c.pull() | 1<<sBreak | 1<<5
+}
+
+// PLX: Pull index register X from stack (65C02).
+func (c *Cpu) PLX(in Instruction) {
+	c.dummyStackRead()
+	c.X = c.pull()
+	c.updateStatus(c.X)
+}
+
+// PLY: Pull index register Y from stack (65C02).
+func (c *Cpu) PLY(in Instruction) {
+	c.dummyStackRead()
+	c.Y = c.pull()
+	c.updateStatus(c.Y)
+}
+
+// RMB: Reset memory bit (Rockwell 65C02).
+func (c *Cpu) RMB(in Instruction) {
+	c.modify(c.writeAddress(in), func(value uint8) uint8 {
+		return value &^ (1 << in.bitNumber())
+	})
 }
 
 // ROL: Rotate memory or accumulator left one bit.
@@ -559,16 +1080,15 @@ func (c *Cpu) ROL(in Instruction) {
 		c.AC = c.AC<<1 | carry
 		c.updateStatus(c.AC)
 	default:
-		address := c.memoryAddress(in)
-		value := c.Bus.Read(address)
-		c.setStatus(sCarry, value>>7 == 1)
-		value = value<<1 | carry
-		c.Bus.Write(address, value)
+		value := c.modify(c.writeAddress(in), func(value uint8) uint8 {
+			c.setStatus(sCarry, value>>7 == 1)
+			return value<<1 | carry
+		})
 		c.updateStatus(value)
 	}
 }
 
-// ROR: Rotate memory or accumulator left one bit.
+// ROR: Rotate memory or accumulator right one bit.
 func (c *Cpu) ROR(in Instruction) {
 	carry := c.getStatusInt(sCarry)
 	switch in.addressing {
@@ -577,39 +1097,51 @@ func (c *Cpu) ROR(in Instruction) {
 		c.AC = c.AC>>1 | carry<<7
 		c.updateStatus(c.AC)
 	default:
-		address := c.memoryAddress(in)
-		value := c.Bus.Read(address)
-		c.setStatus(sCarry, value&1 == 1)
-		value = value>>1 | carry<<7
-		c.Bus.Write(address, value)
+		value := c.modify(c.writeAddress(in), func(value uint8) uint8 {
+			c.setStatus(sCarry, value&1 == 1)
+			return value>>1 | carry<<7
+		})
 		c.updateStatus(value)
 	}
 }
 
+// RTI: Return from interrupt.
+// Status is pulled as for PLP, followed by the program counter. Unlike RTS,
+// the pulled address is the next instruction, not the one before it.
+func (c *Cpu) RTI(in Instruction) {
+	c.dummyStackRead()
+	c.SR = c.pull() | 1<<sBreak | 1<<5
+	c.PC = c.pull16()
+}
+
 // RTS: Return from subroutine.
+// The pulled address is that of the last byte of the JSR, which is read
+// while incrementing past it.
 func (c *Cpu) RTS(in Instruction) {
-	c.PC = c.Bus.Read16(c.stackHead(1))
-	c.SP += 2
-	c.PC += 1
+	c.dummyStackRead()
+	c.PC = c.pull16()
+	c.dummyRead(c.PC)
+	c.PC++
 }
 
 // SBC: Subtract memory with borrow from accumulator.
 func (c *Cpu) SBC(in Instruction) {
-	valueSigned := int16(c.AC) - int16(c.resolveOperand(in))
-	if !c.getStatus(sCarry) {
-		valueSigned--
-	}
-	c.AC = uint8(valueSigned)
-
-	// v: Set if signed overflow; cleared if valid sign result.
-	// TODO: c.setStatus(sOverflow, something)
-
-	// c: Set if unsigned borrow not required; cleared if unsigned borrow.
-	c.setStatus(sCarry, valueSigned >= 0)
+	c.sbc(c.resolveOperand(in))
+}
 
-	// n: Set if most significant bit of result is set; else cleared.
-	// z: Set if result is zero; else cleared.
-	c.updateStatus(c.AC)
+// sbc subtracts value and borrow from the accumulator, in binary or decimal
+// mode. The 65C02 takes an extra cycle in decimal mode.
+func (c *Cpu) sbc(value uint8) {
+	if c.getStatus(sDecimal) {
+		if c.Variant.isCmos() {
+			c.penalty(c.lastAddress)
+		}
+		c.sbcDecimal(value)
+		return
+	}
+	// A - M - borrow is A + ^M + carry in two's complement, where carry is an
+	// inverted borrow; so carry is set if unsigned borrow was not required.
+	c.addBinary(^value)
 }
 
 // SEC: Set carry flag.
@@ -617,24 +1149,47 @@ func (c *Cpu) SEC(in Instruction) {
 	c.setStatus(sCarry, true)
 }
 
+// SED: Set decimal mode flag.
+func (c *Cpu) SED(in Instruction) {
+	c.setStatus(sDecimal, true)
+}
+
 // SEI: Set interrupt-disable flag.
 func (c *Cpu) SEI(in Instruction) {
-	c.setStatus(sInterrupt, false)
+	c.setStatus(sInterrupt, true)
+}
+
+// SMB: Set memory bit (Rockwell 65C02).
+func (c *Cpu) SMB(in Instruction) {
+	c.modify(c.writeAddress(in), func(value uint8) uint8 {
+		return value | 1<<in.bitNumber()
+	})
 }
 
 // STA: Store accumulator to memory.
 func (c *Cpu) STA(in Instruction) {
-	c.Bus.Write(c.memoryAddress(in), c.AC)
+	c.write(c.writeAddress(in), c.AC)
+}
+
+// STP: Stop the clock until reset (WDC 65C02).
+func (c *Cpu) STP(in Instruction) {
+	c.dummyRead(c.PC)
+	c.stopped = true
 }
 
 // STX: Store index register X to memory.
 func (c *Cpu) STX(in Instruction) {
-	c.Bus.Write(c.memoryAddress(in), c.X)
+	c.write(c.writeAddress(in), c.X)
 }
 
 // STY: Store index register Y to memory.
 func (c *Cpu) STY(in Instruction) {
-	c.Bus.Write(c.memoryAddress(in), c.Y)
+	c.write(c.writeAddress(in), c.Y)
+}
+
+// STZ: Store zero to memory (65C02).
+func (c *Cpu) STZ(in Instruction) {
+	c.write(c.writeAddress(in), 0)
 }
 
 // TAX: Transfer accumulator to index register X.
@@ -649,6 +1204,25 @@ func (c *Cpu) TAY(in Instruction) {
 	c.updateStatus(c.Y)
 }
 
+// TRB: Test and reset memory bits against accumulator (65C02).
+// Z is set as for BIT, then bits set in the accumulator are cleared in
+// memory.
+func (c *Cpu) TRB(in Instruction) {
+	c.modify(c.writeAddress(in), func(value uint8) uint8 {
+		c.setStatus(sZero, value&c.AC == 0)
+		return value &^ c.AC
+	})
+}
+
+// TSB: Test and set memory bits against accumulator (65C02).
+// Z is set as for BIT, then bits set in the accumulator are set in memory.
+func (c *Cpu) TSB(in Instruction) {
+	c.modify(c.writeAddress(in), func(value uint8) uint8 {
+		c.setStatus(sZero, value&c.AC == 0)
+		return value | c.AC
+	})
+}
+
 // TSX: Transfer stack pointer to index register X.
 func (c *Cpu) TSX(in Instruction) {
 	c.X = c.SP
@@ -662,9 +1236,9 @@ func (c *Cpu) TXA(in Instruction) {
 }
 
 // TXS: Transfer index register X to stack pointer.
+// Unlike the other transfers, TXS doesn't affect any flags.
 func (c *Cpu) TXS(in Instruction) {
 	c.SP = c.X
-	c.updateStatus(c.SP)
 }
 
 // TYA: Transfer index register Y to accumulator.
@@ -673,8 +1247,11 @@ func (c *Cpu) TYA(in Instruction) {
 	c.updateStatus(c.AC)
 }
 
-// _END: Custom go6502 instruction.
-// Exit, with contents of X register as exit status.
-func (c *Cpu) _END(in Instruction) {
-	c.ExitChan <- int(c.X)
+// WAI: Wait for interrupt (WDC 65C02).
+// Execution resumes when IRQ or NMI is asserted. If IRQ is disabled it
+// isn't taken, and execution simply continues after the WAI.
+func (c *Cpu) WAI(in Instruction) {
+	c.dummyRead(c.PC)
+	c.waiting = true
+	c.rdy.set(waiSource, true)
 }
@@ -8,15 +8,89 @@ import (
 	"github.com/pda/go6502/memory"
 )
 
+// programStart is where test programs are loaded and run from.
+const programStart = 0x0200
+
 func createCpu() *Cpu {
-	ram := &memory.Ram{}
 	addressBus, _ := bus.CreateBus()
-	addressBus.Attach(ram, "ram", 0x8000) // upper 32K
+	addressBus.Attach(&memory.Ram{}, "ram", 0x0000) // lower 32K
+	addressBus.Attach(&memory.Ram{}, "ram", 0x8000) // upper 32K
 	cpu := &Cpu{Bus: addressBus}
 	cpu.Reset()
 	return cpu
 }
 
+// registers is a snapshot of the CPU registers for comparison in tests.
+type registers struct {
+	PC uint16
+	AC byte
+	X  byte
+	Y  byte
+	SP byte
+	SR byte
+}
+
+func (r registers) String() string {
+	return fmt.Sprintf("PC:$%04X AC:$%02X X:$%02X Y:$%02X SP:$%02X SR:$%02X",
+		r.PC, r.AC, r.X, r.Y, r.SP, r.SR)
+}
+
+func registersOf(c *Cpu) registers {
+	return registers{PC: c.PC, AC: c.AC, X: c.X, Y: c.Y, SP: c.SP, SR: c.SR}
+}
+
+func (r registers) load(c *Cpu) {
+	c.PC, c.AC, c.X, c.Y, c.SP, c.SR = r.PC, r.AC, r.X, r.Y, r.SP, r.SR
+}
+
+// instructionTest describes a program run for a number of steps from
+// programStart, with the register and memory state expected afterwards.
+type instructionTest struct {
+	name    string
+	variant Variant
+	program []byte
+	steps   int // defaults to 1
+	before  registers
+	memory  map[uint16]byte
+	after   registers
+	expect  map[uint16]byte
+}
+
+func runInstructionTests(t *testing.T, tests []instructionTest) {
+	for _, test := range tests {
+		c := createCpu()
+		c.Variant = test.variant
+		before := test.before
+		before.PC = programStart
+		before.load(c)
+		for a, v := range test.memory {
+			c.Bus.Write(a, v)
+		}
+		for i, b := range test.program {
+			c.Bus.Write(programStart+uint16(i), b)
+		}
+
+		steps := test.steps
+		if steps == 0 {
+			steps = 1
+		}
+		for i := 0; i < steps; i++ {
+			if err := c.Step(); err != nil {
+				t.Fatalf("%s: step %d: %v", test.name, i, err)
+			}
+		}
+
+		if actual := registersOf(c); actual != test.after {
+			t.Errorf("%s:\nexpected %v\n     got %v", test.name, test.after, actual)
+		}
+		for a, expected := range test.expect {
+			if actual := c.Bus.Read(a); actual != expected {
+				t.Errorf("%s: $%04X expected $%02X got $%02X", test.name, a, expected, actual)
+			}
+		}
+	}
+}
+
 func TestBitInstruction(t *testing.T) {
 	cpu := createCpu()
 	cpu.Bus.Write(0x8000, 0xAA)
@@ -36,3 +110,261 @@ func TestBitInstruction(t *testing.T) {
 		t.Error(fmt.Sprintf("SR expected %s got %s\n", expectedStatus, actualStatus))
 	}
 }
+
+// TestEveryOpcodeExecutes runs each decoded opcode of every variant once,
+// ensuring execute() handles all of them.
+func TestEveryOpcodeExecutes(t *testing.T) {
+	for _, variant := range []Variant{NMOS6502, NMOS6502X, CMOS65C02, Rockwell65C02, WDC65C02} {
+		for _, ot := range variant.optypes() {
+			if ot.Bytes == 0 {
+				continue
+			}
+			opcode := ot.Opcode
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("%v $%02X %v: %v", variant, opcode, ot, r)
+					}
+				}()
+				c := createCpu()
+				c.Variant = variant
+				c.PC = programStart
+				c.SP = 0xFF
+				c.Bus.Write(programStart, opcode)
+				if err := c.Step(); err != nil {
+					t.Fatalf("%v $%02X %v: %v", variant, opcode, ot, err)
+				}
+			}()
+		}
+	}
+}
+
+func TestFlagInstructions(t *testing.T) {
+	runInstructionTests(t, []instructionTest{
+		{
+			name:    "CLC",
+			program: []byte{0x18},
+			before:  registers{SR: 0xFF},
+			after:   registers{PC: 0x0201, SR: 0xFE},
+		},
+		{
+			name:    "SEC",
+			program: []byte{0x38},
+			before:  registers{SR: 0x30},
+			after:   registers{PC: 0x0201, SR: 0x31},
+		},
+		{
+			name:    "CLI",
+			program: []byte{0x58},
+			before:  registers{SR: 0x34},
+			after:   registers{PC: 0x0201, SR: 0x30},
+		},
+		{
+			name:    "SEI",
+			program: []byte{0x78},
+			before:  registers{SR: 0x30},
+			after:   registers{PC: 0x0201, SR: 0x34},
+		},
+		{
+			name:    "CLD",
+			program: []byte{0xD8},
+			before:  registers{SR: 0x38},
+			after:   registers{PC: 0x0201, SR: 0x30},
+		},
+		{
+			name:    "SED",
+			program: []byte{0xF8},
+			before:  registers{SR: 0x30},
+			after:   registers{PC: 0x0201, SR: 0x38},
+		},
+		{
+			name:    "CLV",
+			program: []byte{0xB8},
+			before:  registers{SR: 0xF0},
+			after:   registers{PC: 0x0201, SR: 0xB0},
+		},
+	})
+}
+
+func TestBranchInstructions(t *testing.T) {
+	runInstructionTests(t, []instructionTest{
+		{
+			name:    "BVC taken",
+			program: []byte{0x50, 0x10},
+			before:  registers{SR: 0x30},
+			after:   registers{PC: 0x0212, SR: 0x30},
+		},
+		{
+			name:    "BVC not taken",
+			program: []byte{0x50, 0x10},
+			before:  registers{SR: 0x70},
+			after:   registers{PC: 0x0202, SR: 0x70},
+		},
+		{
+			name:    "BVS taken backwards",
+			program: []byte{0x70, 0xFC},
+			before:  registers{SR: 0x70},
+			after:   registers{PC: 0x01FE, SR: 0x70},
+		},
+		{
+			name:    "BVS taken by -128",
+			program: []byte{0x70, 0x80},
+			before:  registers{SR: 0x70},
+			after:   registers{PC: 0x0182, SR: 0x70},
+		},
+		{
+			name:    "BVS not taken",
+			program: []byte{0x70, 0xFC},
+			before:  registers{SR: 0x30},
+			after:   registers{PC: 0x0202, SR: 0x30},
+		},
+	})
+}
+
+func TestStackInstructions(t *testing.T) {
+	runInstructionTests(t, []instructionTest{
+		{
+			name:    "PHA",
+			program: []byte{0x48},
+			before:  registers{AC: 0x42, SP: 0xFF, SR: 0x30},
+			after:   registers{PC: 0x0201, AC: 0x42, SP: 0xFE, SR: 0x30},
+			expect:  map[uint16]byte{0x01FF: 0x42},
+		},
+		{
+			name:    "PLA sets N, clears Z",
+			program: []byte{0x68},
+			before:  registers{SP: 0xFE, SR: 0x32},
+			memory:  map[uint16]byte{0x01FF: 0x80},
+			after:   registers{PC: 0x0201, AC: 0x80, SP: 0xFF, SR: 0xB0},
+		},
+		{
+			name:    "PLA sets Z",
+			program: []byte{0x68},
+			before:  registers{AC: 0x12, SP: 0xFE, SR: 0x30},
+			memory:  map[uint16]byte{0x01FF: 0x00},
+			after:   registers{PC: 0x0201, AC: 0x00, SP: 0xFF, SR: 0x32},
+		},
+		{
+			name:    "PHP pushes B and bit 5",
+			program: []byte{0x08},
+			before:  registers{SP: 0xFF, SR: 0xC3},
+			after:   registers{PC: 0x0201, SP: 0xFE, SR: 0xC3},
+			expect:  map[uint16]byte{0x01FF: 0xF3},
+		},
+		{
+			name:    "PLP",
+			program: []byte{0x28},
+			before:  registers{SP: 0xFE, SR: 0x30},
+			memory:  map[uint16]byte{0x01FF: 0xCF},
+			after:   registers{PC: 0x0201, SP: 0xFF, SR: 0xFF},
+		},
+		{
+			name:    "PLP ignores B and bit 5",
+			program: []byte{0x28},
+			before:  registers{SP: 0xFE, SR: 0xFF},
+			memory:  map[uint16]byte{0x01FF: 0x00},
+			after:   registers{PC: 0x0201, SP: 0xFF, SR: 0x30},
+		},
+		{
+			name:    "PHA wraps stack pointer",
+			program: []byte{0x48},
+			before:  registers{AC: 0x99, SP: 0x00, SR: 0x30},
+			after:   registers{PC: 0x0201, AC: 0x99, SP: 0xFF, SR: 0x30},
+			expect:  map[uint16]byte{0x0100: 0x99},
+		},
+		{
+			name:    "PLA wraps stack pointer",
+			program: []byte{0x68},
+			before:  registers{SP: 0xFF, SR: 0x30},
+			memory:  map[uint16]byte{0x0100: 0x01},
+			after:   registers{PC: 0x0201, AC: 0x01, SP: 0x00, SR: 0x30},
+		},
+		{
+			name:    "TXS doesn't affect flags",
+			program: []byte{0x9A},
+			before:  registers{X: 0x80, SP: 0xFF, SR: 0x32},
+			after:   registers{PC: 0x0201, X: 0x80, SP: 0x80, SR: 0x32},
+		},
+		{
+			name:    "TSX sets N",
+			program: []byte{0xBA},
+			before:  registers{SP: 0xF0, SR: 0x30},
+			after:   registers{PC: 0x0201, X: 0xF0, SP: 0xF0, SR: 0xB0},
+		},
+	})
+}
+
+func TestSubroutineInstructions(t *testing.T) {
+	runInstructionTests(t, []instructionTest{
+		{
+			name:    "JSR",
+			program: []byte{0x20, 0x34, 0x12},
+			before:  registers{SP: 0xFF, SR: 0x30},
+			after:   registers{PC: 0x1234, SP: 0xFD, SR: 0x30},
+			expect:  map[uint16]byte{0x01FF: 0x02, 0x01FE: 0x02},
+		},
+		{
+			name:    "JSR then RTS",
+			program: []byte{0x20, 0x00, 0x03},
+			steps:   2,
+			before:  registers{SP: 0xFF, SR: 0x30},
+			memory:  map[uint16]byte{0x0300: 0x60},
+			after:   registers{PC: 0x0203, SP: 0xFF, SR: 0x30},
+		},
+		{
+			name:    "RTI",
+			program: []byte{0x40},
+			before:  registers{SP: 0xFC, SR: 0x34},
+			memory:  map[uint16]byte{0x01FD: 0xC3, 0x01FE: 0x34, 0x01FF: 0x12},
+			after:   registers{PC: 0x1234, SP: 0xFF, SR: 0xF3},
+		},
+		{
+			name:    "JMP indirect",
+			program: []byte{0x6C, 0x00, 0x03},
+			before:  registers{SR: 0x30},
+			memory:  map[uint16]byte{0x0300: 0xCD, 0x0301: 0xAB},
+			after:   registers{PC: 0xABCD, SR: 0x30},
+		},
+		{
+			name:    "JMP indirect doesn't cross page",
+			program: []byte{0x6C, 0xFF, 0x03},
+			before:  registers{SR: 0x30},
+			memory:  map[uint16]byte{0x03FF: 0xCD, 0x0400: 0xAB, 0x0300: 0x56},
+			after:   registers{PC: 0x56CD, SR: 0x30},
+		},
+	})
+}
+
+func TestAddressingModes(t *testing.T) {
+	runInstructionTests(t, []instructionTest{
+		{
+			name:    "LDA (zp,X) wraps in zero page",
+			program: []byte{0xA1, 0xFE},
+			before:  registers{X: 0x01, SR: 0x30},
+			memory:  map[uint16]byte{0x00FF: 0x00, 0x0000: 0x04, 0x0400: 0x7F},
+			after:   registers{PC: 0x0202, AC: 0x7F, X: 0x01, SR: 0x30},
+		},
+		{
+			name:    "LDA (zp),Y wraps in zero page",
+			program: []byte{0xB1, 0xFF},
+			before:  registers{Y: 0x02, SR: 0x30},
+			memory:  map[uint16]byte{0x00FF: 0x10, 0x0000: 0x04, 0x0412: 0x80},
+			after:   registers{PC: 0x0202, AC: 0x80, Y: 0x02, SR: 0xB0},
+		},
+		{
+			name:    "LDA zp,X wraps in zero page",
+			program: []byte{0xB5, 0xF0},
+			before:  registers{X: 0x20, SR: 0x30},
+			memory:  map[uint16]byte{0x0010: 0x01},
+			after:   registers{PC: 0x0202, AC: 0x01, X: 0x20, SR: 0x30},
+		},
+		{
+			name:    "DEC absolute",
+			program: []byte{0xCE, 0x00, 0x03},
+			before:  registers{SR: 0x30},
+			memory:  map[uint16]byte{0x0300: 0x01},
+			after:   registers{PC: 0x0203, SR: 0x32},
+			expect:  map[uint16]byte{0x0300: 0x00},
+		},
+	})
+}
@@ -0,0 +1,185 @@
+package cpu
+
+// The cycle-stepped core, enabled by Cpu.CycleAccurate.
+//
+// The processor accesses the bus on every clock cycle. Cycles which have no
+// useful access to make still put an address on the bus and read it, and
+// read-modify-write instructions write memory twice; those accesses have
+// side effects on I/O, e.g. acknowledging an interrupt by reading a
+// register. The cycle-stepped core makes every access the processor does, in
+// order, counting one cycle for each.
+//
+// The NMOS 6502 makes its dummy accesses to whatever address its logic
+// happens to hold; an unfixed page when indexing, the zero-page base address
+// before adding X, and an unmodified write-back during read-modify-write.
+// The 65C02 instead repeats its previous read, so dummy cycles don't reach
+// new I/O addresses.
+//
+// References:
+// "64doc", John West and Marko Mäkelä, for the NMOS 6502.
+// W65C02S datasheet, Western Design Center, table 5-7.
+
+// A BusCycle is the bus access made in a single clock cycle.
+type BusCycle struct {
+	Address uint16
+	Data    byte
+	Write   bool
+}
+
+// A CycleObserver is told of each bus cycle made by the cycle-stepped core,
+// as it happens. Devices may use it to keep time with the processor.
+type CycleObserver interface {
+	Cycle(BusCycle)
+}
+
+// AttachCycleObserver sets the given CycleObserver to observe bus cycles
+// when Cpu.CycleAccurate is set.
+func (c *Cpu) AttachCycleObserver(o CycleObserver) {
+	c.cycleObserver = o
+}
+
+// read reads a byte from the bus, taking a cycle in the cycle-stepped core.
+func (c *Cpu) read(address uint16) byte {
+	value := c.busRead(address)
+	if c.tracing {
+		c.effects.Accesses = append(c.effects.Accesses, BusCycle{Address: address, Data: value})
+	}
+	return value
+}
+
+// write writes a byte to the bus, taking a cycle in the cycle-stepped core.
+func (c *Cpu) write(address uint16, value byte) {
+	c.busWrite(address, value)
+	if c.tracing {
+		c.effects.Accesses = append(c.effects.Accesses, BusCycle{Address: address, Data: value, Write: true})
+	}
+}
+
+// busRead is read, without recording the access in the instruction's
+// effects, for dummy accesses.
+func (c *Cpu) busRead(address uint16) byte {
+	value := c.Bus.Read(address)
+	c.lastAddress = address
+	if c.CycleAccurate {
+		c.Cycles++
+		if c.cycleObserver != nil {
+			c.cycleObserver.Cycle(BusCycle{Address: address, Data: value})
+		}
+	}
+	return value
+}
+
+// busWrite is busRead's write counterpart.
+func (c *Cpu) busWrite(address uint16, value byte) {
+	c.Bus.Write(address, value)
+	c.lastAddress = address
+	if c.CycleAccurate {
+		c.Cycles++
+		if c.cycleObserver != nil {
+			c.cycleObserver.Cycle(BusCycle{Address: address, Data: value, Write: true})
+		}
+	}
+}
+
+// read16 reads a little-endian 16-bit value, low byte first.
+func (c *Cpu) read16(address uint16) uint16 {
+	lo := uint16(c.read(address))
+	hi := uint16(c.read(address + 1))
+	return hi<<8 | lo
+}
+
+// dummyRead makes a read whose value is discarded, on a cycle counted in the
+// instruction's base cycles. Only the cycle-stepped core makes it.
+func (c *Cpu) dummyRead(address uint16) {
+	if c.CycleAccurate {
+		c.busRead(address)
+	}
+}
+
+// dummyWrite is the write counterpart of dummyRead.
+func (c *Cpu) dummyWrite(address uint16, value byte) {
+	if c.CycleAccurate {
+		c.busWrite(address, value)
+	}
+}
+
+// penalty spends a cycle beyond the instruction's base cycles, e.g. for a
+// taken branch. The cycle-stepped core makes a dummy read of address.
+func (c *Cpu) penalty(address uint16) {
+	if c.CycleAccurate {
+		c.busRead(address)
+	} else {
+		c.Cycles++
+	}
+}
+
+// tick counts cycles for the fast core. The cycle-stepped core counts its
+// bus accesses instead.
+func (c *Cpu) tick(cycles uint8) {
+	if !c.CycleAccurate {
+		c.Cycles += uint64(cycles)
+	}
+}
+
+// idleAddress returns the address read on a dummy cycle: the given address
+// held by the NMOS 6502's logic, or the 65C02's previous read.
+func (c *Cpu) idleAddress(nmos uint16) uint16 {
+	if c.Variant.isCmos() {
+		return c.lastAddress
+	}
+	return nmos
+}
+
+// dummyStackRead reads the head of the stack without pulling it, as the
+// processor does while incrementing the stack pointer before a pull.
+func (c *Cpu) dummyStackRead() {
+	c.dummyRead(StackBase + uint16(c.SP))
+}
+
+// fetch reads the instruction at pc a byte per cycle, returning it and the
+// address following the bytes read. JSR, BBR and BBS read their last operand
+// byte during execution; it's peeked here if a monitor needs to see it and
+// it's in inert memory, so peeking it has no effect.
+// Illegal opcodes are returned as for ReadInstruction.
+func (c *Cpu) fetch(pc uint16) (Instruction, uint16, error) {
+	optype, err := c.Variant.opType(c.read(pc), pc)
+	in := Instruction{OpType: optype}
+	pc++
+	switch {
+	case in.Bytes == 1:
+		if in.Cycles > 1 {
+			c.dummyRead(pc)
+		}
+	case in.Bytes == 2:
+		in.Op8 = c.read(pc)
+		pc++
+	case in.id == jsr || in.addressing == zeropageRelative:
+		in.Op16 = uint16(c.read(pc))
+		pc++
+		if len(c.monitors) > 0 {
+			if hi, ok := c.Bus.Peek(pc); ok {
+				in.Op16 |= uint16(hi) << 8
+			}
+		}
+	default:
+		in.Op16 = c.read16(pc)
+		pc += 2
+	}
+	return in, pc, err
+}
+
+// modify reads, modifies and writes back a memory operand, for instructions
+// like INC and ASL; f is given the value read and returns the value to write.
+// The NMOS 6502 writes the unmodified value back while modifying it; the
+// 65C02 reads it again instead.
+func (c *Cpu) modify(address uint16, f func(uint8) uint8) uint8 {
+	value := c.read(address)
+	if c.Variant.isCmos() {
+		c.dummyRead(address)
+	} else {
+		c.dummyWrite(address, value)
+	}
+	value = f(value)
+	c.write(address, value)
+	return value
+}
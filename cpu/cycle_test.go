@@ -0,0 +1,339 @@
+package cpu
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pda/go6502/bus"
+	"github.com/pda/go6502/memory"
+)
+
+// busLog is a CycleObserver which records every bus cycle.
+type busLog []BusCycle
+
+func (l *busLog) Cycle(bc BusCycle) {
+	*l = append(*l, bc)
+}
+
+func r(address uint16, data byte) BusCycle {
+	return BusCycle{Address: address, Data: data}
+}
+
+func w(address uint16, data byte) BusCycle {
+	return BusCycle{Address: address, Data: data, Write: true}
+}
+
+func TestBusCycles(t *testing.T) {
+	tests := []struct {
+		name    string
+		variant Variant
+		program []byte
+		before  registers
+		memory  map[uint16]byte
+		expect  []BusCycle
+	}{
+		{
+			name:    "INC abs",
+			program: []byte{0xEE, 0x00, 0x03},
+			memory:  map[uint16]byte{0x0300: 0x41},
+			expect: []BusCycle{
+				r(0x0200, 0xEE), r(0x0201, 0x00), r(0x0202, 0x03),
+				r(0x0300, 0x41), w(0x0300, 0x41), w(0x0300, 0x42),
+			},
+		},
+		{
+			name:    "INC abs",
+			variant: CMOS65C02,
+			program: []byte{0xEE, 0x00, 0x03},
+			memory:  map[uint16]byte{0x0300: 0x41},
+			expect: []BusCycle{
+				r(0x0200, 0xEE), r(0x0201, 0x00), r(0x0202, 0x03),
+				r(0x0300, 0x41), r(0x0300, 0x41), w(0x0300, 0x42),
+			},
+		},
+		{
+			name:    "LDA abs,X page crossed",
+			program: []byte{0xBD, 0xF0, 0x03},
+			before:  registers{X: 0x20},
+			memory:  map[uint16]byte{0x0310: 0x11, 0x0410: 0x22},
+			expect: []BusCycle{
+				r(0x0200, 0xBD), r(0x0201, 0xF0), r(0x0202, 0x03),
+				r(0x0310, 0x11), r(0x0410, 0x22),
+			},
+		},
+		{
+			name:    "LDA abs,X page crossed",
+			variant: CMOS65C02,
+			program: []byte{0xBD, 0xF0, 0x03},
+			before:  registers{X: 0x20},
+			memory:  map[uint16]byte{0x0310: 0x11, 0x0410: 0x22},
+			expect: []BusCycle{
+				r(0x0200, 0xBD), r(0x0201, 0xF0), r(0x0202, 0x03),
+				r(0x0202, 0x03), r(0x0410, 0x22),
+			},
+		},
+		{
+			name:    "STA abs,X",
+			program: []byte{0x9D, 0x00, 0x03},
+			before:  registers{AC: 0x55, X: 0x01},
+			expect: []BusCycle{
+				r(0x0200, 0x9D), r(0x0201, 0x00), r(0x0202, 0x03),
+				r(0x0301, 0x00), w(0x0301, 0x55),
+			},
+		},
+		{
+			name:    "ASL abs,X",
+			variant: CMOS65C02,
+			program: []byte{0x1E, 0x00, 0x03},
+			before:  registers{X: 0x01},
+			memory:  map[uint16]byte{0x0301: 0x81},
+			expect: []BusCycle{
+				r(0x0200, 0x1E), r(0x0201, 0x00), r(0x0202, 0x03),
+				r(0x0301, 0x81), r(0x0301, 0x81), w(0x0301, 0x02),
+			},
+		},
+		{
+			name:    "LDA zp,X",
+			program: []byte{0xB5, 0x10},
+			before:  registers{X: 0x01},
+			memory:  map[uint16]byte{0x0010: 0x11, 0x0011: 0x22},
+			expect: []BusCycle{
+				r(0x0200, 0xB5), r(0x0201, 0x10), r(0x0010, 0x11), r(0x0011, 0x22),
+			},
+		},
+		{
+			name:    "LDA (zp),Y page crossed",
+			program: []byte{0xB1, 0x10},
+			before:  registers{Y: 0x20},
+			memory:  map[uint16]byte{0x0010: 0xF0, 0x0011: 0x03, 0x0410: 0x22},
+			expect: []BusCycle{
+				r(0x0200, 0xB1), r(0x0201, 0x10), r(0x0010, 0xF0), r(0x0011, 0x03),
+				r(0x0310, 0x00), r(0x0410, 0x22),
+			},
+		},
+		{
+			name:    "PHA",
+			program: []byte{0x48},
+			before:  registers{AC: 0x55, SP: 0xFF},
+			expect: []BusCycle{
+				r(0x0200, 0x48), r(0x0201, 0x00), w(0x01FF, 0x55),
+			},
+		},
+		{
+			name:    "PLA",
+			program: []byte{0x68},
+			before:  registers{SP: 0xFE},
+			memory:  map[uint16]byte{0x01FF: 0x55},
+			expect: []BusCycle{
+				r(0x0200, 0x68), r(0x0201, 0x00), r(0x01FE, 0x00), r(0x01FF, 0x55),
+			},
+		},
+		{
+			name:    "JSR",
+			program: []byte{0x20, 0x00, 0x03},
+			before:  registers{SP: 0xFF},
+			expect: []BusCycle{
+				r(0x0200, 0x20), r(0x0201, 0x00), r(0x01FF, 0x00),
+				w(0x01FF, 0x02), w(0x01FE, 0x02), r(0x0202, 0x03),
+			},
+		},
+		{
+			name:    "RTS",
+			program: []byte{0x60},
+			before:  registers{SP: 0xFD},
+			memory:  map[uint16]byte{0x01FE: 0x02, 0x01FF: 0x03},
+			expect: []BusCycle{
+				r(0x0200, 0x60), r(0x0201, 0x00), r(0x01FD, 0x00),
+				r(0x01FE, 0x02), r(0x01FF, 0x03), r(0x0302, 0x00),
+			},
+		},
+		{
+			name:    "BRK",
+			program: []byte{0x00},
+			before:  registers{SP: 0xFF, SR: 0x30},
+			memory:  map[uint16]byte{0xFFFE: 0x00, 0xFFFF: 0x03},
+			expect: []BusCycle{
+				r(0x0200, 0x00), r(0x0201, 0x00),
+				w(0x01FF, 0x02), w(0x01FE, 0x02), w(0x01FD, 0x30),
+				r(0xFFFE, 0x00), r(0xFFFF, 0x03),
+			},
+		},
+		{
+			name:    "BNE taken page crossed",
+			program: []byte{0xD0, 0xF0},
+			before:  registers{SR: 0x30},
+			expect: []BusCycle{
+				r(0x0200, 0xD0), r(0x0201, 0xF0), r(0x0202, 0x00), r(0x02F2, 0x00),
+			},
+		},
+		{
+			name:    "BBS0 taken",
+			variant: Rockwell65C02,
+			program: []byte{0x8F, 0x10, 0x04},
+			memory:  map[uint16]byte{0x0010: 0x01},
+			expect: []BusCycle{
+				r(0x0200, 0x8F), r(0x0201, 0x10), r(0x0010, 0x01), r(0x0010, 0x01),
+				r(0x0202, 0x04), r(0x0203, 0x00),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		c := createCpu()
+		c.Variant = test.variant
+		c.CycleAccurate = true
+		var log busLog
+		c.AttachCycleObserver(&log)
+		test.before.PC = programStart
+		test.before.load(c)
+		for i, b := range test.program {
+			c.Bus.Write(programStart+uint16(i), b)
+		}
+		for address, value := range test.memory {
+			c.Bus.Write(address, value)
+		}
+		start := c.Cycles
+		c.Step()
+		if !reflect.DeepEqual([]BusCycle(log), test.expect) {
+			t.Errorf("%v %s:\nexpected %v\n     got %v", test.variant, test.name, test.expect, log)
+		}
+		if cycles := c.Cycles - start; cycles != uint64(len(log)) {
+			t.Errorf("%v %s: %d bus cycles counted as %d", test.variant, test.name, len(log), cycles)
+		}
+	}
+}
+
+func TestInterruptBusCycles(t *testing.T) {
+	c := createInterruptCpu()
+	c.CycleAccurate = true
+	c.SR = 0x30
+	var log busLog
+	c.AttachCycleObserver(&log)
+	c.SetIRQ("test", true)
+	c.Step()
+	expect := []BusCycle{
+		r(0x0200, 0xEA), r(0x0200, 0xEA),
+		w(0x01FF, 0x02), w(0x01FE, 0x00), w(0x01FD, 0x20),
+		r(0xFFFE, 0x00), r(0xFFFF, 0x03),
+		r(0x0300, 0xEA), r(0x0301, 0x00),
+	}
+	if !reflect.DeepEqual([]BusCycle(log), expect) {
+		t.Errorf("expected %v\n     got %v", expect, log)
+	}
+}
+
+// TestJSROnStackPage runs a JSR whose push overwrites its own high operand
+// byte, which the processor reads after pushing, with a monitor attached so
+// that fetch peeks the byte first.
+func TestJSROnStackPage(t *testing.T) {
+	for _, accurate := range []bool{false, true} {
+		c := createCpu()
+		c.CycleAccurate = accurate
+		c.AttachMonitor(&faultLog{})
+		c.PC = 0x01FB
+		c.SP = 0xFD
+		for i, b := range []byte{0x20, 0x34, 0x12} { // JSR $1234
+			c.Bus.Write(c.PC+uint16(i), b)
+		}
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+		// The fast core reads the operand before pushing, unlike the
+		// processor; the cycle-accurate core reads the pushed PCH, $01.
+		expected := uint16(0x1234)
+		if accurate {
+			expected = 0x0134
+		}
+		if c.PC != expected {
+			t.Errorf("accurate=%v: expected PC $%04X, got $%04X", accurate, expected, c.PC)
+		}
+	}
+}
+
+// TestJSRReadsOperandOnce runs a JSR whose high operand byte is in I/O
+// memory, with a monitor attached, expecting fetch not to peek it.
+func TestJSRReadsOperandOnce(t *testing.T) {
+	b, _ := bus.CreateBus()
+	b.Attach(&memory.Ram{}, "ram", 0x0000)
+	b.Attach(&memory.Ram{}, "ram", 0x8000)
+	io := &counter{}
+	b.AttachOverlay(io, "counter", 0xFF00)
+	c := &Cpu{Bus: b, CycleAccurate: true}
+	c.AttachMonitor(&faultLog{})
+	c.PC = 0xFEFE
+	c.SP = 0xFF
+	b.Write(0xFEFE, 0x20) // JSR $xx34, its high byte read from $FF00.
+	b.Write(0xFEFF, 0x34)
+	var reads int
+	b.ObserveReads(func(a uint16, v byte) {
+		if a == 0xFF00 {
+			reads++
+		}
+	})
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if reads != 1 || io.reads != 1 {
+		t.Errorf("expected one read of $FF00, got %d observed, %d made", reads, io.reads)
+	}
+	if c.PC != 0x0134 {
+		t.Errorf("expected PC $0134, got $%04X", c.PC)
+	}
+}
+
+// TestCycleAccurateMatchesFast runs every opcode on both cores, expecting
+// the same registers, memory and cycle count from each.
+func TestCycleAccurateMatchesFast(t *testing.T) {
+	setups := []registers{
+		{SP: 0xF0, SR: 0x30, X: 0x01, Y: 0x01},
+		{SP: 0xF0, SR: 0xFF, X: 0xFE, Y: 0xFE, AC: 0x99},
+		{SP: 0xF0, SR: 0xC3, X: 0x80, Y: 0x7F, AC: 0x40},
+	}
+	// Operands and zero-page pointers address pages 3 and 4, which are
+	// compared along with zero page and the stack.
+	prepare := func(variant Variant, opcode uint8, before registers, accurate bool) *Cpu {
+		c := createCpu()
+		c.Variant = variant
+		c.CycleAccurate = accurate
+		before.PC = programStart
+		before.load(c)
+		for a := uint16(0); a < 0x0100; a++ {
+			c.Bus.Write(a, 0x03)
+			c.Bus.Write(0x0300+a, uint8(a))
+			c.Bus.Write(0x0400+a, uint8(a)^0xFF)
+		}
+		c.Bus.Write(programStart, opcode)
+		c.Bus.Write(programStart+1, 0x10)
+		c.Bus.Write(programStart+2, 0x03)
+		return c
+	}
+
+	for _, variant := range []Variant{NMOS6502, NMOS6502X, CMOS65C02, Rockwell65C02, WDC65C02} {
+		for _, ot := range variant.optypes() {
+			if ot.Bytes == 0 {
+				continue
+			}
+			opcode := ot.Opcode
+			for _, before := range setups {
+				fast := prepare(variant, opcode, before, false)
+				accurate := prepare(variant, opcode, before, true)
+				fastStart, accurateStart := fast.Cycles, accurate.Cycles
+				fast.Step()
+				accurate.Step()
+
+				if f, a := registersOf(fast), registersOf(accurate); f != a {
+					t.Errorf("%v %v with %+v: fast %+v, accurate %+v", variant, ot, before, f, a)
+				}
+				if f, a := fast.Cycles-fastStart, accurate.Cycles-accurateStart; f != a {
+					t.Errorf("%v %v with %+v: fast %d cycles, accurate %d", variant, ot, before, f, a)
+				}
+				for a := uint16(0); a < 0x0500; a++ {
+					if fast.Bus.Read(a) != accurate.Bus.Read(a) {
+						t.Errorf("%v %v with %+v: memory differs", variant, ot, before)
+						break
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package cpu
+
+import "testing"
+
+func TestCycles(t *testing.T) {
+	tests := []struct {
+		name    string
+		variant Variant
+		program []byte
+		before  registers
+		cycles  uint64
+	}{
+		{"LDA abs,X", NMOS6502, []byte{0xBD, 0x00, 0x03}, registers{X: 0xFF}, 4},
+		{"LDA abs,X page crossed", NMOS6502, []byte{0xBD, 0x01, 0x03}, registers{X: 0xFF}, 5},
+		{"LDA abs,Y page crossed", NMOS6502, []byte{0xB9, 0x80, 0x03}, registers{Y: 0x80}, 5},
+		{"LDA (zp),Y page crossed", NMOS6502, []byte{0xB1, 0x10}, registers{Y: 0x01}, 6},
+		{"LDA zp,X wrapping", NMOS6502, []byte{0xB5, 0xFF}, registers{X: 0x01}, 4},
+		{"STA abs,X page crossed", NMOS6502, []byte{0x9D, 0x01, 0x03}, registers{X: 0xFF}, 5},
+		{"ASL abs,X", NMOS6502, []byte{0x1E, 0x00, 0x03}, registers{}, 7},
+		{"DEC abs", NMOS6502, []byte{0xCE, 0x00, 0x03}, registers{}, 6},
+		{"BNE not taken", NMOS6502, []byte{0xD0, 0x10}, registers{SR: 0x32}, 2},
+		{"BNE taken", NMOS6502, []byte{0xD0, 0x10}, registers{SR: 0x30}, 3},
+		{"BNE taken page crossed", NMOS6502, []byte{0xD0, 0x80}, registers{SR: 0x30}, 4},
+		{"BRK", NMOS6502, []byte{0x00}, registers{}, 7},
+		{"JMP indirect", NMOS6502, []byte{0x6C, 0x00, 0x03}, registers{}, 5},
+		{"ADC decimal", NMOS6502, []byte{0x69, 0x01}, registers{SR: 0x38}, 2},
+		{"LAX abs,Y page crossed", NMOS6502X, []byte{0xBF, 0xFF, 0x03}, registers{Y: 0x01}, 5},
+		{"NOP abs,X page crossed", NMOS6502X, []byte{0x1C, 0xFF, 0x03}, registers{X: 0x01}, 5},
+		{"ISC abs,X page crossed", NMOS6502X, []byte{0xFF, 0xFF, 0x03}, registers{X: 0x01}, 7},
+		{"JMP indirect", CMOS65C02, []byte{0x6C, 0x00, 0x03}, registers{}, 6},
+		{"ADC decimal", CMOS65C02, []byte{0x69, 0x01}, registers{SR: 0x38}, 3},
+		{"SBC decimal", CMOS65C02, []byte{0xE9, 0x01}, registers{SR: 0x38}, 3},
+		{"ASL abs,X", CMOS65C02, []byte{0x1E, 0x00, 0x03}, registers{X: 0x01}, 6},
+		{"ASL abs,X page crossed", CMOS65C02, []byte{0x1E, 0xFF, 0x03}, registers{X: 0x01}, 7},
+		{"INC abs,X", CMOS65C02, []byte{0xFE, 0x00, 0x03}, registers{X: 0x01}, 7},
+		{"BRA", CMOS65C02, []byte{0x80, 0x10}, registers{}, 3},
+		{"BRA page crossed", CMOS65C02, []byte{0x80, 0x80}, registers{}, 4},
+		{"LDA (zp)", CMOS65C02, []byte{0xB2, 0x10}, registers{}, 5},
+		{"BBR not taken", Rockwell65C02, []byte{0x0F, 0x10, 0x10}, registers{}, 5},
+	}
+
+	for _, test := range tests {
+		c := createCpu()
+		c.Variant = test.variant
+		test.before.PC = programStart
+		test.before.load(c)
+		c.Bus.Write16(0x0010, 0x03FF) // zero-page pointer for (zp) modes.
+		for i, b := range test.program {
+			c.Bus.Write(programStart+uint16(i), b)
+		}
+		start := c.Cycles
+		c.Step()
+		if cycles := c.Cycles - start; cycles != test.cycles {
+			t.Errorf("%v %s: expected %d cycles, got %d", test.variant, test.name, test.cycles, cycles)
+		}
+	}
+}
+
+func TestInterruptCycles(t *testing.T) {
+	c := createInterruptCpu()
+	c.SR = 0x30
+	c.SetIRQ("test", true)
+	start := c.Cycles
+	c.Step()
+	// seven for interrupt entry, two for the handler's NOP.
+	if cycles := c.Cycles - start; cycles != 9 {
+		t.Errorf("expected 9 cycles, got %d", cycles)
+	}
+}
+
+func TestResetCycles(t *testing.T) {
+	c := createCpu()
+	start := c.Cycles
+	c.Reset()
+	if cycles := c.Cycles - start; cycles != 7 {
+		t.Errorf("expected reset to take 7 cycles, got %d", cycles)
+	}
+}
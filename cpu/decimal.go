@@ -0,0 +1,81 @@
+package cpu
+
+// Decimal mode arithmetic, used by ADC and SBC when the D flag is set.
+//
+// Operands are treated as packed BCD; two decimal digits per byte. The
+// accumulator and carry results are well defined for valid BCD operands, and
+// follow the real hardware for invalid ones.
+//
+// The NMOS 6502 sets N and Z from intermediate or binary results, which
+// don't reflect the decimal accumulator. The 65C02 sets them from the
+// accumulator, taking an extra cycle to do so. Both set V from the
+// intermediate result of ADC, and from the binary result of SBC.
+//
+// Reference: Bruce Clark, "Decimal Mode", http://www.6502.org/tutorials/decimal_mode.html
+
+// adcDecimal adds value and carry to the accumulator as BCD.
+func (c *Cpu) adcDecimal(value uint8) {
+	a := uint16(c.AC)
+	b := uint16(value)
+	carry := uint16(c.getStatusInt(sCarry))
+
+	lo := a&0x0F + b&0x0F + carry
+	if lo >= 0x0A {
+		lo = (lo+0x06)&0x0F + 0x10
+	}
+	sum := a&0xF0 + b&0xF0 + lo
+	intermediate := uint8(sum)
+	signed := int(int8(a&0xF0)) + int(int8(b&0xF0)) + int(lo)
+	if sum >= 0xA0 {
+		sum += 0x60
+	}
+
+	c.AC = uint8(sum)
+	c.setStatus(sCarry, sum >= 0x100)
+	c.setStatus(sOverflow, signed < -128 || signed > 127)
+	if c.Variant.isCmos() {
+		c.updateStatus(c.AC)
+	} else {
+		c.setStatus(sZero, uint8(a+b+carry) == 0)
+		c.setStatus(sNegative, intermediate>>7 == 1)
+	}
+}
+
+// sbcDecimal subtracts value and borrow (inverted carry) from the
+// accumulator as BCD.
+func (c *Cpu) sbcDecimal(value uint8) {
+	a := int(c.AC)
+	b := int(value)
+	borrow := 1 - int(c.getStatusInt(sCarry))
+
+	lo := a&0x0F - b&0x0F - borrow
+	binary := a - b - borrow
+
+	var result int
+	if c.Variant.isCmos() {
+		result = binary
+		if result < 0 {
+			result -= 0x60
+		}
+		if lo < 0 {
+			result -= 0x06
+		}
+	} else {
+		if lo < 0 {
+			lo = (lo-0x06)&0x0F - 0x10
+		}
+		result = a&0xF0 - b&0xF0 + lo
+		if result < 0 {
+			result -= 0x60
+		}
+	}
+
+	c.setStatus(sOverflow, (a^b)&(a^binary)&0x80 != 0)
+	c.AC = uint8(result)
+	c.setStatus(sCarry, binary >= 0)
+	if c.Variant.isCmos() {
+		c.updateStatus(c.AC)
+	} else {
+		c.updateStatus(uint8(binary))
+	}
+}
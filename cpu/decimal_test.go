@@ -0,0 +1,81 @@
+package cpu
+
+import "testing"
+
+func toBcd(n int) uint8 {
+	return uint8(n/10<<4 | n%10)
+}
+
+// TestDecimalArithmetic checks accumulator and carry for every pair of valid
+// BCD operands, with and without carry, on each variant.
+func TestDecimalArithmetic(t *testing.T) {
+	for _, variant := range []Variant{NMOS6502, CMOS65C02} {
+		c := createCpu()
+		c.Variant = variant
+		for a := 0; a < 100; a++ {
+			for b := 0; b < 100; b++ {
+				for carry := 0; carry < 2; carry++ {
+					in := Instruction{OpType: optypes[0x69], Op8: toBcd(b)}
+
+					c.AC = toBcd(a)
+					c.SR = 0x38 | uint8(carry)
+					c.ADC(in)
+					sum := a + b + carry
+					if c.AC != toBcd(sum%100) || c.getStatus(sCarry) != (sum >= 100) {
+						t.Fatalf("%v: %02X + %02X + %d = %02X carry:%t",
+							variant, toBcd(a), toBcd(b), carry, c.AC, c.getStatus(sCarry))
+					}
+
+					in.OpType = optypes[0xE9]
+					c.AC = toBcd(a)
+					c.SR = 0x38 | uint8(carry)
+					c.SBC(in)
+					diff := a - b - (1 - carry)
+					if c.AC != toBcd((diff+100)%100) || c.getStatus(sCarry) != (diff >= 0) {
+						t.Fatalf("%v: %02X - %02X - %d = %02X carry:%t",
+							variant, toBcd(a), toBcd(b), 1-carry, c.AC, c.getStatus(sCarry))
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestDecimalFlags checks the N and Z flags, which differ between variants.
+func TestDecimalFlags(t *testing.T) {
+	tests := []struct {
+		variant Variant
+		opcode  uint8
+		a, b    uint8
+		carry   bool
+		result  uint8
+		sr      string
+	}{
+		// NMOS Z reflects the binary sum $9A, N the intermediate $A0.
+		{NMOS6502, 0x69, 0x99, 0x01, false, 0x00, "n-_bd--c"},
+		{CMOS65C02, 0x69, 0x99, 0x01, false, 0x00, "--_bd-zc"},
+		// NMOS N reflects the intermediate $80 before adjustment.
+		{NMOS6502, 0x69, 0x79, 0x00, true, 0x80, "nv_bd---"},
+		{CMOS65C02, 0x69, 0x79, 0x00, true, 0x80, "nv_bd---"},
+		// NMOS N and Z reflect the binary difference $FF.
+		{NMOS6502, 0xE9, 0x00, 0x01, true, 0x99, "n-_bd---"},
+		{CMOS65C02, 0xE9, 0x00, 0x01, true, 0x99, "n-_bd---"},
+		{NMOS6502, 0xE9, 0x10, 0x10, true, 0x00, "--_bd-zc"},
+		{CMOS65C02, 0xE9, 0x10, 0x10, true, 0x00, "--_bd-zc"},
+	}
+
+	for _, test := range tests {
+		c := createCpu()
+		c.Variant = test.variant
+		c.AC = test.a
+		c.SR = 0x38
+		c.setStatus(sCarry, test.carry)
+		in := Instruction{OpType: optypes[test.opcode], Op8: test.b}
+		c.execute(in)
+		if c.AC != test.result || c.statusString() != test.sr {
+			t.Errorf("%v %v $%02X, $%02X: expected $%02X %s got $%02X %s",
+				test.variant, in, test.a, test.b,
+				test.result, test.sr, c.AC, c.statusString())
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cpu
+
+import "github.com/pda/go6502/bus"
+
+// decodeCache holds instructions decoded from static memory, e.g. RAM and
+// ROM, by address, so the fast core needn't decode them again each time
+// they're executed. Writes through the bus invalidate the instructions they
+// overlap, so self-modifying code still works; memory loaded directly, e.g.
+// by asm.AssembleInto, needs Cpu.FlushDecoded.
+type decodeCache struct {
+	bus     *bus.Bus
+	variant Variant
+	pages   [256]*[256]cachedInstruction // allocated as they're used.
+}
+
+type cachedInstruction struct {
+	Instruction
+	valid bool
+}
+
+// decode returns the instruction at pc as for Variant.ReadInstruction,
+// caching it if it's wholly in static memory.
+func (c *Cpu) decode(pc uint16) (Instruction, error) {
+	d := &c.decoded
+	if d.bus != c.Bus {
+		d.bus = c.Bus
+		d.bus.ObserveWrites(d.invalidate)
+		d.flush()
+	}
+	if d.variant != c.Variant {
+		d.variant = c.Variant
+		d.flush()
+	}
+	page := d.pages[pc>>8]
+	if page != nil && page[pc&0xFF].valid {
+		return page[pc&0xFF].Instruction, nil
+	}
+	in, err := c.Variant.ReadInstruction(pc, c.Bus)
+	if err != nil || !c.Bus.Static(pc, in.Bytes) {
+		return in, err
+	}
+	if page == nil {
+		page = new([256]cachedInstruction)
+		d.pages[pc>>8] = page
+	}
+	page[pc&0xFF] = cachedInstruction{Instruction: in, valid: true}
+	return in, nil
+}
+
+// invalidate discards instructions including the byte at address, which
+// may be the opcode or an operand of an instruction starting up to two bytes
+// before it.
+func (d *decodeCache) invalidate(address uint16, _ byte) {
+	for i := uint16(0); i < 3; i++ {
+		a := address - i
+		if page := d.pages[a>>8]; page != nil {
+			page[a&0xFF].valid = false
+		}
+	}
+}
+
+// FlushDecoded discards the instructions the fast core has decoded and
+// cached. Call it after loading code into memory directly, rather than
+// through the bus, e.g. with asm.AssembleInto, once the CPU has run.
+func (c *Cpu) FlushDecoded() {
+	c.decoded.flush()
+}
+
+// flush discards all cached instructions.
+func (d *decodeCache) flush() {
+	d.pages = [256]*[256]cachedInstruction{}
+}
@@ -0,0 +1,122 @@
+package cpu
+
+import (
+	"testing"
+
+	"github.com/pda/go6502/bus"
+	"github.com/pda/go6502/memory"
+)
+
+func TestSelfModifyingCode(t *testing.T) {
+	c := createCpu()
+	c.PC = programStart
+	c.Bus.Write(programStart, 0xA9) // LDA #$01
+	c.Bus.Write(programStart+1, 0x01)
+	c.Step()
+	if c.AC != 0x01 {
+		t.Fatalf("expected AC $01, got $%02X", c.AC)
+	}
+
+	// Operand modified.
+	c.PC = programStart
+	c.Bus.Write(programStart+1, 0x42)
+	c.Step()
+	if c.AC != 0x42 {
+		t.Errorf("expected modified operand to load $42, got $%02X", c.AC)
+	}
+
+	// Opcode modified.
+	c.PC = programStart
+	c.Bus.Write(programStart, 0xA2) // LDX #$42
+	c.Step()
+	if c.X != 0x42 {
+		t.Errorf("expected modified opcode to load X $42, got $%02X", c.X)
+	}
+}
+
+func TestDecodeCacheHitAndInvalidation(t *testing.T) {
+	ram := &memory.Ram{}
+	b, _ := bus.CreateBus()
+	b.Attach(ram, "ram", 0x0000)
+	c := &Cpu{Bus: b}
+	c.Bus.Write(programStart, 0xA9) // LDA #$01
+	c.Bus.Write(programStart+1, 0x01)
+	step := func(expected byte, why string) {
+		t.Helper()
+		c.PC = programStart
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+		if c.AC != expected {
+			t.Errorf("%s: expected AC $%02X, got $%02X", why, expected, c.AC)
+		}
+	}
+	step(0x01, "decoded")
+
+	// Loaded directly, the bus doesn't know; the cached instruction runs.
+	ram[programStart+1] = 0x02
+	step(0x01, "cached")
+
+	c.FlushDecoded()
+	step(0x02, "flushed")
+
+	c.Bus.Write(programStart+1, 0x03)
+	step(0x03, "invalidated by a bus write")
+}
+
+func TestDecodeCacheVariantChange(t *testing.T) {
+	c := createCpu()
+	c.Variant = CMOS65C02
+	c.Bus.Write(programStart, 0x80) // BRA +2 on 65C02, NOP #imm on NMOS
+	c.Bus.Write(programStart+1, 0x02)
+
+	c.PC = programStart
+	c.Step()
+	if c.PC != programStart+4 {
+		t.Errorf("expected BRA to $%04X, got $%04X", programStart+4, c.PC)
+	}
+
+	c.Variant = NMOS6502X
+	c.PC = programStart
+	c.Step()
+	if c.PC != programStart+2 {
+		t.Errorf("expected NOP to $%04X, got $%04X", programStart+2, c.PC)
+	}
+}
+
+// counter is non-static memory whose every byte reads as the number of reads
+// made of it.
+type counter struct {
+	reads byte
+}
+
+func (m *counter) Read(a uint16) byte {
+	m.reads++
+	return m.reads
+}
+
+func (m *counter) Write(a uint16, value byte) {}
+func (m *counter) Size() int                  { return 0x100 }
+func (m *counter) Shutdown()                  {}
+
+func TestDecodeCacheSkipsNonStaticMemory(t *testing.T) {
+	b, _ := bus.CreateBus()
+	b.Attach(&memory.Ram{}, "ram", 0x0000)
+	b.Attach(&memory.Ram{}, "ram", 0x8000)
+	b.AttachOverlay(&counter{}, "counter", 0xFF00) // shadows the upper RAM
+	c := &Cpu{Bus: b}
+	c.Reset()
+	start := c.Bus.Read(0xFF00)
+
+	// LDA #imm in RAM, operand from the counter.
+	c.Bus.Write(0xFEFF, 0xA9)
+	for i := byte(1); i <= 2; i++ {
+		c.PC = 0xFEFF
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+		if c.AC != start+i {
+			t.Errorf("expected read %d to load $%02X, got $%02X", i, start+i, c.AC)
+		}
+	}
+}
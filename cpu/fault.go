@@ -0,0 +1,120 @@
+package cpu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pda/go6502/bus"
+)
+
+// IllegalOpcodeError is a fault fetching an opcode which isn't part of the
+// variant's instruction set.
+type IllegalOpcodeError struct {
+	Opcode  uint8
+	PC      uint16
+	Variant Variant
+}
+
+func (e *IllegalOpcodeError) Error() string {
+	return fmt.Sprintf("Illegal opcode $%02X at $%04X for %v", e.Opcode, e.PC, e.Variant)
+}
+
+// BusFaultError is a fault accessing the bus during the instruction at PC,
+// or while taking an interrupt before it.
+type BusFaultError struct {
+	PC      uint16
+	Access  bus.Access
+	Address uint16
+	Err     error
+}
+
+func (e *BusFaultError) Error() string {
+	return fmt.Sprintf("Bus fault on %v of $%04X by instruction at $%04X: %v",
+		e.Access, e.Address, e.PC, e.Err)
+}
+
+func (e *BusFaultError) Unwrap() error {
+	return e.Err
+}
+
+// FaultPolicy selects what the CPU does when an instruction faults.
+type FaultPolicy uint8
+
+const (
+	// FaultHalt halts the CPU until reset; Step returns the fault, and keeps
+	// returning it without executing anything.
+	FaultHalt FaultPolicy = iota
+
+	// FaultIgnore carries on: faulting reads return zero, faulting writes
+	// are discarded, and illegal opcodes execute as single-byte NOPs.
+	FaultIgnore
+
+	// FaultTrap tells the monitors of the fault, then carries on as for
+	// FaultIgnore. It halts, as for FaultHalt, if there's no monitor which
+	// implements FaultMonitor.
+	FaultTrap
+)
+
+var faultPolicyNames = [...]string{
+	"halt",
+	"ignore",
+	"trap",
+}
+
+func (p FaultPolicy) String() string {
+	if int(p) < len(faultPolicyNames) {
+		return faultPolicyNames[p]
+	}
+	return "unknown"
+}
+
+// ParseFaultPolicy returns the FaultPolicy named by s, as returned by
+// FaultPolicy.String, ignoring case.
+func ParseFaultPolicy(s string) (FaultPolicy, error) {
+	for i, name := range faultPolicyNames {
+		if strings.EqualFold(s, name) {
+			return FaultPolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown fault policy %q; expected one of %s",
+		s, strings.Join(faultPolicyNames[:], ", "))
+}
+
+// A FaultMonitor is a Monitor which traps faults under the FaultTrap policy,
+// e.g. a debugger breaking to its prompt. Fault may block.
+type FaultMonitor interface {
+	Monitor
+	Fault(error)
+}
+
+// busFault returns a BusFaultError for the first bus fault since the last
+// call, if there's been one.
+func (c *Cpu) busFault(pc uint16) error {
+	f := c.Bus.TakeFault()
+	if f == nil {
+		return nil
+	}
+	return &BusFaultError{PC: pc, Access: f.Access, Address: f.Address, Err: f.Err}
+}
+
+// faulted applies the FaultPolicy to err, returning true if the CPU has
+// halted.
+func (c *Cpu) faulted(err error) bool {
+	switch c.FaultPolicy {
+	case FaultIgnore:
+		return false
+	case FaultTrap:
+		trapped := false
+		for _, m := range c.monitors {
+			if m, ok := m.(FaultMonitor); ok {
+				m.Fault(err)
+				trapped = true
+			}
+		}
+		if trapped {
+			return false
+		}
+	}
+	c.fault = err
+	return true
+}
@@ -0,0 +1,142 @@
+package cpu
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pda/go6502/bus"
+	"github.com/pda/go6502/memory"
+)
+
+// faultLog is a FaultMonitor which records the faults it traps.
+type faultLog struct {
+	faults []error
+}
+
+func (l *faultLog) BeforeExecute(Instruction) {}
+func (l *faultLog) Shutdown()                 {}
+func (l *faultLog) Fault(err error)           { l.faults = append(l.faults, err) }
+
+func TestIllegalOpcodeHalts(t *testing.T) {
+	c := createCpu()
+	c.PC = programStart
+	c.Bus.Write(programStart, 0x02)
+
+	err := c.Step()
+	var illegal *IllegalOpcodeError
+	if !errors.As(err, &illegal) || illegal.Opcode != 0x02 || illegal.PC != programStart {
+		t.Fatalf("expected IllegalOpcodeError for $02 at $0200, got %v", err)
+	}
+	if c.PC != programStart {
+		t.Errorf("expected PC to stay at $0200, got $%04X", c.PC)
+	}
+	c.Bus.Write(programStart, 0xEA)
+	if c.Step() != err {
+		t.Error("expected halted CPU to keep returning its fault")
+	}
+	c.Reset()
+	c.PC = programStart
+	if err := c.Step(); err != nil {
+		t.Errorf("expected reset to clear fault, got %v", err)
+	}
+}
+
+func TestIllegalOpcodeIgnored(t *testing.T) {
+	c := createCpu()
+	c.FaultPolicy = FaultIgnore
+	c.PC = programStart
+	c.Bus.Write(programStart, 0x02)
+	start := c.Cycles
+	if err := c.Step(); err != nil {
+		t.Errorf("expected fault to be ignored, got %v", err)
+	}
+	if c.PC != programStart+1 || c.Cycles-start != 2 {
+		t.Errorf("expected a single-byte NOP, got PC $%04X after %d cycles", c.PC, c.Cycles-start)
+	}
+}
+
+func TestUnmappedWriteFaults(t *testing.T) {
+	for _, accurate := range []bool{false, true} {
+		addressBus, _ := bus.CreateBus()
+		addressBus.Attach(&memory.Ram{}, "ram", 0x0000)
+		c := &Cpu{Bus: addressBus, CycleAccurate: accurate}
+		c.PC = programStart
+		c.Bus.Write(programStart, 0x8D) // STA $9000
+		c.Bus.Write16(programStart+1, 0x9000)
+
+		err := c.Step()
+		var fault *BusFaultError
+		if !errors.As(err, &fault) {
+			t.Fatalf("expected BusFaultError, got %v", err)
+		}
+		if fault.PC != programStart || fault.Address != 0x9000 || fault.Access != bus.WriteAccess {
+			t.Errorf("unexpected fault: %v", fault)
+		}
+	}
+}
+
+func TestRomWriteFaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.rom")
+	if err := os.WriteFile(path, make([]byte, 0x1000), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rom, err := memory.RomFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addressBus, _ := bus.CreateBus()
+	addressBus.Attach(&memory.Ram{}, "ram", 0x0000)
+	addressBus.Attach(rom, "rom", 0x9000)
+	c := &Cpu{Bus: addressBus}
+	c.PC = programStart
+	c.Bus.Write(programStart, 0x8D) // STA $9000
+	c.Bus.Write16(programStart+1, 0x9000)
+
+	if err := c.Step(); !errors.Is(err, memory.ErrReadOnly) {
+		t.Errorf("expected read-only fault, got %v", err)
+	}
+}
+
+func TestFaultTrapsToMonitor(t *testing.T) {
+	addressBus, _ := bus.CreateBus()
+	addressBus.Attach(&memory.Ram{}, "ram", 0x0000)
+	c := &Cpu{Bus: addressBus, FaultPolicy: FaultTrap}
+	m := &faultLog{}
+	c.AttachMonitor(m)
+	c.PC = programStart
+	c.Bus.Write(programStart, 0xAD) // LDA $9000
+	c.Bus.Write16(programStart+1, 0x9000)
+	c.Bus.Write(programStart+3, 0x02)
+
+	if err := c.Step(); err != nil {
+		t.Errorf("expected trapped fault, got %v", err)
+	}
+	if err := c.Step(); err != nil {
+		t.Errorf("expected trapped fault, got %v", err)
+	}
+	if len(m.faults) != 2 {
+		t.Fatalf("expected two faults trapped, got %v", m.faults)
+	}
+	var fault *BusFaultError
+	if !errors.As(m.faults[0], &fault) || fault.Access != bus.ReadAccess {
+		t.Errorf("expected read fault, got %v", m.faults[0])
+	}
+	var illegal *IllegalOpcodeError
+	if !errors.As(m.faults[1], &illegal) {
+		t.Errorf("expected illegal opcode, got %v", m.faults[1])
+	}
+}
+
+func TestParseFaultPolicy(t *testing.T) {
+	for _, p := range []FaultPolicy{FaultHalt, FaultIgnore, FaultTrap} {
+		parsed, err := ParseFaultPolicy(p.String())
+		if err != nil || parsed != p {
+			t.Errorf("ParseFaultPolicy(%q) = %v, %v", p.String(), parsed, err)
+		}
+	}
+	if _, err := ParseFaultPolicy("explode"); err == nil {
+		t.Error("expected error for unknown fault policy")
+	}
+}
@@ -0,0 +1,145 @@
+package cpu
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Klaus Dormann's functional tests exercise every documented instruction,
+// addressing mode and flag, trapping with a branch or jump to itself on
+// failure, or at a known address on success. See testdata/README.md for
+// how the binaries are built.
+
+// A functionalTest is a test binary and the addresses it was assembled for.
+type functionalTest struct {
+	file     string
+	variants []Variant
+	load     uint16 // address the binary is loaded at.
+	start    uint16 // entry point.
+	success  uint16 // trap address on success, or zero for any trap with testCase zero.
+	testCase uint16 // address of the current test number, reported on failure.
+}
+
+var functionalTests = []functionalTest{
+	{
+		file:     "6502_functional_test.bin",
+		variants: []Variant{NMOS6502, CMOS65C02, WDC65C02},
+		load:     0x0000,
+		start:    0x0400,
+		success:  0x3469,
+		testCase: 0x0200,
+	},
+	{
+		file:     "6502_decimal_test.bin",
+		variants: []Variant{NMOS6502, CMOS65C02},
+		load:     0x0200,
+		start:    0x0200,
+		success:  0,
+		testCase: 0x000B, // ERROR; cleared once every result has matched.
+	},
+	{
+		file:     "65C02_extended_opcodes_test.bin",
+		variants: []Variant{WDC65C02},
+		load:     0x0000,
+		start:    0x0400,
+		success:  0x24F1,
+		testCase: 0x0202,
+	},
+}
+
+// maxFunctionalSteps bounds a test run, in case it loops without trapping.
+const maxFunctionalSteps = 200_000_000
+
+// errTimeout is returned by runToTrap if the program doesn't trap.
+var errTimeout = errors.New("no trap within step limit")
+
+// runToTrap steps c until an instruction branches or jumps to itself,
+// returning its address.
+func runToTrap(c *Cpu, maxSteps int) (uint16, error) {
+	for i := 0; i < maxSteps; i++ {
+		pc := c.PC
+		if err := c.Step(); err != nil {
+			return pc, err
+		}
+		if c.PC == pc {
+			return pc, nil
+		}
+	}
+	return c.PC, errTimeout
+}
+
+// loadFunctionalTest returns a CPU with the test binary loaded, ready to
+// start. The binary must be in testdata.
+func loadFunctionalTest(t *testing.T, ft functionalTest, v Variant) *Cpu {
+	image, err := os.ReadFile(filepath.Join("testdata", ft.file))
+	if errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("%s not found; see testdata/README.md", ft.file)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(ft.load)+len(image) > 0x10000 {
+		t.Fatalf("%s is %d bytes; too big to load at $%04X", ft.file, len(image), ft.load)
+	}
+	c := createCpu()
+	c.Variant = v
+	for i, b := range image {
+		c.Bus.Write(ft.load+uint16(i), b)
+	}
+	c.PC = ft.start
+	return c
+}
+
+func TestFunctional(t *testing.T) {
+	for _, ft := range functionalTests {
+		for _, v := range ft.variants {
+			for _, accurate := range []bool{false, true} {
+				name := fmt.Sprintf("%s/%v", ft.file, v)
+				if accurate {
+					name += "/cycle-accurate"
+				}
+				t.Run(name, func(t *testing.T) {
+					if accurate && testing.Short() {
+						t.Skip("skipping cycle-accurate run in short mode")
+					}
+					c := loadFunctionalTest(t, ft, v)
+					c.CycleAccurate = accurate
+					trap, err := runToTrap(c, maxFunctionalSteps)
+					if err != nil {
+						t.Fatalf("at $%04X, test $%02X: %v", trap, c.Bus.Read(ft.testCase), err)
+					}
+					testCase := c.Bus.Read(ft.testCase)
+					if ft.success == 0 && testCase != 0 || ft.success != 0 && trap != ft.success {
+						t.Fatalf("failure trap at $%04X, test $%02X", trap, testCase)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestRunToTrap(t *testing.T) {
+	c := createCpu()
+	c.PC = programStart
+	for i, b := range []byte{
+		0xA2, 0x03, // LDX #$03
+		0xCA,       // DEX
+		0xD0, 0xFD, // BNE $0202
+		0x4C, 0x05, 0x02, // JMP $0205
+	} {
+		c.Bus.Write(programStart+uint16(i), b)
+	}
+	trap, err := runToTrap(c, 100)
+	if err != nil || trap != programStart+5 {
+		t.Errorf("expected trap at $%04X, got $%04X, %v", programStart+5, trap, err)
+	}
+
+	c.PC = programStart
+	c.Bus.Write16(programStart+6, programStart) // JMP $0200
+	if _, err := runToTrap(c, 100); err != errTimeout {
+		t.Errorf("expected errTimeout, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package cpu
+
+// Undocumented NMOS 6502 instructions, available with the NMOS6502X variant.
+//
+// Most combine a read-modify-write instruction with an accumulator
+// instruction, as a side effect of the NMOS decode logic activating both
+// for the same opcode.
+//
+// Reference: "NMOS 6510 Unintended Opcodes", groepaz et al.
+
+// ALR: AND immediate, then LSR accumulator.
+func (c *Cpu) ALR(in Instruction) {
+	value := c.AC & in.Op8
+	c.setStatus(sCarry, value&1 == 1)
+	c.AC = value >> 1
+	c.updateStatus(c.AC)
+}
+
+// ANC: AND immediate, then copy N into carry.
+func (c *Cpu) ANC(in Instruction) {
+	c.AC &= in.Op8
+	c.updateStatus(c.AC)
+	c.setStatus(sCarry, c.getStatus(sNegative))
+}
+
+// ARR: AND immediate, then ROR accumulator, with C and V set from bits 6
+// and 5 of the result. In decimal mode the result is then BCD adjusted,
+// with flags as the NMOS 6502 computes them from intermediate values.
+func (c *Cpu) ARR(in Instruction) {
+	value := c.AC & in.Op8
+	carry := c.getStatusInt(sCarry)
+	result := value>>1 | carry<<7
+
+	if !c.getStatus(sDecimal) {
+		c.AC = result
+		c.updateStatus(c.AC)
+		c.setStatus(sCarry, result&0x40 != 0)
+		c.setStatus(sOverflow, (result>>6^result>>5)&1 == 1)
+		return
+	}
+
+	c.setStatus(sNegative, carry == 1)
+	c.setStatus(sZero, result == 0)
+	c.setStatus(sOverflow, (value^result)&0x40 != 0)
+	if value&0x0F+value&0x01 > 0x05 {
+		result = result&0xF0 | (result+0x06)&0x0F
+	}
+	if uint16(value&0xF0)+uint16(value&0x10) > 0x50 {
+		result = result&0x0F | (result+0x60)&0xF0
+		c.setStatus(sCarry, true)
+	} else {
+		c.setStatus(sCarry, false)
+	}
+	c.AC = result
+}
+
+// DCP: Decrement memory, then compare with accumulator (DEC + CMP).
+func (c *Cpu) DCP(in Instruction) {
+	value := c.modify(c.writeAddress(in), func(value uint8) uint8 {
+		return value - 1
+	})
+	c.setStatus(sCarry, c.AC >= value)
+	c.updateStatus(c.AC - value)
+}
+
+// ISC: Increment memory, then subtract from accumulator (INC + SBC).
+func (c *Cpu) ISC(in Instruction) {
+	value := c.modify(c.writeAddress(in), func(value uint8) uint8 {
+		return value + 1
+	})
+	c.sbc(value)
+}
+
+// JAM: Lock up the processor until reset.
+func (c *Cpu) JAM(in Instruction) {
+	c.stopped = true
+}
+
+// LAS: AND memory with stack pointer, loading the result into the
+// accumulator, X and the stack pointer.
+func (c *Cpu) LAS(in Instruction) {
+	value := c.resolveOperand(in) & c.SP
+	c.AC, c.X, c.SP = value, value, value
+	c.updateStatus(value)
+}
+
+// LAX: Load accumulator and index register X from memory (LDA + LDX).
+func (c *Cpu) LAX(in Instruction) {
+	c.AC = c.resolveOperand(in)
+	c.X = c.AC
+	c.updateStatus(c.AC)
+}
+
+// RLA: Rotate memory left, then AND with accumulator (ROL + AND).
+func (c *Cpu) RLA(in Instruction) {
+	carry := c.getStatusInt(sCarry)
+	value := c.modify(c.writeAddress(in), func(value uint8) uint8 {
+		c.setStatus(sCarry, value>>7 == 1)
+		return value<<1 | carry
+	})
+	c.AC &= value
+	c.updateStatus(c.AC)
+}
+
+// RRA: Rotate memory right, then add to accumulator (ROR + ADC).
+func (c *Cpu) RRA(in Instruction) {
+	carry := c.getStatusInt(sCarry)
+	value := c.modify(c.writeAddress(in), func(value uint8) uint8 {
+		c.setStatus(sCarry, value&1 == 1)
+		return value>>1 | carry<<7
+	})
+	c.adc(value)
+}
+
+// SAX: Store accumulator AND index register X to memory.
+func (c *Cpu) SAX(in Instruction) {
+	c.write(c.writeAddress(in), c.AC&c.X)
+}
+
+// SBX: Subtract immediate from accumulator AND X, into X. Carry is set as
+// for CMP, and decimal mode has no effect.
+func (c *Cpu) SBX(in Instruction) {
+	value := c.AC & c.X
+	c.setStatus(sCarry, value >= in.Op8)
+	c.X = value - in.Op8
+	c.updateStatus(c.X)
+}
+
+// SLO: Shift memory left, then OR with accumulator (ASL + ORA).
+func (c *Cpu) SLO(in Instruction) {
+	value := c.modify(c.writeAddress(in), func(value uint8) uint8 {
+		c.setStatus(sCarry, value>>7 == 1)
+		return value << 1
+	})
+	c.AC |= value
+	c.updateStatus(c.AC)
+}
+
+// SRE: Shift memory right, then exclusive-OR with accumulator (LSR + EOR).
+func (c *Cpu) SRE(in Instruction) {
+	value := c.modify(c.writeAddress(in), func(value uint8) uint8 {
+		c.setStatus(sCarry, value&1 == 1)
+		return value >> 1
+	})
+	c.AC ^= value
+	c.updateStatus(c.AC)
+}
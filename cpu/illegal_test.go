@@ -0,0 +1,163 @@
+package cpu
+
+import "testing"
+
+func TestIllegalInstructions(t *testing.T) {
+	runInstructionTests(t, []instructionTest{
+		{
+			name:    "LAX zp",
+			variant: NMOS6502X,
+			program: []byte{0xA7, 0x10},
+			before:  registers{SR: 0x30},
+			memory:  map[uint16]byte{0x0010: 0x80},
+			after:   registers{PC: 0x0202, AC: 0x80, X: 0x80, SR: 0xB0},
+		},
+		{
+			name:    "SAX abs",
+			variant: NMOS6502X,
+			program: []byte{0x8F, 0x00, 0x03},
+			before:  registers{AC: 0xF0, X: 0x3C, SR: 0x32},
+			after:   registers{PC: 0x0203, AC: 0xF0, X: 0x3C, SR: 0x32},
+			expect:  map[uint16]byte{0x0300: 0x30},
+		},
+		{
+			name:    "DCP zp",
+			variant: NMOS6502X,
+			program: []byte{0xC7, 0x10},
+			before:  registers{AC: 0x41, SR: 0x30},
+			memory:  map[uint16]byte{0x0010: 0x42},
+			after:   registers{PC: 0x0202, AC: 0x41, SR: 0x33},
+			expect:  map[uint16]byte{0x0010: 0x41},
+		},
+		{
+			name:    "ISC zp",
+			variant: NMOS6502X,
+			program: []byte{0xE7, 0x10},
+			before:  registers{AC: 0x10, SR: 0x31},
+			memory:  map[uint16]byte{0x0010: 0x0F},
+			after:   registers{PC: 0x0202, AC: 0x00, SR: 0x33},
+			expect:  map[uint16]byte{0x0010: 0x10},
+		},
+		{
+			name:    "ISC abs,X is $FF",
+			variant: NMOS6502X,
+			program: []byte{0xFF, 0x00, 0x03},
+			before:  registers{AC: 0x05, X: 0x01, SR: 0x31},
+			memory:  map[uint16]byte{0x0301: 0x01},
+			after:   registers{PC: 0x0203, AC: 0x03, X: 0x01, SR: 0x31},
+			expect:  map[uint16]byte{0x0301: 0x02},
+		},
+		{
+			name:    "SLO zp",
+			variant: NMOS6502X,
+			program: []byte{0x07, 0x10},
+			before:  registers{AC: 0x01, SR: 0x30},
+			memory:  map[uint16]byte{0x0010: 0xC0},
+			after:   registers{PC: 0x0202, AC: 0x81, SR: 0xB1},
+			expect:  map[uint16]byte{0x0010: 0x80},
+		},
+		{
+			name:    "RLA zp",
+			variant: NMOS6502X,
+			program: []byte{0x27, 0x10},
+			before:  registers{AC: 0x0F, SR: 0x31},
+			memory:  map[uint16]byte{0x0010: 0x84},
+			after:   registers{PC: 0x0202, AC: 0x09, SR: 0x31},
+			expect:  map[uint16]byte{0x0010: 0x09},
+		},
+		{
+			name:    "SRE zp",
+			variant: NMOS6502X,
+			program: []byte{0x47, 0x10},
+			before:  registers{AC: 0xFF, SR: 0x30},
+			memory:  map[uint16]byte{0x0010: 0x03},
+			after:   registers{PC: 0x0202, AC: 0xFE, SR: 0xB1},
+			expect:  map[uint16]byte{0x0010: 0x01},
+		},
+		{
+			name:    "RRA zp",
+			variant: NMOS6502X,
+			program: []byte{0x67, 0x10},
+			before:  registers{AC: 0x10, SR: 0x30},
+			memory:  map[uint16]byte{0x0010: 0x03},
+			after:   registers{PC: 0x0202, AC: 0x12, SR: 0x30},
+			expect:  map[uint16]byte{0x0010: 0x01},
+		},
+		{
+			name:    "ANC sets carry from N",
+			variant: NMOS6502X,
+			program: []byte{0x0B, 0x80},
+			before:  registers{AC: 0xFF, SR: 0x30},
+			after:   registers{PC: 0x0202, AC: 0x80, SR: 0xB1},
+		},
+		{
+			name:    "ALR",
+			variant: NMOS6502X,
+			program: []byte{0x4B, 0x03},
+			before:  registers{AC: 0xFF, SR: 0x30},
+			after:   registers{PC: 0x0202, AC: 0x01, SR: 0x31},
+		},
+		{
+			name:    "ARR binary",
+			variant: NMOS6502X,
+			program: []byte{0x6B, 0xFF},
+			before:  registers{AC: 0x80, SR: 0x31},
+			after:   registers{PC: 0x0202, AC: 0xC0, SR: 0xF1},
+		},
+		{
+			name:    "ARR decimal",
+			variant: NMOS6502X,
+			program: []byte{0x6B, 0xFF},
+			before:  registers{AC: 0x66, SR: 0x38},
+			after:   registers{PC: 0x0202, AC: 0x99, SR: 0x79},
+		},
+		{
+			name:    "SBX",
+			variant: NMOS6502X,
+			program: []byte{0xCB, 0x02},
+			before:  registers{AC: 0x0F, X: 0xFC, SR: 0x38},
+			after:   registers{PC: 0x0202, AC: 0x0F, X: 0x0A, SR: 0x39},
+		},
+		{
+			name:    "LAS",
+			variant: NMOS6502X,
+			program: []byte{0xBB, 0x00, 0x03},
+			before:  registers{SP: 0xF3, SR: 0x30},
+			memory:  map[uint16]byte{0x0300: 0x8F},
+			after:   registers{PC: 0x0203, AC: 0x83, X: 0x83, SP: 0x83, SR: 0xB0},
+		},
+		{
+			name:    "SBC immediate $EB",
+			variant: NMOS6502X,
+			program: []byte{0xEB, 0x01},
+			before:  registers{AC: 0x03, SR: 0x31},
+			after:   registers{PC: 0x0202, AC: 0x02, SR: 0x31},
+		},
+		{
+			name:    "NOP abs,X consumes three bytes",
+			variant: NMOS6502X,
+			program: []byte{0x1C, 0x00, 0x03},
+			before:  registers{SR: 0x30},
+			after:   registers{PC: 0x0203, SR: 0x30},
+		},
+		{
+			name:    "JAM locks up",
+			variant: NMOS6502X,
+			program: []byte{0x02, 0xEA},
+			steps:   3,
+			before:  registers{SR: 0x30},
+			after:   registers{PC: 0x0201, SR: 0x30},
+		},
+	})
+}
+
+func TestUnstableOpcodesAreIllegal(t *testing.T) {
+	for _, opcode := range []uint8{0x8B, 0xAB, 0x93, 0x9F, 0x9E, 0x9C, 0x9B} {
+		if _, ok := NMOS6502X.optypes().lookup(opcode); ok {
+			t.Errorf("unstable opcode $%02X shouldn't be decoded", opcode)
+		}
+	}
+	if _, ok := NMOS6502.optypes().lookup(0xA7); ok {
+		t.Error("NMOS6502 shouldn't decode undocumented opcodes")
+	}
+}
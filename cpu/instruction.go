@@ -1,11 +1,15 @@
 package cpu
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/pda/go6502/bus"
 )
 
+// ErrTruncated is returned decoding an instruction from too few bytes.
+var ErrTruncated = errors.New("Instruction truncated")
+
 // Instruction is an OpType plus its operand.
 // One or both of the operand types will be zero.
 // This is determined by (ot.Bytes - 1) / 8
@@ -31,15 +35,94 @@ func (in Instruction) String() (s string) {
 	return
 }
 
-// ReadInstruction reads an instruction from the bus starting at the given
-// address. An instruction may be 1, 2 or 3 bytes long, including its optional
-// 8 or 16 bit operand.
-func ReadInstruction(pc uint16, bus *bus.Bus) Instruction {
-	opcode := bus.Read(pc)
-	optype, ok := optypes[opcode]
-	if !ok {
-		panic(fmt.Sprintf("Illegal opcode $%02X at $%04X", opcode, pc))
+// Disassemble returns the instruction in assembler syntax, e.g. "LDA #$10"
+// or "STA ($20),Y". Branch targets are resolved to addresses, given pc, the
+// address of the instruction.
+func (in Instruction) Disassemble(pc uint16) string {
+	return in.DisassembleWith(pc, hexAddress)
+}
+
+// AddressKind distinguishes the address operands formatted for
+// Instruction.DisassembleWith.
+type AddressKind uint8
+
+const (
+	ZeropageAddress AddressKind = iota // a zero-page operand, e.g. LDA $10.
+	AbsoluteAddress                    // a 16-bit operand, e.g. LDA $1000.
+	BranchAddress                      // a relative branch's target.
+)
+
+// hexAddress formats an address operand in hex, as $nn in zero page or
+// $nnnn otherwise.
+func hexAddress(address uint16, kind AddressKind) string {
+	if kind == ZeropageAddress {
+		return fmt.Sprintf("$%02X", address)
 	}
+	return fmt.Sprintf("$%04X", address)
+}
+
+// DisassembleWith is Disassemble, with address operands formatted by
+// format, e.g. to show them as labels.
+func (in Instruction) DisassembleWith(pc uint16, format func(uint16, AddressKind) string) string {
+	zp := func() string { return format(uint16(in.Op8), ZeropageAddress) }
+	abs := func() string { return format(in.Op16, AbsoluteAddress) }
+	var operand string
+	switch in.addressing {
+	case absolute:
+		operand = abs()
+	case absoluteX:
+		operand = abs() + ",X"
+	case absoluteY:
+		operand = abs() + ",Y"
+	case accumulator:
+		operand = "A"
+	case immediate:
+		operand = fmt.Sprintf("#$%02X", in.Op8)
+	case indirect:
+		operand = "(" + abs() + ")"
+	case indirectX:
+		operand = "(" + zp() + ",X)"
+	case indirectY:
+		operand = "(" + zp() + "),Y"
+	case relative:
+		operand = format(in.BranchTarget(pc), BranchAddress)
+	case zeropage:
+		operand = zp()
+	case zeropageX:
+		operand = zp() + ",X"
+	case zeropageY:
+		operand = zp() + ",Y"
+	case zeropageIndirect:
+		operand = "(" + zp() + ")"
+	case absoluteIndirectX:
+		operand = "(" + abs() + ",X)"
+	case zeropageRelative:
+		operand = format(uint16(uint8(in.Op16)), ZeropageAddress) + "," +
+			format(in.BranchTarget(pc), BranchAddress)
+	}
+	if operand == "" {
+		return in.Name()
+	}
+	return in.Name() + " " + operand
+}
+
+// BranchTarget returns the address a relative branch at pc goes to if
+// taken. Its offset is from the address following the instruction.
+func (in Instruction) BranchTarget(pc uint16) uint16 {
+	offset := in.Op8
+	if in.addressing == zeropageRelative {
+		offset = uint8(in.Op16 >> 8)
+	}
+	return pc + uint16(in.Bytes) + uint16(int8(offset))
+}
+
+// ReadInstruction reads an instruction of the variant's instruction set from
+// the bus starting at the given address. An instruction may be 1, 2 or 3
+// bytes long, including its optional 8 or 16 bit operand.
+// An opcode outside the instruction set returns an IllegalOpcodeError, along
+// with a single-byte NOP to execute in its place.
+func (v Variant) ReadInstruction(pc uint16, bus *bus.Bus) (Instruction, error) {
+	optype, err := v.opType(bus.Read(pc), pc)
 	in := Instruction{OpType: optype}
 	switch in.Bytes {
 	case 1: // no operand
@@ -50,5 +133,36 @@ func ReadInstruction(pc uint16, bus *bus.Bus) Instruction {
 	default:
 		panic(fmt.Sprintf("unhandled instruction length: %d", in.Bytes))
 	}
-	return in
+	return in, err
+}
+
+// DecodeInstruction decodes the instruction at the start of code, which was
+// read from pc, as for ReadInstruction. ErrTruncated is returned if code
+// ends before the instruction does.
+func (v Variant) DecodeInstruction(pc uint16, code []byte) (Instruction, error) {
+	if len(code) == 0 {
+		return Instruction{}, ErrTruncated
+	}
+	optype, err := v.opType(code[0], pc)
+	in := Instruction{OpType: optype}
+	if len(code) < int(in.Bytes) {
+		return in, ErrTruncated
+	}
+	switch in.Bytes {
+	case 2:
+		in.Op8 = code[1]
+	case 3:
+		in.Op16 = uint16(code[2])<<8 | uint16(code[1])
+	}
+	return in, err
+}
+
+// opType returns the variant's OpType for opcode, read from pc.
+func (v Variant) opType(opcode uint8, pc uint16) (OpType, error) {
+	optype, ok := v.optypes().lookup(opcode)
+	if !ok {
+		err := &IllegalOpcodeError{Opcode: opcode, PC: pc, Variant: v}
+		return OpType{opcode, nop, implied, 1, 2}, err
+	}
+	return optype, nil
 }
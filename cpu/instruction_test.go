@@ -0,0 +1,43 @@
+package cpu
+
+import "testing"
+
+func TestDisassemble(t *testing.T) {
+	for _, tt := range []struct {
+		variant Variant
+		bytes   []byte
+		expect  string
+	}{
+		{NMOS6502, []byte{0xEA}, "NOP"},
+		{NMOS6502, []byte{0x0A}, "ASL A"},
+		{NMOS6502, []byte{0xA9, 0x10}, "LDA #$10"},
+		{NMOS6502, []byte{0xA5, 0x10}, "LDA $10"},
+		{NMOS6502, []byte{0xB5, 0x10}, "LDA $10,X"},
+		{NMOS6502, []byte{0xB6, 0x10}, "LDX $10,Y"},
+		{NMOS6502, []byte{0xAD, 0x34, 0x12}, "LDA $1234"},
+		{NMOS6502, []byte{0xBD, 0x34, 0x12}, "LDA $1234,X"},
+		{NMOS6502, []byte{0xB9, 0x34, 0x12}, "LDA $1234,Y"},
+		{NMOS6502, []byte{0x6C, 0x34, 0x12}, "JMP ($1234)"},
+		{NMOS6502, []byte{0xA1, 0x10}, "LDA ($10,X)"},
+		{NMOS6502, []byte{0xB1, 0x10}, "LDA ($10),Y"},
+		{NMOS6502, []byte{0xD0, 0xFE}, "BNE $0200"},
+		{NMOS6502, []byte{0x10, 0x7F}, "BPL $0281"},
+		{CMOS65C02, []byte{0xB2, 0x10}, "LDA ($10)"},
+		{CMOS65C02, []byte{0x7C, 0x34, 0x12}, "JMP ($1234,X)"},
+		{Rockwell65C02, []byte{0x8F, 0x10, 0x80}, "BBS0 $10,$0183"},
+		{Rockwell65C02, []byte{0x87, 0x10}, "SMB0 $10"},
+	} {
+		c := createCpu()
+		c.Variant = tt.variant
+		for i, b := range tt.bytes {
+			c.Bus.Write(programStart+uint16(i), b)
+		}
+		in, err := tt.variant.ReadInstruction(programStart, c.Bus)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := in.Disassemble(programStart); s != tt.expect {
+			t.Errorf("% X: expected %q, got %q", tt.bytes, tt.expect, s)
+		}
+	}
+}
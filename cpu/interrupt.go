@@ -0,0 +1,98 @@
+package cpu
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Vectors hold the little-endian address the CPU jumps to on each kind of
+// interrupt, and on reset.
+const (
+	NmiVector   = 0xFFFA
+	ResetVector = 0xFFFC
+	IrqVector   = 0xFFFE // shared by IRQ and BRK
+)
+
+// interruptLine is an active-low input, wired-OR between any number
+// of named sources; it's asserted while at least one source holds it low.
+// It may be driven from any goroutine.
+type interruptLine struct {
+	mu       sync.Mutex
+	sources  map[string]bool
+	asserted atomic.Bool
+}
+
+// set asserts or releases the line on behalf of source, returning true if
+// that took the line from released to asserted.
+func (l *interruptLine) set(source string, asserted bool) (falling bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	before := len(l.sources) > 0
+	if asserted {
+		if l.sources == nil {
+			l.sources = make(map[string]bool)
+		}
+		l.sources[source] = true
+	} else {
+		delete(l.sources, source)
+	}
+	after := len(l.sources) > 0
+	l.asserted.Store(after)
+	return after && !before
+}
+
+// SetIRQ asserts or releases the IRQB input on behalf of the named source,
+// e.g. a device on the bus. IRQ is level-triggered: while any source asserts
+// it and the interrupt-disable flag is clear, the CPU will take the interrupt
+// before its next instruction. Sources must release it once serviced.
+func (c *Cpu) SetIRQ(source string, asserted bool) {
+	c.irq.set(source, asserted)
+}
+
+// SetNMI asserts or releases the NMIB input on behalf of the named source.
+// NMI is edge-triggered and can't be disabled: the interrupt is taken once
+// each time the line goes from released to asserted.
+func (c *Cpu) SetNMI(source string, asserted bool) {
+	if c.nmi.set(source, asserted) {
+		c.nmiPending.Store(true)
+	}
+}
+
+// serviceInterrupts takes a pending NMI, or an asserted and enabled IRQ.
+// This happens between instructions, leaving the PC at the handler.
+func (c *Cpu) serviceInterrupts() {
+	if c.nmiPending.CompareAndSwap(true, false) {
+		c.interrupted = NmiVector
+	} else if c.irq.asserted.Load() && !c.getStatus(sInterrupt) {
+		c.interrupted = IrqVector
+	} else {
+		return
+	}
+	c.interrupt(c.interrupted, false)
+}
+
+// interrupt pushes the program counter and status, disables IRQ, then jumps
+// through vector. Only BRK sets the break bit in the pushed status, which
+// lets a shared IRQ/BRK handler tell them apart. Hardware interrupts take
+// seven cycles, the same as the BRK instruction; they begin with the two
+// reads of a BRK, but the opcode is discarded and the PC not incremented.
+func (c *Cpu) interrupt(vector uint16, brk bool) {
+	if !brk {
+		c.tick(7)
+		c.dummyRead(c.PC)
+		c.dummyRead(c.PC)
+	}
+	c.push16(c.PC)
+	sr := c.SR | 1<<5
+	if brk {
+		sr |= 1 << sBreak
+	} else {
+		sr &^= 1 << sBreak
+	}
+	c.push(sr)
+	c.setStatus(sInterrupt, true)
+	if c.Variant.isCmos() {
+		c.setStatus(sDecimal, false) // the NMOS 6502 leaves decimal mode as-is.
+	}
+	c.PC = c.read16(vector)
+}
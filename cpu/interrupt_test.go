@@ -0,0 +1,162 @@
+package cpu
+
+import "testing"
+
+// createInterruptCpu returns a CPU with NOPs at programStart, and handlers
+// at $0300 (IRQ/BRK) and $0400 (NMI) which each begin with a NOP.
+func createInterruptCpu() *Cpu {
+	c := createCpu()
+	for i := uint16(0); i < 16; i++ {
+		c.Bus.Write(programStart+i, 0xEA)
+	}
+	c.Bus.Write16(IrqVector, 0x0300)
+	c.Bus.Write16(NmiVector, 0x0400)
+	c.Bus.Write(0x0300, 0xEA)
+	c.Bus.Write(0x0400, 0xEA)
+	c.PC = programStart
+	c.SP = 0xFF
+	return c
+}
+
+func TestIrqMaskedByInterruptFlag(t *testing.T) {
+	c := createInterruptCpu()
+	c.SR = 0x34
+	c.SetIRQ("test", true)
+	c.Step()
+	if c.PC != programStart+1 {
+		t.Errorf("IRQ taken with I flag set; PC $%04X", c.PC)
+	}
+}
+
+func TestIrqTakenWhenEnabled(t *testing.T) {
+	c := createInterruptCpu()
+	c.SR = 0x39 // decimal, carry
+	c.SetIRQ("test", true)
+	c.Step()
+
+	// The handler's first NOP has executed.
+	if c.PC != 0x0301 {
+		t.Errorf("expected PC $0301, got $%04X", c.PC)
+	}
+	if c.SP != 0xFC {
+		t.Errorf("expected SP $FC, got $%02X", c.SP)
+	}
+	if !c.getStatus(sInterrupt) {
+		t.Error("expected I flag set in handler")
+	}
+	if !c.getStatus(sDecimal) {
+		t.Error("NMOS 6502 should leave D flag set in handler")
+	}
+	pushed := []byte{c.Bus.Read(0x01FF), c.Bus.Read(0x01FE), c.Bus.Read(0x01FD)}
+	if pushed[0] != 0x02 || pushed[1] != 0x00 || pushed[2] != 0x29 {
+		t.Errorf("expected stack 02 00 29 got % X", pushed)
+	}
+}
+
+func TestIrqIsLevelTriggered(t *testing.T) {
+	c := createInterruptCpu()
+	c.Bus.Write(0x0301, 0x40) // RTI
+	c.SR = 0x30
+	c.SetIRQ("a", true)
+	c.SetIRQ("b", true)
+	c.Step() // enter, NOP
+	c.Step() // RTI
+
+	// Still asserted by both sources; taken again.
+	c.Step()
+	if c.PC != 0x0301 {
+		t.Errorf("expected IRQ retaken, PC $%04X", c.PC)
+	}
+	c.Step() // RTI
+
+	// Still asserted by b.
+	c.SetIRQ("a", false)
+	c.Step()
+	if c.PC != 0x0301 {
+		t.Errorf("expected IRQ retaken for remaining source, PC $%04X", c.PC)
+	}
+	c.Step() // RTI
+
+	c.SetIRQ("b", false)
+	c.Step()
+	if c.PC != programStart+1 {
+		t.Errorf("expected IRQ released, PC $%04X", c.PC)
+	}
+}
+
+func TestNmiIsEdgeTriggered(t *testing.T) {
+	c := createInterruptCpu()
+	c.Bus.Write(0x0401, 0x40) // RTI
+	c.SR = 0x34               // NMI ignores the I flag.
+	c.SetNMI("test", true)
+	c.Step()
+	if c.PC != 0x0401 {
+		t.Errorf("expected NMI taken, PC $%04X", c.PC)
+	}
+	c.Step() // RTI
+	c.Step()
+	if c.PC != programStart+1 {
+		t.Errorf("expected NMI taken once per edge, PC $%04X", c.PC)
+	}
+
+	// A second source doesn't make a new edge; releasing all and
+	// re-asserting does.
+	c.SetNMI("other", true)
+	c.Step()
+	if c.PC != programStart+2 {
+		t.Errorf("expected no NMI without edge, PC $%04X", c.PC)
+	}
+	c.SetNMI("test", false)
+	c.SetNMI("other", false)
+	c.SetNMI("test", true)
+	c.Step()
+	if c.PC != 0x0401 {
+		t.Errorf("expected NMI on new edge, PC $%04X", c.PC)
+	}
+}
+
+func TestNmiTakesPriorityOverIrq(t *testing.T) {
+	c := createInterruptCpu()
+	c.SR = 0x30
+	c.SetIRQ("irq", true)
+	c.SetNMI("nmi", true)
+	c.Step()
+	if c.PC != 0x0401 {
+		t.Errorf("expected NMI first, PC $%04X", c.PC)
+	}
+}
+
+func TestBrk(t *testing.T) {
+	c := createInterruptCpu()
+	c.Bus.Write(programStart, 0x00) // BRK
+	c.SR = 0x30
+	c.Step()
+	if c.PC != 0x0300 {
+		t.Errorf("expected PC $0300 got $%04X", c.PC)
+	}
+	pushed := []byte{c.Bus.Read(0x01FF), c.Bus.Read(0x01FE), c.Bus.Read(0x01FD)}
+	if pushed[0] != 0x02 || pushed[1] != 0x02 || pushed[2] != 0x30 {
+		t.Errorf("expected stack 02 02 30 got % X", pushed)
+	}
+	if !c.getStatus(sInterrupt) {
+		t.Error("expected I flag set")
+	}
+
+	// RTI returns past the padding byte.
+	c.Bus.Write(0x0300, 0x40)
+	c.Step()
+	if c.PC != programStart+2 {
+		t.Errorf("expected return to $0202, got $%04X", c.PC)
+	}
+}
+
+func TestCmosInterruptClearsDecimal(t *testing.T) {
+	c := createInterruptCpu()
+	c.Variant = CMOS65C02
+	c.SR = 0x38
+	c.SetIRQ("test", true)
+	c.Step()
+	if c.getStatus(sDecimal) {
+		t.Error("65C02 should clear D flag on interrupt")
+	}
+}
@@ -0,0 +1,222 @@
+package cpu
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pda/go6502/bus"
+)
+
+// Lockstep is a Monitor which runs a second, shadow Cpu alongside the one it
+// monitors, on a copy of its memory, and halts the CPU at the first
+// instruction after which their registers, flags, cycle counts or memory
+// writes differ. Step then returns a DivergenceError describing the
+// differences.
+//
+// The shadow runs an instruction behind, catching up before each of the
+// CPU's instructions. It reads I/O devices' values as last read by the CPU
+// rather than reading the devices itself, takes the interrupts the CPU
+// takes, and its writes to I/O are compared but go no further. Only the
+// accesses the CPU's instructions make, as told by their Effects, are
+// mirrored and compared; other monitors' writes to memory, e.g. the
+// debugger's, are copied to the shadow's memory without being compared.
+// Cycles spent waiting for an interrupt after WAI, and the stack writes of
+// interrupts, aren't compared.
+type Lockstep struct {
+	// Shadow is the second core. NewLockstep configures it as the CPU, but
+	// with the other of the fast and cycle-stepped cores. It may be
+	// reconfigured before the CPU runs, e.g. to compare variants.
+	Shadow *Cpu
+
+	cpu     *Cpu
+	mirror  *mirror
+	started bool
+	halted  bool
+	in      Instruction // the CPU's previous instruction.
+	pc      uint16      // the address of in.
+	writes  []write     // the CPU's writes executing in.
+}
+
+// A DivergenceError is a difference between the CPU and Lockstep's shadow
+// after the instruction at PC.
+type DivergenceError struct {
+	PC          uint16
+	Instruction Instruction
+	Diffs       []string
+}
+
+func (e *DivergenceError) Error() string {
+	return fmt.Sprintf("Lockstep diverged after $%04X %v:\n\t%s",
+		e.PC, e.Instruction, strings.Join(e.Diffs, "\n\t"))
+}
+
+type write struct {
+	address uint16
+	value   byte
+}
+
+// mirror is the shadow's memory: a copy of the CPU's inert memory, e.g. RAM
+// and ROM, and the values last read from the rest.
+type mirror struct {
+	inert    [0x10000]bool
+	data     [0x10000]byte
+	lastRead [0x10000]byte
+	writes   []write
+}
+
+func (m *mirror) Read(a uint16) byte {
+	if m.inert[a] {
+		return m.data[a]
+	}
+	return m.lastRead[a]
+}
+
+func (m *mirror) Write(a uint16, value byte) {
+	if m.inert[a] {
+		m.data[a] = value
+	}
+	m.writes = append(m.writes, write{a, value})
+}
+
+func (m *mirror) Size() int { return len(m.data) }
+
+func (m *mirror) Shutdown() {}
+
+// NewLockstep returns a Lockstep to be attached to c as its Monitor.
+func NewLockstep(c *Cpu) *Lockstep {
+	m := &mirror{}
+	b, _ := bus.CreateBus()
+	b.Attach(m, "mirror", 0x0000)
+	return &Lockstep{
+		Shadow: &Cpu{
+			Bus:           b,
+			Variant:       c.Variant,
+			CycleAccurate: !c.CycleAccurate,
+			FaultPolicy:   FaultIgnore,
+		},
+		cpu:    c,
+		mirror: m,
+	}
+}
+
+// BeforeExecute steps the shadow through the CPU's previous instruction and
+// compares them.
+func (l *Lockstep) BeforeExecute(in Instruction) {
+	if l.halted {
+		return
+	}
+	if !l.started {
+		l.start()
+	} else if diffs := l.catchUp(); len(diffs) > 0 {
+		l.halted = true
+		l.cpu.Halt(&DivergenceError{PC: l.pc, Instruction: l.in, Diffs: diffs})
+		return
+	}
+	l.in, l.pc = in, l.cpu.PC
+	l.writes = l.writes[:0]
+	l.mirror.writes = l.mirror.writes[:0]
+}
+
+// AfterExecute mirrors the values the CPU read executing in, and records its
+// writes to compare with the shadow's.
+func (l *Lockstep) AfterExecute(in Instruction, e *Effects) {
+	if l.halted {
+		return
+	}
+	for _, access := range e.Accesses {
+		if access.Write {
+			l.writes = append(l.writes, write{access.Address, access.Data})
+		} else {
+			l.mirror.lastRead[access.Address] = access.Data
+		}
+	}
+}
+
+// Shutdown meets the Monitor interface.
+func (l *Lockstep) Shutdown() {
+}
+
+// start copies the CPU's state and memory to the shadow.
+func (l *Lockstep) start() {
+	c, s, m := l.cpu, l.Shadow, l.mirror
+	for a := 0; a < len(m.data); a++ {
+		m.data[a], m.inert[a] = c.Bus.Peek(uint16(a))
+	}
+	c.Bus.ObserveWrites(func(a uint16, value byte) {
+		if c.monitoring && m.inert[a] {
+			m.data[a] = value
+		}
+	})
+	s.PC, s.AC, s.X, s.Y, s.SP, s.SR = c.PC, c.AC, c.X, c.Y, c.SP, c.SR
+	s.Cycles = c.fetchCycles
+	l.started = true
+}
+
+// catchUp steps the shadow through the CPU's previous instruction and any
+// interrupt taken since, returning how their states differ.
+func (l *Lockstep) catchUp() (diffs []string) {
+	c, s := l.cpu, l.Shadow
+	diff := func(format string, args ...any) {
+		diffs = append(diffs, fmt.Sprintf(format, args...))
+	}
+	if err := s.Step(); err != nil {
+		diff("Shadow: %v", err)
+	}
+	shadowWrites := finalWrites(l.mirror.writes)
+	waited := s.waiting
+	s.endWait()
+	if c.interrupted != 0 {
+		s.interrupt(c.interrupted, false)
+	}
+	if waited {
+		s.Cycles = c.fetchCycles
+	}
+
+	for _, reg := range []struct {
+		name        string
+		cpu, shadow uint16
+	}{
+		{"PC", c.PC, s.PC},
+		{"AC", uint16(c.AC), uint16(s.AC)},
+		{"X", uint16(c.X), uint16(s.X)},
+		{"Y", uint16(c.Y), uint16(s.Y)},
+		{"SP", uint16(c.SP), uint16(s.SP)},
+	} {
+		if reg.cpu != reg.shadow {
+			diff("%s: $%02X, shadow $%02X", reg.name, reg.cpu, reg.shadow)
+		}
+	}
+	if c.SR != s.SR {
+		diff("SR: %s, shadow %s", c.statusString(), s.statusString())
+	}
+	if c.fetchCycles != s.Cycles {
+		diff("Cycles: %d, shadow %d", c.fetchCycles, s.Cycles)
+	}
+	if w := finalWrites(l.writes); w != shadowWrites {
+		diff("Writes: %s, shadow %s", w, shadowWrites)
+	}
+	return diffs
+}
+
+// finalWrites describes the value finally written to each address written,
+// in address order.
+func finalWrites(writes []write) string {
+	final := make(map[uint16]byte, len(writes))
+	for _, w := range writes {
+		final[w.address] = w.value
+	}
+	addresses := make([]uint16, 0, len(final))
+	for a := range final {
+		addresses = append(addresses, a)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+	parts := make([]string, len(addresses))
+	for i, a := range addresses {
+		parts[i] = fmt.Sprintf("$%04X=$%02X", a, final[a])
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, " ")
+}
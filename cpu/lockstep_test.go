@@ -0,0 +1,122 @@
+package cpu
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pda/go6502/bus"
+	"github.com/pda/go6502/memory"
+)
+
+func TestLockstepAgrees(t *testing.T) {
+	for _, accurate := range []bool{false, true} {
+		c := createInterruptCpu()
+		c.CycleAccurate = accurate
+		c.SR = 0x30
+		c.Bus.Write(0x0301, 0x40)         // RTI
+		c.Bus.Write(programStart+3, 0xE6) // INC $10
+		c.Bus.Write(programStart+4, 0x10)
+		c.AttachMonitor(NewLockstep(c))
+		for i := 0; i < 20; i++ {
+			c.SetIRQ("test", i == 5)
+			if err := c.Step(); err != nil {
+				t.Fatalf("step %d, accurate %v: %v", i, accurate, err)
+			}
+		}
+		if c.Bus.Read(0x01FF) != 0x02 {
+			t.Error("expected IRQ to have been taken")
+		}
+	}
+}
+
+func TestLockstepDiverges(t *testing.T) {
+	c := createCpu()
+	c.Variant = NMOS6502X
+	c.PC = programStart
+	c.Bus.Write(programStart, 0xEA)   // NOP
+	c.Bus.Write(programStart+1, 0x1A) // NOP on 6502X, INC A on 65C02.
+	c.Bus.Write(programStart+2, 0xEA) // NOP
+	l := NewLockstep(c)
+	l.Shadow.Variant = CMOS65C02
+	c.AttachMonitor(l)
+
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = c.Step()
+	}
+	var diverged *DivergenceError
+	if !errors.As(err, &diverged) {
+		t.Fatalf("expected DivergenceError, got %v", err)
+	}
+	if diverged.PC != programStart+1 || len(diverged.Diffs) != 1 {
+		t.Errorf("expected AC to differ after $%04X, got %v", programStart+1, err)
+	}
+	if c.PC != programStart+2 {
+		t.Errorf("expected halt before $%04X, PC $%04X", programStart+2, c.PC)
+	}
+	if c.Step() != err {
+		t.Error("expected Step to keep returning DivergenceError")
+	}
+}
+
+func TestLockstepMirrorsReads(t *testing.T) {
+	b, _ := bus.CreateBus()
+	b.Attach(&memory.Ram{}, "ram", 0x0000)
+	b.Attach(&memory.Ram{}, "ram", 0x8000)
+	b.AttachOverlay(&counter{}, "counter", 0xFF00) // shadows the upper RAM
+	c := &Cpu{Bus: b}
+	c.Reset()
+	c.PC = programStart
+	for i := uint16(0); i < 4; i++ {
+		c.Bus.Write(programStart+i*3, 0xAD) // LDA $FF00
+		c.Bus.Write16(programStart+i*3+1, 0xFF00)
+	}
+	c.AttachMonitor(NewLockstep(c))
+	for i := 0; i < 4; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// patcher is a Monitor which reads I/O, and patches the next instruction
+// before the CPU's first, as the debugger might.
+type patcher struct {
+	c       *Cpu
+	patched bool
+}
+
+func (p *patcher) BeforeExecute(in Instruction) {
+	p.c.Bus.Read(0xFF00)
+	if !p.patched {
+		p.c.Bus.Write(p.c.PC+3, 0xE8) // INX
+		p.patched = true
+	}
+}
+
+func (p *patcher) Shutdown() {}
+
+func TestLockstepIgnoresMonitorsAccesses(t *testing.T) {
+	b, _ := bus.CreateBus()
+	b.Attach(&memory.Ram{}, "ram", 0x0000)
+	b.Attach(&memory.Ram{}, "ram", 0x8000)
+	b.AttachOverlay(&counter{}, "counter", 0xFF00)
+	for _, accurate := range []bool{false, true} {
+		c := &Cpu{Bus: b, CycleAccurate: accurate}
+		c.PC = programStart
+		c.Bus.Write(programStart, 0xAD) // LDA $FF00
+		c.Bus.Write16(programStart+1, 0xFF00)
+		c.Bus.Write(programStart+3, 0xEA) // NOP, patched to INX.
+		c.Bus.Write(programStart+4, 0xEA) // NOP
+		c.AttachMonitor(&patcher{c: c})
+		c.AttachMonitor(NewLockstep(c))
+		for i := 0; i < 3; i++ {
+			if err := c.Step(); err != nil {
+				t.Fatalf("step %d, accurate %v: %v", i, accurate, err)
+			}
+		}
+		if c.X != 1 {
+			t.Errorf("expected patched INX to run, X $%02X", c.X)
+		}
+	}
+}
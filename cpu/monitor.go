@@ -0,0 +1,83 @@
+package cpu
+
+// An ExecuteMonitor is a Monitor which is also told what each instruction
+// did, after it executes; e.g. a tracer, profiler or coverage tool.
+type ExecuteMonitor interface {
+	Monitor
+	AfterExecute(Instruction, *Effects)
+}
+
+// Registers is a snapshot of the CPU's registers.
+type Registers struct {
+	PC uint16
+	AC byte
+	X  byte
+	Y  byte
+	SP byte
+	SR byte
+}
+
+// Registers returns a snapshot of the CPU's registers.
+func (c *Cpu) Registers() Registers {
+	return Registers{PC: c.PC, AC: c.AC, X: c.X, Y: c.Y, SP: c.SP, SR: c.SR}
+}
+
+// Effects are what an instruction did, as told to an ExecuteMonitor. They're
+// only valid until AfterExecute returns; the CPU reuses them.
+type Effects struct {
+	// Before and After are the registers either side of execution; Before.PC
+	// is the instruction's address.
+	Before, After Registers
+
+	// Cycles is Cpu.Cycles as the instruction began, after any interrupt
+	// taken before it.
+	Cycles uint64
+
+	// Address is the effective address of the instruction's memory operand,
+	// if HasAddress; the address read, written or indirectly jumped to.
+	Address    uint16
+	HasAddress bool
+
+	// Accesses are the bytes read and written executing the instruction, in
+	// order. The instruction's fetch, and dummy accesses made by the
+	// cycle-stepped core, aren't included.
+	Accesses []BusCycle
+}
+
+// FetchCycles is Cpu.Cycles as the instruction about to execute began, after
+// any interrupt taken before it; as Effects.Cycles, for monitors' use in
+// BeforeExecute, by which time the cycle-stepped core has counted the
+// instruction's fetch.
+func (c *Cpu) FetchCycles() uint64 {
+	return c.fetchCycles
+}
+
+// Halt stops the CPU as a fault does under FaultHalt: Step returns err until
+// reset. It's for monitors, e.g. to stop at a trace mismatch; called from
+// BeforeExecute, the instruction isn't executed. It mustn't be called while
+// the CPU is running on another goroutine.
+func (c *Cpu) Halt(err error) {
+	c.fault = err
+}
+
+// startEffects begins recording the effects of the instruction about to
+// execute.
+func (c *Cpu) startEffects() {
+	c.effects = Effects{
+		Before:   c.Registers(),
+		Cycles:   c.fetchCycles,
+		Accesses: c.effects.Accesses[:0],
+	}
+}
+
+// afterExecute tells ExecuteMonitors of the effects of in.
+func (c *Cpu) afterExecute(in Instruction) {
+	c.effects.After = c.Registers()
+	c.monitoring = true
+	for _, m := range c.monitors {
+		if m, ok := m.(ExecuteMonitor); ok {
+			m.AfterExecute(in, &c.effects)
+		}
+	}
+	c.monitoring = false
+}
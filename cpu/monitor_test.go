@@ -0,0 +1,113 @@
+package cpu
+
+import "testing"
+
+// effectsLog is an ExecuteMonitor which keeps copies of the effects it's told
+// of, and notes each call in a shared log.
+type effectsLog struct {
+	name    string
+	log     *[]string
+	effects []Effects
+}
+
+func (l *effectsLog) BeforeExecute(in Instruction) {
+	*l.log = append(*l.log, l.name+" before")
+}
+
+func (l *effectsLog) AfterExecute(in Instruction, e *Effects) {
+	*l.log = append(*l.log, l.name+" after")
+	e.Accesses = append([]BusCycle(nil), e.Accesses...)
+	l.effects = append(l.effects, *e)
+}
+
+func (l *effectsLog) Shutdown() {}
+
+func TestMonitorsCalledInOrder(t *testing.T) {
+	c := createCpu()
+	c.PC = programStart
+	c.Bus.Write(programStart, 0xEA) // NOP
+	var log []string
+	c.AttachMonitor(&effectsLog{name: "a", log: &log})
+	c.AttachMonitor(&faultLog{})
+	c.AttachMonitor(&effectsLog{name: "b", log: &log})
+	c.Step()
+
+	expected := []string{"a before", "b before", "a after", "b after"}
+	if len(log) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, log)
+	}
+	for i := range expected {
+		if log[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, log)
+		}
+	}
+}
+
+func TestAfterExecuteEffects(t *testing.T) {
+	for _, accurate := range []bool{false, true} {
+		c := createCpu()
+		c.CycleAccurate = accurate
+		c.PC = programStart
+		c.X = 0x01
+		for i, b := range []byte{
+			0xF6, 0x10, // INC $10,X
+			0xEA, // NOP
+		} {
+			c.Bus.Write(programStart+uint16(i), b)
+		}
+		c.Bus.Write(0x0011, 0x7F)
+		var log []string
+		l := &effectsLog{log: &log}
+		c.AttachMonitor(l)
+		c.Step()
+		c.Step()
+
+		inc := l.effects[0]
+		if inc.Before.PC != programStart || inc.After.PC != programStart+2 {
+			t.Errorf("expected PC $%04X before, $%04X after; got $%04X, $%04X",
+				programStart, programStart+2, inc.Before.PC, inc.After.PC)
+		}
+		if inc.Before.SR&0x80 != 0 || inc.After.SR&0x80 == 0 {
+			t.Error("expected N flag clear before and set after")
+		}
+		if !inc.HasAddress || inc.Address != 0x0011 {
+			t.Errorf("expected effective address $0011, got $%04X", inc.Address)
+		}
+
+		// The NMOS 6502's dummy write of the unmodified value isn't included.
+		expected := []BusCycle{
+			{Address: 0x0011, Data: 0x7F},
+			{Address: 0x0011, Data: 0x80, Write: true},
+		}
+		if len(inc.Accesses) != len(expected) {
+			t.Fatalf("accurate %v: expected accesses %v, got %v", accurate, expected, inc.Accesses)
+		}
+		for i := range expected {
+			if inc.Accesses[i] != expected[i] {
+				t.Errorf("accurate %v: expected accesses %v, got %v", accurate, expected, inc.Accesses)
+			}
+		}
+
+		nop := l.effects[1]
+		if nop.HasAddress || len(nop.Accesses) != 0 {
+			t.Errorf("expected NOP to have no memory effects, got %+v", nop)
+		}
+	}
+}
+
+func TestFaultTrapTellsEachFaultMonitor(t *testing.T) {
+	c := createCpu()
+	c.FaultPolicy = FaultTrap
+	c.PC = programStart
+	c.Bus.Write(programStart, 0x02) // illegal on the NMOS 6502
+	a, b := &faultLog{}, &faultLog{}
+	c.AttachMonitor(a)
+	c.AttachMonitor(b)
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.faults) != 1 || len(b.faults) != 1 {
+		t.Errorf("expected each monitor told of one fault, got %d and %d",
+			len(a.faults), len(b.faults))
+	}
+}
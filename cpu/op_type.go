@@ -18,6 +18,9 @@ const (
 	zeropage
 	zeropageX
 	zeropageY
+	zeropageIndirect
+	absoluteIndirectX
+	zeropageRelative
 )
 
 var addressingNames = [...]string{
@@ -35,15 +38,24 @@ var addressingNames = [...]string{
 	"zeropage",
 	"zeropageX",
 	"zeropageY",
+	"(zeropage)",
+	"(absolute,X)",
+	"zeropage,relative",
 }
 
-// adc..tya represent the 6502 instruction set mnemonics. Each mnemonic maps to
-// a number of different opcodes, depending on the addressing mode.
+// adc..wai represent the 6502 and 65C02 instruction set mnemonics, including
+// the undocumented NMOS instructions. Each mnemonic maps to a number of
+// different opcodes, depending on the addressing mode.
 const (
 	_ = iota
 	adc
+	alr
+	anc
 	and
+	arr
 	asl
+	bbr
+	bbs
 	bcc
 	bcs
 	beq
@@ -51,6 +63,7 @@ const (
 	bmi
 	bne
 	bpl
+	bra
 	brk
 	bvc
 	bvs
@@ -61,6 +74,7 @@ const (
 	cmp
 	cpx
 	cpy
+	dcp
 	dec
 	dex
 	dey
@@ -68,8 +82,12 @@ const (
 	inc
 	inx
 	iny
+	isc
+	jam
 	jmp
 	jsr
+	las
+	lax
 	lda
 	ldx
 	ldy
@@ -78,33 +96,54 @@ const (
 	ora
 	pha
 	php
+	phx
+	phy
 	pla
 	plp
+	plx
+	ply
+	rla
+	rmb
 	rol
 	ror
+	rra
 	rti
 	rts
+	sax
 	sbc
+	sbx
 	sec
 	sed
 	sei
+	slo
+	smb
+	sre
 	sta
+	stp
 	stx
 	sty
+	stz
 	tax
 	tay
+	trb
+	tsb
 	tsx
 	txa
 	txs
 	tya
-	_end
+	wai
 )
 
 var instructionNames = [...]string{
 	"",
 	"ADC",
+	"ALR",
+	"ANC",
 	"AND",
+	"ARR",
 	"ASL",
+	"BBR",
+	"BBS",
 	"BCC",
 	"BCS",
 	"BEQ",
@@ -112,6 +151,7 @@ var instructionNames = [...]string{
 	"BMI",
 	"BNE",
 	"BPL",
+	"BRA",
 	"BRK",
 	"BVC",
 	"BVS",
@@ -122,6 +162,7 @@ var instructionNames = [...]string{
 	"CMP",
 	"CPX",
 	"CPY",
+	"DCP",
 	"DEC",
 	"DEX",
 	"DEY",
@@ -129,8 +170,12 @@ var instructionNames = [...]string{
 	"INC",
 	"INX",
 	"INY",
+	"ISC",
+	"JAM",
 	"JMP",
 	"JSR",
+	"LAS",
+	"LAX",
 	"LDA",
 	"LDX",
 	"LDY",
@@ -139,26 +184,42 @@ var instructionNames = [...]string{
 	"ORA",
 	"PHA",
 	"PHP",
+	"PHX",
+	"PHY",
 	"PLA",
 	"PLP",
+	"PLX",
+	"PLY",
+	"RLA",
+	"RMB",
 	"ROL",
 	"ROR",
+	"RRA",
 	"RTI",
 	"RTS",
+	"SAX",
 	"SBC",
+	"SBX",
 	"SEC",
 	"SED",
 	"SEI",
+	"SLO",
+	"SMB",
+	"SRE",
 	"STA",
+	"STP",
 	"STX",
 	"STY",
+	"STZ",
 	"TAX",
 	"TAY",
+	"TRB",
+	"TSB",
 	"TSX",
 	"TXA",
 	"TXS",
 	"TYA",
-	"_END",
+	"WAI",
 }
 
 // OpType represents a 6502 op-code instruction, including the addressing
@@ -182,7 +243,9 @@ type OpType struct {
 	Bytes uint8
 
 	// Cycles is the number of times the system clock signal will rise and fall
-	// before the instruction is complete.
+	// before the instruction is complete. Indexed reads crossing a page
+	// boundary, taken branches, and 65C02 decimal arithmetic take longer;
+	// Cpu.Cycles accounts for those.
 	Cycles uint8
 }
 
@@ -190,16 +253,62 @@ func (ot OpType) String() string {
 	return fmt.Sprintf("%s %s", ot.Name(), addressingNames[ot.addressing])
 }
 
+// Addressing returns the name of the addressing mode, as shown by String,
+// e.g. "zeropageX" or "(indirect),Y".
+func (ot OpType) Addressing() string {
+	return addressingNames[ot.addressing]
+}
+
 // Name returns the instruction mnemonic name, e.g. ADC or TYA.
+// The bit instructions include their bit number, e.g. RMB3 or BBS7.
 func (ot OpType) Name() (s string) {
-	return instructionNames[ot.id]
+	s = instructionNames[ot.id]
+	if ot.isBitInstruction() {
+		s += fmt.Sprint(ot.bitNumber())
+	}
+	return
+}
+
+// isBitInstruction is true for the Rockwell bit manipulation instructions
+// BBR, BBS, RMB and SMB, which encode a bit number in their opcode.
+func (ot OpType) isBitInstruction() bool {
+	switch ot.id {
+	case bbr, bbs, rmb, smb:
+		return true
+	}
+	return false
+}
+
+// isShift is true for the shift and rotate instructions.
+func (ot OpType) isShift() bool {
+	switch ot.id {
+	case asl, lsr, rol, ror:
+		return true
+	}
+	return false
+}
+
+// bitNumber is the bit (0..7) operated on by a bit instruction.
+func (ot OpType) bitNumber() uint8 {
+	return ot.Opcode >> 4 & 7
 }
 
 func (ot OpType) IsAbsolute() bool {
 	return ot.addressing == absolute
 }
 
-var optypes = map[uint8]OpType{
+// An opTable is an instruction set, indexed by opcode. Opcodes outside the
+// instruction set have a zero OpType.
+type opTable [256]OpType
+
+// lookup returns the OpType for opcode, if it's in the instruction set.
+func (t *opTable) lookup(opcode uint8) (OpType, bool) {
+	ot := t[opcode]
+	return ot, ot.Bytes != 0
+}
+
+// optypes is the NMOS 6502 instruction set.
+var optypes = &opTable{
 	0x69: OpType{0x69, adc, immediate, 2, 2},
 	0x65: OpType{0x65, adc, zeropage, 2, 3},
 	0x75: OpType{0x75, adc, zeropageX, 2, 4},
@@ -252,7 +361,7 @@ var optypes = map[uint8]OpType{
 	0xCC: OpType{0xCC, cpy, absolute, 3, 4},
 	0xC6: OpType{0xC6, dec, zeropage, 2, 5},
 	0xD6: OpType{0xD6, dec, zeropageX, 2, 6},
-	0xCE: OpType{0xCE, dec, absolute, 3, 3},
+	0xCE: OpType{0xCE, dec, absolute, 3, 6},
 	0xDE: OpType{0xDE, dec, absoluteX, 3, 7},
 	0xCA: OpType{0xCA, dex, implied, 1, 2},
 	0x88: OpType{0x88, dey, implied, 1, 2},
@@ -308,7 +417,7 @@ var optypes = map[uint8]OpType{
 	0x48: OpType{0x48, pha, implied, 1, 3},
 	0x08: OpType{0x08, php, implied, 1, 3},
 	0x68: OpType{0x68, pla, implied, 1, 4},
-	0x28: OpType{0x28, php, implied, 1, 4},
+	0x28: OpType{0x28, plp, implied, 1, 4},
 	0x2A: OpType{0x2A, rol, accumulator, 1, 2},
 	0x26: OpType{0x26, rol, zeropage, 2, 5},
 	0x36: OpType{0x36, rol, zeropageX, 2, 6},
@@ -351,5 +460,212 @@ var optypes = map[uint8]OpType{
 	0x8A: OpType{0x8A, txa, implied, 1, 2},
 	0x9A: OpType{0x9A, txs, implied, 1, 2},
 	0x98: OpType{0x98, tya, implied, 1, 2},
-	0xFF: OpType{0xFF, _end, implied, 1, 1},
+}
+
+// illegalOptypes adds the stable undocumented opcodes to the NMOS 6502
+// instruction set.
+//
+// Opcodes whose results depend on analogue effects or vary between chips
+// (ANE $8B, LXA $AB, SHA $93/$9F, SHX $9E, SHY $9C, TAS $9B) are deliberately
+// left undecoded, so that programs using them fail as illegal opcodes
+// rather than silently diverging from some real hardware. The JAM opcodes,
+// which lock up the processor until reset, are decoded.
+var illegalOptypes = extendOptypes(optypes, []OpType{
+	OpType{0x4B, alr, immediate, 2, 2},
+	OpType{0x0B, anc, immediate, 2, 2},
+	OpType{0x2B, anc, immediate, 2, 2},
+	OpType{0x6B, arr, immediate, 2, 2},
+	OpType{0xC7, dcp, zeropage, 2, 5},
+	OpType{0xD7, dcp, zeropageX, 2, 6},
+	OpType{0xCF, dcp, absolute, 3, 6},
+	OpType{0xDF, dcp, absoluteX, 3, 7},
+	OpType{0xDB, dcp, absoluteY, 3, 7},
+	OpType{0xC3, dcp, indirectX, 2, 8},
+	OpType{0xD3, dcp, indirectY, 2, 8},
+	OpType{0xE7, isc, zeropage, 2, 5},
+	OpType{0xF7, isc, zeropageX, 2, 6},
+	OpType{0xEF, isc, absolute, 3, 6},
+	OpType{0xFF, isc, absoluteX, 3, 7},
+	OpType{0xFB, isc, absoluteY, 3, 7},
+	OpType{0xE3, isc, indirectX, 2, 8},
+	OpType{0xF3, isc, indirectY, 2, 8},
+	OpType{0xBB, las, absoluteY, 3, 4},
+	OpType{0xA7, lax, zeropage, 2, 3},
+	OpType{0xB7, lax, zeropageY, 2, 4},
+	OpType{0xAF, lax, absolute, 3, 4},
+	OpType{0xBF, lax, absoluteY, 3, 4},
+	OpType{0xA3, lax, indirectX, 2, 6},
+	OpType{0xB3, lax, indirectY, 2, 5},
+	OpType{0x27, rla, zeropage, 2, 5},
+	OpType{0x37, rla, zeropageX, 2, 6},
+	OpType{0x2F, rla, absolute, 3, 6},
+	OpType{0x3F, rla, absoluteX, 3, 7},
+	OpType{0x3B, rla, absoluteY, 3, 7},
+	OpType{0x23, rla, indirectX, 2, 8},
+	OpType{0x33, rla, indirectY, 2, 8},
+	OpType{0x67, rra, zeropage, 2, 5},
+	OpType{0x77, rra, zeropageX, 2, 6},
+	OpType{0x6F, rra, absolute, 3, 6},
+	OpType{0x7F, rra, absoluteX, 3, 7},
+	OpType{0x7B, rra, absoluteY, 3, 7},
+	OpType{0x63, rra, indirectX, 2, 8},
+	OpType{0x73, rra, indirectY, 2, 8},
+	OpType{0x87, sax, zeropage, 2, 3},
+	OpType{0x97, sax, zeropageY, 2, 4},
+	OpType{0x8F, sax, absolute, 3, 4},
+	OpType{0x83, sax, indirectX, 2, 6},
+	OpType{0xEB, sbc, immediate, 2, 2},
+	OpType{0xCB, sbx, immediate, 2, 2},
+	OpType{0x07, slo, zeropage, 2, 5},
+	OpType{0x17, slo, zeropageX, 2, 6},
+	OpType{0x0F, slo, absolute, 3, 6},
+	OpType{0x1F, slo, absoluteX, 3, 7},
+	OpType{0x1B, slo, absoluteY, 3, 7},
+	OpType{0x03, slo, indirectX, 2, 8},
+	OpType{0x13, slo, indirectY, 2, 8},
+	OpType{0x47, sre, zeropage, 2, 5},
+	OpType{0x57, sre, zeropageX, 2, 6},
+	OpType{0x4F, sre, absolute, 3, 6},
+	OpType{0x5F, sre, absoluteX, 3, 7},
+	OpType{0x5B, sre, absoluteY, 3, 7},
+	OpType{0x43, sre, indirectX, 2, 8},
+	OpType{0x53, sre, indirectY, 2, 8},
+
+	// NOPs which consume various numbers of bytes and cycles, reading
+	// but ignoring their operand.
+	OpType{0x1A, nop, implied, 1, 2},
+	OpType{0x3A, nop, implied, 1, 2},
+	OpType{0x5A, nop, implied, 1, 2},
+	OpType{0x7A, nop, implied, 1, 2},
+	OpType{0xDA, nop, implied, 1, 2},
+	OpType{0xFA, nop, implied, 1, 2},
+	OpType{0x80, nop, immediate, 2, 2},
+	OpType{0x82, nop, immediate, 2, 2},
+	OpType{0x89, nop, immediate, 2, 2},
+	OpType{0xC2, nop, immediate, 2, 2},
+	OpType{0xE2, nop, immediate, 2, 2},
+	OpType{0x04, nop, zeropage, 2, 3},
+	OpType{0x44, nop, zeropage, 2, 3},
+	OpType{0x64, nop, zeropage, 2, 3},
+	OpType{0x14, nop, zeropageX, 2, 4},
+	OpType{0x34, nop, zeropageX, 2, 4},
+	OpType{0x54, nop, zeropageX, 2, 4},
+	OpType{0x74, nop, zeropageX, 2, 4},
+	OpType{0xD4, nop, zeropageX, 2, 4},
+	OpType{0xF4, nop, zeropageX, 2, 4},
+	OpType{0x0C, nop, absolute, 3, 4},
+	OpType{0x1C, nop, absoluteX, 3, 4},
+	OpType{0x3C, nop, absoluteX, 3, 4},
+	OpType{0x5C, nop, absoluteX, 3, 4},
+	OpType{0x7C, nop, absoluteX, 3, 4},
+	OpType{0xDC, nop, absoluteX, 3, 4},
+	OpType{0xFC, nop, absoluteX, 3, 4},
+}, jamOptypes())
+
+// cmosOptypes is the 65C02 instruction set common to all manufacturers.
+var cmosOptypes = extendOptypes(optypes, []OpType{
+	OpType{0x72, adc, zeropageIndirect, 2, 5},
+	OpType{0x32, and, zeropageIndirect, 2, 5},
+	OpType{0x89, bit, immediate, 2, 2},
+	OpType{0x34, bit, zeropageX, 2, 4},
+	OpType{0x3C, bit, absoluteX, 3, 4},
+	OpType{0x80, bra, relative, 2, 2},
+	OpType{0xD2, cmp, zeropageIndirect, 2, 5},
+	OpType{0x3A, dec, accumulator, 1, 2},
+	OpType{0x52, eor, zeropageIndirect, 2, 5},
+	OpType{0x1A, inc, accumulator, 1, 2},
+	OpType{0x1E, asl, absoluteX, 3, 6},
+	OpType{0x5E, lsr, absoluteX, 3, 6},
+	OpType{0x3E, rol, absoluteX, 3, 6},
+	OpType{0x7E, ror, absoluteX, 3, 6},
+	OpType{0x6C, jmp, indirect, 3, 6},
+	OpType{0x7C, jmp, absoluteIndirectX, 3, 6},
+	OpType{0xB2, lda, zeropageIndirect, 2, 5},
+	OpType{0x12, ora, zeropageIndirect, 2, 5},
+	OpType{0xDA, phx, implied, 1, 3},
+	OpType{0x5A, phy, implied, 1, 3},
+	OpType{0xFA, plx, implied, 1, 4},
+	OpType{0x7A, ply, implied, 1, 4},
+	OpType{0xF2, sbc, zeropageIndirect, 2, 5},
+	OpType{0x92, sta, zeropageIndirect, 2, 5},
+	OpType{0x64, stz, zeropage, 2, 3},
+	OpType{0x74, stz, zeropageX, 2, 4},
+	OpType{0x9C, stz, absolute, 3, 4},
+	OpType{0x9E, stz, absoluteX, 3, 5},
+	OpType{0x14, trb, zeropage, 2, 5},
+	OpType{0x1C, trb, absolute, 3, 6},
+	OpType{0x04, tsb, zeropage, 2, 5},
+	OpType{0x0C, tsb, absolute, 3, 6},
+
+	// The 65C02 has no illegal opcodes; the unassigned ones are NOPs which
+	// consume various numbers of bytes and cycles.
+	OpType{0x02, nop, immediate, 2, 2},
+	OpType{0x22, nop, immediate, 2, 2},
+	OpType{0x42, nop, immediate, 2, 2},
+	OpType{0x62, nop, immediate, 2, 2},
+	OpType{0x82, nop, immediate, 2, 2},
+	OpType{0xC2, nop, immediate, 2, 2},
+	OpType{0xE2, nop, immediate, 2, 2},
+	OpType{0x44, nop, zeropage, 2, 3},
+	OpType{0x54, nop, zeropageX, 2, 4},
+	OpType{0xD4, nop, zeropageX, 2, 4},
+	OpType{0xF4, nop, zeropageX, 2, 4},
+	OpType{0x5C, nop, absolute, 3, 8},
+	OpType{0xDC, nop, absolute, 3, 4},
+	OpType{0xFC, nop, absolute, 3, 4},
+}, cmosSingleByteNops(0x03, 0x0B, 0x07, 0x0F))
+
+// rockwellOptypes adds the Rockwell bit manipulation instructions to the
+// 65C02 instruction set.
+var rockwellOptypes = extendOptypes(cmosOptypes, bitOptypes())
+
+// wdcOptypes adds the WDC low power instructions to the Rockwell 65C02
+// instruction set.
+var wdcOptypes = extendOptypes(rockwellOptypes, []OpType{
+	OpType{0xCB, wai, implied, 1, 3},
+	OpType{0xDB, stp, implied, 1, 3},
+})
+
+// extendOptypes returns a copy of base, with additions added or replacing
+// existing opcodes.
+func extendOptypes(base *opTable, additions ...[]OpType) *opTable {
+	result := *base
+	for _, list := range additions {
+		for _, ot := range list {
+			result[ot.Opcode] = ot
+		}
+	}
+	return &result
+}
+
+// cmosSingleByteNops returns one-byte one-cycle NOPs for every opcode with
+// the given low nibbles.
+func cmosSingleByteNops(lowNibbles ...uint8) (result []OpType) {
+	for _, lo := range lowNibbles {
+		for hi := uint8(0); hi < 0x10; hi++ {
+			result = append(result, OpType{hi<<4 | lo, nop, implied, 1, 1})
+		}
+	}
+	return
+}
+
+// jamOptypes returns the NMOS opcodes which lock up the processor.
+func jamOptypes() (result []OpType) {
+	for _, opcode := range []uint8{0x02, 0x12, 0x22, 0x32, 0x42, 0x52, 0x62, 0x72, 0x92, 0xB2, 0xD2, 0xF2} {
+		result = append(result, OpType{opcode, jam, implied, 1, 1})
+	}
+	return
+}
+
+// bitOptypes returns RMB, SMB, BBR and BBS for each of bits 0..7.
+func bitOptypes() (result []OpType) {
+	for bit := uint8(0); bit < 8; bit++ {
+		result = append(result,
+			OpType{0x07 | bit<<4, rmb, zeropage, 2, 5},
+			OpType{0x87 | bit<<4, smb, zeropage, 2, 5},
+			OpType{0x0F | bit<<4, bbr, zeropageRelative, 3, 5},
+			OpType{0x8F | bit<<4, bbs, zeropageRelative, 3, 5},
+		)
+	}
+	return
 }
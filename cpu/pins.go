@@ -0,0 +1,45 @@
+package cpu
+
+// waiSource is the source name under which WAI holds RDY low.
+const waiSource = "WAI"
+
+// SetSO asserts or releases the SO (set overflow) input on behalf of the
+// named source. SO is edge-triggered: the overflow flag is set before the
+// next instruction each time the line goes from released to asserted, which
+// lets a device signal a tight BVC polling loop without a bus access.
+func (c *Cpu) SetSO(source string, asserted bool) {
+	if c.so.set(source, asserted) {
+		c.soPending.Store(true)
+	}
+}
+
+// SetRDY holds the RDY input low (asserted) or releases it on behalf of the
+// named source. While RDY is low the CPU halts between instructions, with
+// Step spending a cycle without executing anything, e.g. to single-step the
+// board or wait for slow memory. RDY is bidirectional on the 65C02: WAI
+// holds it low itself until an interrupt or reset ends the wait.
+func (c *Cpu) SetRDY(source string, asserted bool) {
+	c.rdy.set(source, asserted)
+}
+
+// Ready returns true unless RDY is held low, by a source or by WAI.
+func (c *Cpu) Ready() bool {
+	return !c.rdy.asserted.Load()
+}
+
+// SetRESB asserts or releases the RESB (reset) input on behalf of the named
+// source. While it's asserted the CPU is held in reset, with Step spending
+// a cycle without executing anything. Once released, the CPU resets as for
+// Reset before its next instruction, recovering from STP, WAI and faults;
+// asserting it even briefly resets the CPU.
+func (c *Cpu) SetRESB(source string, asserted bool) {
+	if c.resb.set(source, asserted) {
+		c.resetting.Store(true)
+	}
+}
+
+// endWait ends the wait started by WAI, releasing RDY.
+func (c *Cpu) endWait() {
+	c.waiting = false
+	c.rdy.set(waiSource, false)
+}
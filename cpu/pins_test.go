@@ -0,0 +1,96 @@
+package cpu
+
+import "testing"
+
+func TestSoSetsOverflowOnEdge(t *testing.T) {
+	c := createInterruptCpu()
+	c.SR = 0x30
+	c.SetSO("test", true)
+	c.Step()
+	if !c.getStatus(sOverflow) {
+		t.Fatal("expected SO to set V")
+	}
+
+	// Held asserted, SO doesn't set V again once cleared.
+	c.setStatus(sOverflow, false)
+	c.Step()
+	if c.getStatus(sOverflow) {
+		t.Error("expected SO to set V only on its asserting edge")
+	}
+	c.SetSO("test", false)
+	c.SetSO("test", true)
+	c.Step()
+	if !c.getStatus(sOverflow) {
+		t.Error("expected SO to set V on its next asserting edge")
+	}
+}
+
+func TestRdyHalts(t *testing.T) {
+	c := createInterruptCpu()
+	c.SetRDY("test", true)
+	cycles := c.Cycles
+	c.Step()
+	c.Step()
+	if c.PC != programStart || c.Cycles != cycles+2 {
+		t.Errorf("expected two idle cycles at $%04X, PC $%04X after %d cycles",
+			programStart, c.PC, c.Cycles-cycles)
+	}
+	if c.Ready() {
+		t.Error("expected Ready false while RDY is held low")
+	}
+	c.SetRDY("test", false)
+	c.Step()
+	if c.PC != programStart+1 {
+		t.Errorf("expected NOP executed once RDY released, PC $%04X", c.PC)
+	}
+}
+
+func TestWaiHoldsRdy(t *testing.T) {
+	c := createInterruptCpu()
+	c.Variant = WDC65C02
+	c.SR = 0x34
+	c.Bus.Write(programStart, 0xCB) // WAI
+	c.Step()
+	if c.Ready() {
+		t.Error("expected WAI to hold RDY low")
+	}
+
+	// An external hold on RDY outlasts the wait.
+	c.SetRDY("test", true)
+	c.SetIRQ("test", true)
+	c.Step()
+	if c.PC != programStart+1 {
+		t.Errorf("expected RDY to halt after WAI released, PC $%04X", c.PC)
+	}
+	c.SetRDY("test", false)
+	if !c.Ready() {
+		t.Error("expected RDY released once the wait and the external hold end")
+	}
+	c.Step()
+	if c.PC != programStart+2 {
+		t.Errorf("expected execution to resume, PC $%04X", c.PC)
+	}
+}
+
+func TestResbHoldsInReset(t *testing.T) {
+	c := createInterruptCpu()
+	c.Variant = WDC65C02
+	c.Bus.Write16(ResetVector, 0x0300)
+	c.Bus.Write(programStart, 0xDB) // STP
+	c.Step()
+
+	c.SetRESB("test", true)
+	c.Step()
+	c.Step()
+	if c.PC != programStart+1 {
+		t.Errorf("expected no progress in reset, PC $%04X", c.PC)
+	}
+	c.SetRESB("test", false)
+	c.Step()
+	if c.PC != 0x0301 {
+		t.Errorf("expected reset then handler's NOP, PC $%04X", c.PC)
+	}
+	if c.SR&(1<<sInterrupt) == 0 {
+		t.Error("expected reset to set the I flag")
+	}
+}
@@ -0,0 +1,170 @@
+package cpu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrRunning is returned by the Run methods when the CPU is already running.
+var ErrRunning = errors.New("CPU is already running")
+
+// ExitError is returned once the program has exited, e.g. by writing to a
+// host services device, or by a debugger calling Cpu.Exit.
+type ExitError struct {
+	Status int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("Exit status %d", e.Status)
+}
+
+// runState coordinates a run loop with Pause, Resume and Exit called from
+// other goroutines.
+type runState struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pause   atomic.Bool // checked by the run loop between instructions.
+	running bool        // a run loop is active.
+	parked  bool        // the run loop is blocked, paused.
+	exit    atomic.Pointer[ExitError]
+}
+
+func (s *runState) wait() {
+	if s.cond == nil {
+		s.cond = sync.NewCond(&s.mu)
+	}
+	s.cond.Wait()
+}
+
+func (s *runState) broadcast() {
+	if s.cond != nil {
+		s.cond.Broadcast()
+	}
+}
+
+// Run executes instructions until ctx is done, returning its error, or until
+// the CPU halts on a fault or exits, returning a fault or ExitError.
+// Only one Run, RunCycles or RunUntil may be active at a time, and Step
+// mustn't be called meanwhile.
+func (c *Cpu) Run(ctx context.Context) error {
+	return c.run(ctx, func() bool { return false })
+}
+
+// RunCycles runs as for Run until at least n more cycles have elapsed,
+// finishing the instruction in progress, then returns nil.
+func (c *Cpu) RunCycles(ctx context.Context, n uint64) error {
+	var (
+		started bool
+		end     uint64
+	)
+	return c.run(ctx, func() bool {
+		if !started {
+			started, end = true, c.Cycles+n
+		}
+		return c.Cycles >= end
+	})
+}
+
+// RunUntil runs as for Run until done returns true, then returns nil.
+// done is called between instructions, including before the first, and may
+// inspect the CPU.
+func (c *Cpu) RunUntil(ctx context.Context, done func(*Cpu) bool) error {
+	return c.run(ctx, func() bool { return done(c) })
+}
+
+func (c *Cpu) run(ctx context.Context, done func() bool) error {
+	s := &c.runState
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return ErrRunning
+	}
+	s.running = true
+	s.mu.Unlock()
+
+	// Wake the loop if ctx is done while it's paused.
+	finished := make(chan struct{})
+	defer func() {
+		close(finished)
+		s.mu.Lock()
+		s.running = false
+		s.broadcast()
+		s.mu.Unlock()
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.broadcast()
+			s.mu.Unlock()
+		case <-finished:
+		}
+	}()
+
+	for {
+		if s.pause.Load() {
+			s.mu.Lock()
+			s.parked = true
+			s.broadcast()
+			for s.pause.Load() && ctx.Err() == nil {
+				s.wait()
+			}
+			s.parked = false
+			s.mu.Unlock()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if done() {
+			return nil
+		}
+		if err := c.Step(); err != nil {
+			return err
+		}
+	}
+}
+
+// Pause stops a run loop between instructions, blocking until it has
+// stopped, after which the CPU's state may be read and modified safely.
+// If no run loop is active, the next one will wait for Resume before
+// executing anything. Pause may be called from any goroutine, but not from
+// a Monitor, which is already called between instructions.
+func (c *Cpu) Pause() {
+	s := &c.runState
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pause.Store(true)
+	for s.running && !s.parked {
+		s.wait()
+	}
+}
+
+// Resume continues a run loop stopped by Pause.
+// It may be called from any goroutine.
+func (c *Cpu) Resume() {
+	s := &c.runState
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pause.Store(false)
+	s.broadcast()
+}
+
+// Exit stops the CPU as the program exiting with the given status. The
+// current instruction completes, then Step returns an ExitError until reset.
+// It may be called from any goroutine, including from a Monitor.
+func (c *Cpu) Exit(status int) {
+	c.runState.exit.CompareAndSwap(nil, &ExitError{Status: status})
+}
+
+// exited returns the ExitError if the program has exited.
+func (c *Cpu) exited() error {
+	if e := c.runState.exit.Load(); e != nil {
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package cpu
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// createLoopCpu returns a CPU running an endless loop at programStart which
+// increments the byte at $0010.
+func createLoopCpu() *Cpu {
+	c := createCpu()
+	c.PC = programStart
+	for i, b := range []byte{0xE6, 0x10, 0x4C, 0x00, 0x02} { // INC $10; JMP $0200
+		c.Bus.Write(programStart+uint16(i), b)
+	}
+	return c
+}
+
+func TestRunCycles(t *testing.T) {
+	c := createLoopCpu()
+	start := c.Cycles
+	if err := c.RunCycles(context.Background(), 100); err != nil {
+		t.Fatal(err)
+	}
+	// Each iteration is 8 cycles; INC zp 5, JMP abs 3.
+	if cycles := c.Cycles - start; cycles < 100 || cycles > 104 {
+		t.Errorf("expected 100 to 104 cycles, got %d", cycles)
+	}
+}
+
+func TestRunUntil(t *testing.T) {
+	c := createLoopCpu()
+	err := c.RunUntil(context.Background(), func(c *Cpu) bool {
+		return c.Bus.Read(0x0010) == 10
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.PC != programStart+2 {
+		t.Errorf("expected to stop after INC, PC $%04X", c.PC)
+	}
+}
+
+func TestRunStopsOnExit(t *testing.T) {
+	c := createCpu()
+	c.PC = programStart
+	c.Bus.Write(programStart, 0xEA) // NOP
+	c.Exit(3)
+
+	err := c.Run(context.Background())
+	var exit *ExitError
+	if !errors.As(err, &exit) || exit.Status != 3 {
+		t.Fatalf("expected exit status 3, got %v", err)
+	}
+	if c.Step() != err {
+		t.Error("expected Step to keep returning ExitError")
+	}
+	c.Reset()
+	c.PC = programStart
+	c.Bus.Write(programStart, 0xEA)
+	if err := c.Step(); err != nil {
+		t.Errorf("expected reset to clear exit, got %v", err)
+	}
+}
+
+func TestRunStopsOnFault(t *testing.T) {
+	c := createCpu()
+	c.PC = programStart
+	c.Bus.Write(programStart, 0x02)
+	var illegal *IllegalOpcodeError
+	if err := c.Run(context.Background()); !errors.As(err, &illegal) {
+		t.Errorf("expected IllegalOpcodeError, got %v", err)
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	c := createLoopCpu()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if err := c.Run(ctx); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	c := createLoopCpu()
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() { result <- c.Run(ctx) }()
+
+	time.Sleep(time.Millisecond)
+	c.Pause()
+	cycles, pc := c.Cycles, c.PC
+	if pc != programStart && pc != programStart+2 {
+		t.Errorf("expected to pause between instructions, PC $%04X", pc)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if c.Cycles != cycles {
+		t.Error("expected no progress while paused")
+	}
+	if err := c.RunCycles(ctx, 1); err != ErrRunning {
+		t.Errorf("expected ErrRunning, got %v", err)
+	}
+
+	for i := 0; c.Cycles == cycles; i++ {
+		if i == 1000 {
+			t.Fatal("expected progress after resuming")
+		}
+		c.Resume()
+		time.Sleep(time.Millisecond)
+		c.Pause()
+	}
+
+	// Cancelling releases a paused run.
+	cancel()
+	if err := <-result; err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestPauseBeforeRun(t *testing.T) {
+	c := createLoopCpu()
+	c.Pause()
+	result := make(chan error)
+	go func() { result <- c.RunCycles(context.Background(), 100) }()
+
+	time.Sleep(10 * time.Millisecond)
+	c.Pause()
+	if c.PC != programStart || c.Bus.Read(0x0010) != 0 {
+		t.Error("expected no progress before Resume")
+	}
+	c.Resume()
+	if err := <-result; err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,271 @@
+package cpu
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pda/go6502/bus"
+)
+
+// The single-step tests are per-opcode JSON vectors in the format of
+// https://github.com/SingleStepTests/65x02, each giving the state before and
+// after one instruction, and the bus cycles it makes. A few are checked in
+// under testdata/singlestep; see its README.md. The full corpus can be run
+// from a local copy:
+//
+//	go test ./cpu -run SingleStep -singlestep=/path/to/65x02
+
+var singleStepDir = flag.String("singlestep", "",
+	"directory of a SingleStepTests 65x02 corpus to run instead of testdata/singlestep")
+
+// singleStepVariants maps the corpus's directory names to variants.
+var singleStepVariants = map[string]Variant{
+	"6502":          NMOS6502X,
+	"synertek65c02": CMOS65C02,
+	"rockwell65c02": Rockwell65C02,
+	"wdc65c02":      WDC65C02,
+}
+
+// maxSingleStepFailures limits the failures reported for each opcode.
+const maxSingleStepFailures = 10
+
+type singleStepState struct {
+	PC  uint16      `json:"pc"`
+	S   byte        `json:"s"`
+	A   byte        `json:"a"`
+	X   byte        `json:"x"`
+	Y   byte        `json:"y"`
+	P   byte        `json:"p"`
+	RAM [][2]uint16 `json:"ram"` // address, value.
+}
+
+type singleStepTest struct {
+	Name    string            `json:"name"`
+	Initial singleStepState   `json:"initial"`
+	Final   singleStepState   `json:"final"`
+	Cycles  []singleStepCycle `json:"cycles"`
+}
+
+// singleStepCycle is a BusCycle, encoded as [address, data, "read"|"write"].
+type singleStepCycle BusCycle
+
+func (sc *singleStepCycle) UnmarshalJSON(b []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("Expected 3 fields in cycle, got %s", b)
+	}
+	var kind string
+	for i, v := range []any{&sc.Address, &sc.Data, &kind} {
+		if err := json.Unmarshal(fields[i], v); err != nil {
+			return err
+		}
+	}
+	switch kind {
+	case "read":
+		sc.Write = false
+	case "write":
+		sc.Write = true
+	default:
+		return fmt.Errorf("Unknown cycle type %q", kind)
+	}
+	return nil
+}
+
+func (sc singleStepCycle) String() string {
+	kind := "read"
+	if sc.Write {
+		kind = "write"
+	}
+	return fmt.Sprintf("%s $%02X @ $%04X", kind, sc.Data, sc.Address)
+}
+
+// flatMemory is 64K of RAM, covering the whole address space.
+type flatMemory [0x10000]byte
+
+func (m *flatMemory) Read(a uint16) byte         { return m[a] }
+func (m *flatMemory) Write(a uint16, value byte) { m[a] = value }
+func (m *flatMemory) Size() int                  { return len(m) }
+func (m *flatMemory) Shutdown()                  {}
+
+// cycleRecorder is a CycleObserver which keeps the cycles it's told of.
+type cycleRecorder []singleStepCycle
+
+func (r *cycleRecorder) Cycle(bc BusCycle) {
+	*r = append(*r, singleStepCycle(bc))
+}
+
+// singleStepRunner runs single-step tests against a flat 64K memory.
+type singleStepRunner struct {
+	cpu    *Cpu
+	cycles cycleRecorder
+}
+
+func newSingleStepRunner(v Variant) *singleStepRunner {
+	b, _ := bus.CreateBus()
+	b.Attach(&flatMemory{}, "ram", 0x0000)
+	r := &singleStepRunner{cpu: &Cpu{Bus: b, Variant: v}}
+	r.cpu.AttachCycleObserver(&r.cycles)
+	return r
+}
+
+// run runs test on the fast or cycle-accurate core, returning how the result
+// differed from the expected state.
+func (r *singleStepRunner) run(test *singleStepTest, accurate bool) []string {
+	c := r.cpu
+	c.CycleAccurate = accurate
+	c.Reset()
+	for _, rv := range test.Initial.RAM {
+		c.Bus.Write(rv[0], byte(rv[1]))
+	}
+	in := test.Initial
+	c.PC, c.SP, c.AC, c.X, c.Y = in.PC, in.S, in.A, in.X, in.Y
+	c.SR = in.P | 0x30 // bits 4 and 5 are always stored set.
+	r.cycles = r.cycles[:0]
+	start := c.Cycles
+
+	var diffs []string
+	diff := func(format string, args ...any) {
+		diffs = append(diffs, fmt.Sprintf(format, args...))
+	}
+	if err := c.Step(); err != nil {
+		diff("Step: %v", err)
+	}
+
+	f := test.Final
+	for _, reg := range []struct {
+		name        string
+		got, expect uint16
+	}{
+		{"PC", c.PC, f.PC},
+		{"S", uint16(c.SP), uint16(f.S)},
+		{"A", uint16(c.AC), uint16(f.A)},
+		{"X", uint16(c.X), uint16(f.X)},
+		{"Y", uint16(c.Y), uint16(f.Y)},
+	} {
+		if reg.got != reg.expect {
+			diff("%s $%02X, expected $%02X", reg.name, reg.got, reg.expect)
+		}
+	}
+	if (c.SR^f.P)&^0x30 != 0 {
+		diff("P $%02X, expected $%02X (ignoring bits 4 and 5)", c.SR, f.P)
+	}
+	for _, rv := range f.RAM {
+		if got := c.Bus.Read(rv[0]); got != byte(rv[1]) {
+			diff("RAM $%04X = $%02X, expected $%02X", rv[0], got, rv[1])
+		}
+	}
+	if cycles := c.Cycles - start; cycles != uint64(len(test.Cycles)) {
+		diff("%d cycles, expected %d", cycles, len(test.Cycles))
+	}
+	if accurate {
+		for i, sc := range test.Cycles {
+			if i >= len(r.cycles) {
+				diff("cycle %d: missing, expected %v", i, sc)
+				break
+			}
+			if r.cycles[i] != sc {
+				diff("cycle %d: %v, expected %v", i, r.cycles[i], sc)
+				break
+			}
+		}
+	}
+
+	// Zero memory for the next test.
+	for _, ram := range [][][2]uint16{test.Initial.RAM, test.Final.RAM} {
+		for _, rv := range ram {
+			c.Bus.Write(rv[0], 0)
+		}
+	}
+	for _, sc := range r.cycles {
+		c.Bus.Write(sc.Address, 0)
+	}
+	return diffs
+}
+
+// singleStepFiles returns the vector files for each variant in dir, which
+// holds a subdirectory per variant, in the corpus's layout.
+func singleStepFiles(t *testing.T, dir string) map[Variant][]string {
+	files := make(map[Variant][]string)
+	for name, v := range singleStepVariants {
+		for _, pattern := range []string{"*.json", filepath.Join("v1", "*.json")} {
+			matches, err := filepath.Glob(filepath.Join(dir, name, pattern))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(matches) > 0 {
+				files[v] = append(files[v], matches...)
+			}
+		}
+	}
+	return files
+}
+
+func TestSingleStep(t *testing.T) {
+	dir := filepath.Join("testdata", "singlestep")
+	if *singleStepDir != "" {
+		dir = *singleStepDir
+	}
+	found := singleStepFiles(t, dir)
+	if len(found) == 0 {
+		t.Fatalf("no single-step vectors in %s; see testdata/singlestep/README.md", dir)
+	}
+	for v, files := range found {
+		for _, path := range files {
+			v, path := v, path
+			opcode := strings.TrimSuffix(filepath.Base(path), ".json")
+			t.Run(fmt.Sprintf("%v/%s", v, opcode), func(t *testing.T) {
+				runSingleStepFile(t, v, path)
+			})
+		}
+	}
+}
+
+func runSingleStepFile(t *testing.T, v Variant, path string) {
+	opcode, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), ".json"), 16, 8)
+	if err != nil {
+		t.Fatalf("%s: expected the opcode in hex as the file name", path)
+	}
+	// e.g. the unstable opcodes the 6502X leaves undecoded, such as ANE.
+	if _, ok := v.Lookup(uint8(opcode)); !ok {
+		t.Skipf("skipping %s: opcode $%02X isn't decoded by %v", path, opcode, v)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests []singleStepTest
+	if err := json.Unmarshal(data, &tests); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	if len(tests) == 0 {
+		t.Fatalf("%s: no tests", path)
+	}
+
+	r := newSingleStepRunner(v)
+	failures := 0
+	for i := range tests {
+		for _, accurate := range []bool{false, true} {
+			diffs := r.run(&tests[i], accurate)
+			if len(diffs) == 0 {
+				continue
+			}
+			core := "fast"
+			if accurate {
+				core = "cycle-accurate"
+			}
+			t.Errorf("%q on %s core:\n\t%s", tests[i].Name, core, strings.Join(diffs, "\n\t"))
+			if failures++; failures == maxSingleStepFailures {
+				t.Fatalf("stopping after %d failures", failures)
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package cpu
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Variant identifies a member of the 6502 family. Variants differ in their
+// instruction sets and in some behavioural details, e.g. which flags are
+// valid after decimal mode arithmetic.
+type Variant uint8
+
+const (
+	// NMOS6502 is the original MOS Technology 6502.
+	// It's the zero value, so a Cpu is an NMOS 6502 unless set otherwise.
+	NMOS6502 Variant = iota
+
+	// NMOS6502X is the NMOS 6502 including its stable undocumented opcodes,
+	// e.g. LAX, SAX, DCP and ISC, as relied on by some third-party code.
+	NMOS6502X
+
+	// CMOS65C02 is the CMOS 65C02 instruction set common to all makers.
+	// It adds BRA, PHX/PHY/PLX/PLY, STZ, TRB/TSB, INC A/DEC A, (zp)
+	// addressing and more, fixes JMP ($xxFF), and sets N and Z validly in
+	// decimal mode.
+	CMOS65C02
+
+	// Rockwell65C02 adds the BBR, BBS, RMB and SMB bit instructions.
+	Rockwell65C02
+
+	// WDC65C02 is the WDC W65C02S, which adds WAI and STP to the Rockwell
+	// instruction set. pda6502 uses this processor.
+	WDC65C02
+)
+
+var variantNames = [...]string{
+	"6502",
+	"6502X",
+	"65C02",
+	"R65C02",
+	"W65C02",
+}
+
+func (v Variant) String() string {
+	if int(v) < len(variantNames) {
+		return variantNames[v]
+	}
+	return "unknown"
+}
+
+// ParseVariant returns the Variant named by s, as returned by
+// Variant.String, ignoring case.
+func ParseVariant(s string) (Variant, error) {
+	for i, name := range variantNames {
+		if strings.EqualFold(s, name) {
+			return Variant(i), nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown CPU variant %q; expected one of %s",
+		s, strings.Join(variantNames[:], ", "))
+}
+
+// isCmos is true for the 65C02 family and its derivatives.
+func (v Variant) isCmos() bool {
+	switch v {
+	case NMOS6502, NMOS6502X:
+		return false
+	}
+	return true
+}
+
+// Lookup returns the OpType for opcode, if it's in the variant's instruction
+// set.
+func (v Variant) Lookup(opcode uint8) (OpType, bool) {
+	return v.optypes().lookup(opcode)
+}
+
+// optypes returns the instruction set of the variant.
+func (v Variant) optypes() *opTable {
+	switch v {
+	case NMOS6502X:
+		return illegalOptypes
+	case CMOS65C02:
+		return cmosOptypes
+	case Rockwell65C02:
+		return rockwellOptypes
+	case WDC65C02:
+		return wdcOptypes
+	default:
+		return optypes
+	}
+}
@@ -0,0 +1,245 @@
+package cpu
+
+import "testing"
+
+func TestParseVariant(t *testing.T) {
+	for _, v := range []Variant{NMOS6502, NMOS6502X, CMOS65C02, Rockwell65C02, WDC65C02} {
+		parsed, err := ParseVariant(v.String())
+		if err != nil || parsed != v {
+			t.Errorf("ParseVariant(%q) = %v, %v", v.String(), parsed, err)
+		}
+	}
+	if v, err := ParseVariant("w65c02"); err != nil || v != WDC65C02 {
+		t.Errorf("expected case-insensitive parse, got %v, %v", v, err)
+	}
+	if _, err := ParseVariant("z80"); err == nil {
+		t.Error("expected error for unknown variant")
+	}
+}
+
+func TestInstructionSets(t *testing.T) {
+	tests := []struct {
+		variant Variant
+		opcode  uint8
+		name    string
+	}{
+		{NMOS6502X, 0xFF, "ISC"},
+		{CMOS65C02, 0xFF, "NOP"},
+		{CMOS65C02, 0x80, "BRA"},
+		{CMOS65C02, 0x07, "NOP"},
+		{CMOS65C02, 0xCB, "NOP"},
+		{Rockwell65C02, 0x07, "RMB0"},
+		{Rockwell65C02, 0xF7, "SMB7"},
+		{Rockwell65C02, 0x2F, "BBR2"},
+		{Rockwell65C02, 0xFF, "BBS7"},
+		{Rockwell65C02, 0xCB, "NOP"},
+		{WDC65C02, 0xCB, "WAI"},
+		{WDC65C02, 0xDB, "STP"},
+	}
+	for _, test := range tests {
+		ot, ok := test.variant.optypes().lookup(test.opcode)
+		if !ok || ot.Name() != test.name {
+			t.Errorf("%v $%02X: expected %s got %s", test.variant, test.opcode, test.name, ot.Name())
+		}
+	}
+
+	for _, opcode := range []uint8{0x80, 0xDA, 0x64, 0x72} {
+		if _, ok := optypes.lookup(opcode); ok {
+			t.Errorf("NMOS 6502 shouldn't decode 65C02 opcode $%02X", opcode)
+		}
+	}
+	for _, variant := range []Variant{CMOS65C02, Rockwell65C02, WDC65C02} {
+		for opcode := 0; opcode < 256; opcode++ {
+			if _, ok := variant.optypes().lookup(uint8(opcode)); !ok {
+				t.Errorf("expected %v to decode all opcodes, missing $%02X", variant, opcode)
+			}
+		}
+	}
+}
+
+func TestCmosInstructions(t *testing.T) {
+	runInstructionTests(t, []instructionTest{
+		{
+			name:    "BRA",
+			variant: CMOS65C02,
+			program: []byte{0x80, 0x7F},
+			before:  registers{SR: 0x30},
+			after:   registers{PC: 0x0281, SR: 0x30},
+		},
+		{
+			name:    "PHX PHY PLA PLA",
+			variant: CMOS65C02,
+			program: []byte{0xDA, 0x5A, 0x68, 0x68},
+			steps:   4,
+			before:  registers{X: 0x80, Y: 0x01, SP: 0xFF, SR: 0x30},
+			after:   registers{PC: 0x0204, AC: 0x80, X: 0x80, Y: 0x01, SP: 0xFF, SR: 0xB0},
+		},
+		{
+			name:    "PLX PLY",
+			variant: CMOS65C02,
+			program: []byte{0xFA, 0x7A},
+			steps:   2,
+			before:  registers{SP: 0xFD, SR: 0x30},
+			memory:  map[uint16]byte{0x01FE: 0x00, 0x01FF: 0x90},
+			after:   registers{PC: 0x0202, X: 0x00, Y: 0x90, SP: 0xFF, SR: 0xB0},
+		},
+		{
+			name:    "STZ absolute,X",
+			variant: CMOS65C02,
+			program: []byte{0x9E, 0x00, 0x03},
+			before:  registers{X: 0x05, SR: 0x30},
+			memory:  map[uint16]byte{0x0305: 0xFF},
+			after:   registers{PC: 0x0203, X: 0x05, SR: 0x30},
+			expect:  map[uint16]byte{0x0305: 0x00},
+		},
+		{
+			name:    "TSB",
+			variant: CMOS65C02,
+			program: []byte{0x04, 0x10},
+			before:  registers{AC: 0x0F, SR: 0x30},
+			memory:  map[uint16]byte{0x0010: 0xF0},
+			after:   registers{PC: 0x0202, AC: 0x0F, SR: 0x32},
+			expect:  map[uint16]byte{0x0010: 0xFF},
+		},
+		{
+			name:    "TRB",
+			variant: CMOS65C02,
+			program: []byte{0x1C, 0x00, 0x03},
+			before:  registers{AC: 0x81, SR: 0x32},
+			memory:  map[uint16]byte{0x0300: 0x83},
+			after:   registers{PC: 0x0203, AC: 0x81, SR: 0x30},
+			expect:  map[uint16]byte{0x0300: 0x02},
+		},
+		{
+			name:    "INC A, DEC A",
+			variant: CMOS65C02,
+			program: []byte{0x1A, 0x3A, 0x3A},
+			steps:   3,
+			before:  registers{AC: 0x00, SR: 0x30},
+			after:   registers{PC: 0x0203, AC: 0xFF, SR: 0xB0},
+		},
+		{
+			name:    "LDA (zp)",
+			variant: CMOS65C02,
+			program: []byte{0xB2, 0x10},
+			before:  registers{Y: 0x10, SR: 0x30},
+			memory:  map[uint16]byte{0x0010: 0x00, 0x0011: 0x03, 0x0300: 0x42},
+			after:   registers{PC: 0x0202, AC: 0x42, Y: 0x10, SR: 0x30},
+		},
+		{
+			name:    "STA (zp)",
+			variant: CMOS65C02,
+			program: []byte{0x92, 0xFF},
+			before:  registers{AC: 0x99, SR: 0x30},
+			memory:  map[uint16]byte{0x00FF: 0x34, 0x0000: 0x03},
+			after:   registers{PC: 0x0202, AC: 0x99, SR: 0x30},
+			expect:  map[uint16]byte{0x0334: 0x99},
+		},
+		{
+			name:    "BIT immediate only sets Z",
+			variant: CMOS65C02,
+			program: []byte{0x89, 0xC0},
+			before:  registers{AC: 0x01, SR: 0x30},
+			after:   registers{PC: 0x0202, AC: 0x01, SR: 0x32},
+		},
+		{
+			name:    "BIT zp,X",
+			variant: CMOS65C02,
+			program: []byte{0x34, 0x10},
+			before:  registers{AC: 0x01, X: 0x01, SR: 0x30},
+			memory:  map[uint16]byte{0x0011: 0xC1},
+			after:   registers{PC: 0x0202, AC: 0x01, X: 0x01, SR: 0xF0},
+		},
+		{
+			name:    "JMP indirect crosses page",
+			variant: CMOS65C02,
+			program: []byte{0x6C, 0xFF, 0x03},
+			before:  registers{SR: 0x30},
+			memory:  map[uint16]byte{0x03FF: 0xCD, 0x0400: 0xAB, 0x0300: 0x56},
+			after:   registers{PC: 0xABCD, SR: 0x30},
+		},
+		{
+			name:    "JMP (abs,X)",
+			variant: CMOS65C02,
+			program: []byte{0x7C, 0x00, 0x03},
+			before:  registers{X: 0x04, SR: 0x30},
+			memory:  map[uint16]byte{0x0304: 0x00, 0x0305: 0x80},
+			after:   registers{PC: 0x8000, X: 0x04, SR: 0x30},
+		},
+		{
+			name:    "NOP zp,X consumes two bytes",
+			variant: CMOS65C02,
+			program: []byte{0x54, 0x10},
+			before:  registers{SR: 0x30},
+			after:   registers{PC: 0x0202, SR: 0x30},
+		},
+		{
+			name:    "RMB3 SMB0",
+			variant: Rockwell65C02,
+			program: []byte{0x37, 0x10, 0x87, 0x10},
+			steps:   2,
+			before:  registers{SR: 0x30},
+			memory:  map[uint16]byte{0x0010: 0xFE},
+			after:   registers{PC: 0x0204, SR: 0x30},
+			expect:  map[uint16]byte{0x0010: 0xF7},
+		},
+		{
+			name:    "BBR taken",
+			variant: Rockwell65C02,
+			program: []byte{0x1F, 0x10, 0x10},
+			before:  registers{SR: 0x30},
+			memory:  map[uint16]byte{0x0010: 0xFD},
+			after:   registers{PC: 0x0213, SR: 0x30},
+		},
+		{
+			name:    "BBR not taken",
+			variant: Rockwell65C02,
+			program: []byte{0x1F, 0x10, 0x10},
+			before:  registers{SR: 0x30},
+			memory:  map[uint16]byte{0x0010: 0x02},
+			after:   registers{PC: 0x0203, SR: 0x30},
+		},
+		{
+			name:    "BBS7 taken backwards",
+			variant: Rockwell65C02,
+			program: []byte{0xFF, 0x10, 0xFD},
+			before:  registers{SR: 0x30},
+			memory:  map[uint16]byte{0x0010: 0x80},
+			after:   registers{PC: 0x0200, SR: 0x30},
+		},
+	})
+}
+
+func TestStpAndWai(t *testing.T) {
+	c := createInterruptCpu()
+	c.Variant = WDC65C02
+	c.SR = 0x34
+	c.Bus.Write(programStart, 0xCB) // WAI
+	c.Step()
+	c.Step()
+	if c.PC != programStart+1 {
+		t.Errorf("expected WAI to wait, PC $%04X", c.PC)
+	}
+
+	// IRQ is disabled, so it isn't taken, but it releases WAI.
+	c.SetIRQ("test", true)
+	c.Step()
+	if c.PC != programStart+2 {
+		t.Errorf("expected WAI released without interrupt, PC $%04X", c.PC)
+	}
+	c.SetIRQ("test", false)
+
+	c.Bus.Write(programStart+2, 0xDB) // STP
+	c.Step()
+	c.SetIRQ("test", true)
+	c.Step()
+	if c.PC != programStart+3 {
+		t.Errorf("expected STP to stop until reset, PC $%04X", c.PC)
+	}
+	c.Bus.Write16(ResetVector, 0x0300)
+	c.Reset()
+	c.Step()
+	if c.PC != 0x0301 {
+		t.Errorf("expected reset to restart after STP, PC $%04X", c.PC)
+	}
+}
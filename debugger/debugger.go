@@ -8,33 +8,33 @@
 
 		$ go run go6502.go --via-ssd1306 --debug
 		CPU PC:0xF31F AC:0x00 X:0x00 Y:0x00 SP:0x00 SR:--_b-i--
-		Next: SEI implied
+		Next: SEI
 		$F31F> step
 		CPU PC:0xF320 AC:0x00 X:0x00 Y:0x00 SP:0x00 SR:--_b----
-		Next: LDX immediate $FF
+		Next: LDX #$FF
 		$F320> break-register X $FF
 		Breakpoint set: X = $FF (255)
 		$F320> continue
 		Breakpoint for X = $FF (255)
 		CPU PC:0xF322 AC:0x00 X:0xFF Y:0x00 SP:0x00 SR:n-_b----
-		Next: TXS implied
+		Next: TXS
 		$F322> step
 		Breakpoint for X = $FF (255)
 		CPU PC:0xF323 AC:0x00 X:0xFF Y:0x00 SP:0xFF SR:n-_b----
-		Next: CLI implied
+		Next: CLI
 		$F323>
 		Breakpoint for X = $FF (255)
 		CPU PC:0xF324 AC:0x00 X:0xFF Y:0x00 SP:0xFF SR:n-_b-i--
-		Next: CLD implied
+		Next: CLD
 		$F324>
 		Breakpoint for X = $FF (255)
 		CPU PC:0xF325 AC:0x00 X:0xFF Y:0x00 SP:0xFF SR:n-_b-i--
-		Next: JMP absolute $F07B
+		Next: JMP $F07B
 		$F325> break-instruction nop
 		$F325> r
 		Breakpoint for X = $FF (255)
 		CPU PC:0xF07B AC:0x00 X:0xFF Y:0x00 SP:0xFF SR:n-_b-i--
-		Next: LDA immediate $00
+		Next: LDA #$00
 		$F07B> q
 */
 package debugger
@@ -43,7 +43,6 @@ package debugger
  * TODO:
  * -  Command argument validation.
  * -  Handle missing/multiple labels when entering address.
- * -  Resolve addresses to symbols non-absolute instructions, e.g. branch.
  * -  Tab completion from commands, not just debug symbols.
  * -  `step n` e.g. `step 100` to step 100 instructions.
  * -  Read and write CLI history file.
@@ -54,20 +53,25 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/pda/go6502/asm"
 	"github.com/pda/go6502/cpu"
+	"github.com/pda/go6502/disasm"
 	"github.com/peterh/liner"
 )
 
 const (
 	debugCmdNone = iota
+	debugCmdAsm
 	debugCmdBreakAddress
 	debugCmdBreakInstruction
 	debugCmdBreakRegister
 	debugCmdContinue
+	debugCmdDisasm
 	debugCmdExit
 	debugCmdHelp
 	debugCmdInvalid
 	debugCmdNext
+	debugCmdPin
 	debugCmdRead
 	debugCmdRead16
 	debugCmdRead32
@@ -75,7 +79,7 @@ const (
 )
 
 type Debugger struct {
-	symbols           debugSymbols
+	symbols           Symbols
 	inputQueue        []string
 	cpu               *cpu.Cpu
 	liner             *liner.State
@@ -102,7 +106,7 @@ type cmd struct {
 // Be sure to defer a call to Debugger.Shutdown() afterwards, or your terminal
 // will be left in a broken state.
 func NewDebugger(cpu *cpu.Cpu, debugFile string) *Debugger {
-	var symbols debugSymbols
+	var symbols Symbols
 	if len(debugFile) > 0 {
 		var err error
 		symbols, err = readDebugSymbols(debugFile)
@@ -122,7 +126,7 @@ func NewDebugger(cpu *cpu.Cpu, debugFile string) *Debugger {
 }
 
 // linerCompleter returns a tab-completion function for liner.
-func linerCompleter(symbols debugSymbols) func(string) []string {
+func linerCompleter(symbols Symbols) func(string) []string {
 	return func(line string) (c []string) {
 		if len(line) == 0 {
 			return
@@ -194,23 +198,20 @@ func (d *Debugger) BeforeExecute(in cpu.Instruction) {
 	}
 
 	fmt.Println(d.cpu)
-
-	var symbols []string
-	if in.IsAbsolute() {
-		symbols = d.symbols.labelsFor(in.Op16)
-	}
-
-	if len(symbols) > 0 {
-		fmt.Printf("Next: %v (%s)\n", in, strings.Join(symbols, ","))
-	} else {
-		fmt.Println("Next:", in)
-	}
+	fmt.Println("Next:", d.disassembler().Instruction(in, d.cpu.PC))
 
 	for !d.commandLoop(in) {
 		// next
 	}
 }
 
+// Fault is told of faults trapped by the CPU, and breaks to the prompt
+// before the next instruction.
+func (d *Debugger) Fault(err error) {
+	fmt.Println("Fault:", err)
+	d.run = false
+}
+
 // Returns true when control is to be released.
 func (d *Debugger) commandLoop(in cpu.Instruction) (release bool) {
 	var (
@@ -226,6 +227,8 @@ func (d *Debugger) commandLoop(in cpu.Instruction) (release bool) {
 	}
 
 	switch cmd.id {
+	case debugCmdAsm:
+		d.commandAsm(cmd)
 	case debugCmdBreakAddress:
 		d.commandBreakAddress(cmd)
 	case debugCmdBreakInstruction:
@@ -235,8 +238,11 @@ func (d *Debugger) commandLoop(in cpu.Instruction) (release bool) {
 	case debugCmdContinue:
 		d.run = true
 		release = true
+	case debugCmdDisasm:
+		d.commandDisasm(cmd)
 	case debugCmdExit:
-		d.cpu.ExitChan <- 0
+		d.cpu.Exit(0)
+		release = true
 	case debugCmdHelp:
 		d.commandHelp(cmd)
 	case debugCmdNext:
@@ -244,6 +250,8 @@ func (d *Debugger) commandLoop(in cpu.Instruction) (release bool) {
 		release = true
 	case debugCmdNone:
 		// pass
+	case debugCmdPin:
+		d.commandPin(cmd)
 	case debugCmdRead:
 		d.commandRead(cmd)
 	case debugCmdRead16:
@@ -271,6 +279,73 @@ func (d *Debugger) commandNext(in cpu.Instruction) {
 	d.run = true
 }
 
+// disassembler returns a disassembler for the CPU, labelling addresses
+// with the debug symbols.
+func (d *Debugger) disassembler() *disasm.Disassembler {
+	return &disasm.Disassembler{Variant: d.cpu.Variant, Labels: d.symbols}
+}
+
+// commandAsm assembles an instruction or directive into memory, e.g. to
+// patch code in RAM.
+func (d *Debugger) commandAsm(cmd *cmd) {
+	if len(cmd.arguments) < 2 {
+		fmt.Println("Usage: asm <address> <instruction>")
+		return
+	}
+	addr, err := d.parseUint16(cmd.arguments[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	a := &asm.Assembler{Variant: d.cpu.Variant, Symbols: d.symbols.Address}
+	p, err := a.Assemble(addr, strings.Join(cmd.arguments[1:], " "))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	p.Load(d.cpu.Bus)
+	if fault := d.cpu.Bus.TakeFault(); fault != nil {
+		fmt.Println(fault)
+		return
+	}
+	for _, s := range p.Segments {
+		for _, line := range d.disassembler().Disassemble(s.Code, s.Origin) {
+			line.Label = ""
+			fmt.Println(line)
+		}
+	}
+}
+
+func (d *Debugger) commandDisasm(cmd *cmd) {
+	addr, count := d.cpu.PC, 10
+	if len(cmd.arguments) >= 1 {
+		var err error
+		if addr, err = d.parseUint16(cmd.arguments[0]); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if len(cmd.arguments) >= 2 {
+		n, err := strconv.Atoi(cmd.arguments[1])
+		if err != nil || n < 1 {
+			fmt.Println("Invalid count:", cmd.arguments[1])
+			return
+		}
+		count = n
+	}
+	dis := d.disassembler()
+	for i := 0; i < count; i++ {
+		code := []byte{d.cpu.Bus.Read(addr), d.cpu.Bus.Read(addr + 1), d.cpu.Bus.Read(addr + 2)}
+		line := dis.Disassemble(code, addr)[0]
+		if line.Label != "" {
+			fmt.Printf("%s:\n", line.Label)
+		}
+		line.Label = ""
+		fmt.Println(line)
+		addr += uint16(len(line.Bytes))
+	}
+}
+
 func (d *Debugger) commandRead(cmd *cmd) {
 	addr, err := d.parseUint16(cmd.arguments[0])
 	if err != nil {
@@ -314,13 +389,16 @@ func (d *Debugger) commandHelp(cmd *cmd) {
 	fmt.Println("")
 	fmt.Println("pda6502 debuger")
 	fmt.Println("---------------")
+	fmt.Println("asm <address> <instruction> (alias: a) Assemble into memory, e.g. a . NOP")
 	fmt.Println("break-address <addr> (alias: ba) e.g. ba 0x1000")
 	fmt.Println("break-instruction <mnemonic> (alias: bi) e.g. bi NOP")
 	fmt.Println("break-register <x|y|a> <value> (alias: br) e.g. br x 128")
 	fmt.Println("continue (alias: c) Run continuously until breakpoint.")
+	fmt.Println("disasm [address] [count] (alias: d) Disassemble count instructions; default PC, 10.")
 	fmt.Println("exit (alias: quit, q) Shut down the emulator.")
 	fmt.Println("help (alias: h, ?) This help.")
 	fmt.Println("next (alias: n) Next instruction; step over subroutines.")
+	fmt.Println("pin <irq|nmi|so|resb> <low|high|pulse> Drive a CPU input; resb pulse only.")
 	fmt.Println("read <address> - Read and display 8-bit integer at address.")
 	fmt.Println("read16 <address> - Read and display 16-bit integer at address.")
 	fmt.Println("read32 <address> - Read and display 32-bit integer at address.")
@@ -331,6 +409,42 @@ func (d *Debugger) commandHelp(cmd *cmd) {
 	fmt.Println("Commands expecting uint16 treat . as current address (PC).")
 }
 
+// commandPin drives one of the CPU's active-low inputs. RESB may only be
+// pulsed; held low, the CPU would never return to the debugger.
+func (d *Debugger) commandPin(cmd *cmd) {
+	if len(cmd.arguments) != 2 {
+		fmt.Println("Usage: pin <irq|nmi|so|resb> <low|high|pulse>")
+		return
+	}
+	var set func(string, bool)
+	switch strings.ToLower(cmd.arguments[0]) {
+	case "irq":
+		set = d.cpu.SetIRQ
+	case "nmi":
+		set = d.cpu.SetNMI
+	case "so":
+		set = d.cpu.SetSO
+	case "resb":
+		set = d.cpu.SetRESB
+	default:
+		fmt.Println("Invalid pin:", cmd.arguments[0])
+		return
+	}
+	switch level := strings.ToLower(cmd.arguments[1]); {
+	case level == "pulse":
+		set("debugger", true)
+		set("debugger", false)
+	case strings.EqualFold(cmd.arguments[0], "resb"):
+		fmt.Println("RESB can only be pulsed from the debugger.")
+	case level == "low":
+		set("debugger", true)
+	case level == "high":
+		set("debugger", false)
+	default:
+		fmt.Println("Invalid level:", cmd.arguments[1])
+	}
+}
+
 func (d *Debugger) commandBreakAddress(cmd *cmd) {
 	addr, err := d.parseUint16(cmd.arguments[0])
 	if err != nil {
@@ -403,6 +517,8 @@ func (d *Debugger) getCommand() (*cmd, error) {
 	switch cmdString {
 	case "":
 		id = debugCmdNone
+	case "asm", "a":
+		id = debugCmdAsm
 	case "break-address", "break-addr", "ba":
 		id = debugCmdBreakAddress
 	case "break-instruction", "bi":
@@ -411,12 +527,16 @@ func (d *Debugger) getCommand() (*cmd, error) {
 		id = debugCmdBreakRegister
 	case "continue", "c":
 		id = debugCmdContinue
+	case "disasm", "d":
+		id = debugCmdDisasm
 	case "exit", "quit", "q":
 		id = debugCmdExit
 	case "help", "h", "?":
 		id = debugCmdHelp
 	case "next", "n":
 		id = debugCmdNext
+	case "pin":
+		id = debugCmdPin
 	case "read":
 		id = debugCmdRead
 	case "read16":
@@ -0,0 +1,125 @@
+package debugger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DebugInfo is what an ld65 debug file says about a program's source: its
+// files, the addresses assembled from each of their lines, and its labels.
+// Only version 2 debug files, from ld65 2.13 and later, have source lines.
+type DebugInfo struct {
+	Files    []string // source file names, as given to ca65 or cc65.
+	Lines    []SourceLine
+	Segments []Segment
+	Symbols  Symbols
+}
+
+// SourceLine is a line of source, and the address ranges assembled from it.
+type SourceLine struct {
+	File  int // index into DebugInfo.Files.
+	Line  int // numbered from 1.
+	Spans []Span
+}
+
+// Span is a range of addresses.
+type Span struct {
+	Start uint16
+	Size  int
+}
+
+// Contains is true if address is in the span.
+func (s Span) Contains(address uint16) bool {
+	return int(address) >= int(s.Start) && int(address) < int(s.Start)+s.Size
+}
+
+// Segment is a segment of the program, e.g. CODE or RODATA.
+type Segment struct {
+	Name string
+	Span
+}
+
+// debugSpan is a span line, whose start is relative to its segment.
+type debugSpan struct {
+	seg         string
+	start, size int
+}
+
+// ReadDebugInfo reads the source files, lines, segments and labels of an
+// ld65 debug file, as written by ld65 --dbgfile.
+func ReadDebugInfo(debugFile string) (*DebugInfo, error) {
+	info := &DebugInfo{}
+	files := make(map[string]int)
+	segments := make(map[string]Segment)
+	spans := make(map[string]debugSpan)
+	var lines []debugLine
+
+	var parseErr error
+	number := func(line debugLine, key string) int {
+		n, err := strconv.ParseUint(line.data[key], 0, 32)
+		if err != nil && parseErr == nil {
+			parseErr = fmt.Errorf("Invalid %s in %s line: %q", key, line.prefix, line.data[key])
+		}
+		return int(n)
+	}
+
+	err := readDebugFile(debugFile, func(line debugLine) {
+		id := line.data["id"]
+		switch line.prefix {
+		case "file":
+			files[id] = len(info.Files)
+			info.Files = append(info.Files, line.name)
+		case "seg":
+			seg := Segment{Name: line.name}
+			seg.Start = uint16(number(line, "start"))
+			seg.Size = number(line, "size")
+			segments[id] = seg
+			info.Segments = append(info.Segments, seg)
+		case "span":
+			spans[id] = debugSpan{
+				seg:   line.data["seg"],
+				start: number(line, "start"),
+				size:  number(line, "size"),
+			}
+		case "line":
+			lines = append(lines, line)
+		case "sym":
+			if symbol, ok := line.symbol(); ok {
+				info.Symbols = append(info.Symbols, symbol)
+			}
+		}
+	})
+	if err == nil {
+		err = parseErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		file, ok := files[line.data["file"]]
+		if !ok {
+			continue
+		}
+		sl := SourceLine{File: file, Line: number(line, "line")}
+		if ids := line.data["span"]; ids != "" {
+			for _, id := range strings.Split(ids, "+") {
+				span, ok := spans[id]
+				if seg, segOK := segments[span.seg]; ok && segOK {
+					sl.Spans = append(sl.Spans, Span{
+						Start: seg.Start + uint16(span.start),
+						Size:  span.size,
+					})
+				}
+			}
+		}
+		if len(sl.Spans) > 0 {
+			info.Lines = append(info.Lines, sl)
+		}
+	}
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	return info, nil
+}
@@ -13,14 +13,15 @@ type debugSymbol struct {
 	name    string
 }
 
-type debugSymbols []debugSymbol
+// Symbols are the labels read from an ld65 debug file.
+type Symbols []debugSymbol
 
 func (d debugSymbol) String() string {
 	return fmt.Sprintf("{%s => $%04X}", d.name, d.address)
 }
 
 // addressesFor returns the addresses labelled with the given name.
-func (symbols debugSymbols) addressesFor(name string) (result []uint16) {
+func (symbols Symbols) addressesFor(name string) (result []uint16) {
 	for _, s := range symbols {
 		if strings.EqualFold(name, s.name) {
 			result = append(result, s.address)
@@ -30,7 +31,7 @@ func (symbols debugSymbols) addressesFor(name string) (result []uint16) {
 }
 
 // labelsFor returns label name(s) for the given address.
-func (symbols debugSymbols) labelsFor(addr uint16) (result []string) {
+func (symbols Symbols) labelsFor(addr uint16) (result []string) {
 	for _, l := range symbols {
 		if l.address == addr {
 			result = append(result, l.name)
@@ -39,8 +40,50 @@ func (symbols debugSymbols) labelsFor(addr uint16) (result []string) {
 	return
 }
 
+// Label returns the first label for the given address, if there is one;
+// it meets the disasm.Labels interface.
+func (symbols Symbols) Label(addr uint16) (string, bool) {
+	if labels := symbols.labelsFor(addr); len(labels) > 0 {
+		return labels[0], true
+	}
+	return "", false
+}
+
+// Address returns the address of a label, if it labels a single address;
+// it meets asm.Assembler's Symbols.
+func (symbols Symbols) Address(name string) (uint16, bool) {
+	if addresses := symbols.addressesFor(name); len(addresses) == 1 {
+		return addresses[0], true
+	}
+	return 0, false
+}
+
+// Enclosing returns the nearest label at or below the given address, if
+// there is one; it meets profiler.Symbols.
+func (symbols Symbols) Enclosing(addr uint16) (string, bool) {
+	var nearest *debugSymbol
+	for i, l := range symbols {
+		if l.address <= addr && (nearest == nil || l.address > nearest.address) {
+			nearest = &symbols[i]
+		}
+	}
+	if nearest == nil {
+		return "", false
+	}
+	return nearest.name, true
+}
+
+// ByAddress returns the label names of each address labelled.
+func (symbols Symbols) ByAddress() map[uint16][]string {
+	names := make(map[uint16][]string)
+	for _, l := range symbols {
+		names[l.address] = append(names[l.address], l.name)
+	}
+	return names
+}
+
 // uniqueLabels is label names which resolve to a single address.
-func (symbols debugSymbols) uniqueLabels() (result []string) {
+func (symbols Symbols) uniqueLabels() (result []string) {
 	counter := make(map[string]int)
 	for _, l := range symbols {
 		counter[l.name]++
@@ -53,45 +96,59 @@ func (symbols debugSymbols) uniqueLabels() (result []string) {
 	return
 }
 
-func readDebugSymbols(debugFile string) (symbols debugSymbols, err error) {
+// ReadSymbols reads the labels from an ld65 debug file, as written by
+// ld65 --dbgfile.
+func ReadSymbols(debugFile string) (Symbols, error) {
+	return readDebugSymbols(debugFile)
+}
+
+func readDebugSymbols(debugFile string) (symbols Symbols, err error) {
+	symbols = make([]debugSymbol, 0, 128)
+	err = readDebugFile(debugFile, func(line debugLine) {
+		if symbol, ok := line.symbol(); ok {
+			symbols = append(symbols, symbol)
+		}
+	})
+	return
+}
+
+// symbol returns the label defined by a sym line.
+func (line debugLine) symbol() (debugSymbol, bool) {
+	// old format: "label", new format: "lab"
+	if line.prefix != "sym" || !strings.HasPrefix(line.data["type"], "lab") {
+		return debugSymbol{}, false
+	}
+	val, ok := line.data["val"] // new format
+	if !ok {
+		val = line.data["value"] // old format
+	}
+	addr, err := strconv.ParseUint(val, 0, 16)
+	if err != nil {
+		panic(err)
+	}
+	return debugSymbol{address: uint16(addr), name: line.name}, true
+}
+
+// readDebugFile calls handle with each line of an ld65 debug file, e.g. a
+// sym, line or span.
+func readDebugFile(debugFile string, handle func(debugLine)) (err error) {
 	file, err := os.Open(debugFile)
 	if err != nil {
 		return
 	}
+	defer file.Close()
 
-	symbols = make([]debugSymbol, 128)
 	t := &tokenizer{state: sBegin}
 
-	handleLine := func() {
-		// old format: "label", new format: "lab"
-		if t.line.data["type"][0:3] == "lab" {
-			val, ok := t.line.data["val"] // new format
-			if !ok {
-				val = t.line.data["value"] // old format
-			}
-			addr, err := strconv.ParseUint(val, 0, 16)
-			if err != nil {
-				panic(err)
-			}
-			symbols = append(symbols, debugSymbol{address: uint16(addr), name: t.line.name})
-		}
-	}
-
 	s := bufio.NewScanner(file)
 	s.Split(t.splitter)
 	for s.Scan() {
 		bytes := s.Bytes()
 		switch t.state {
 		case sBegin:
-			if s.Text() == "sym" {
-				t.line = debugLine{prefix: "sym", data: make(map[string]string)}
+			if bytes[0] != '\n' {
+				t.line = debugLine{prefix: s.Text(), data: make(map[string]string)}
 				t.enter(sTab)
-			} else {
-				t.enter(sReject)
-			}
-		case sReject:
-			if bytes[0] == '\n' {
-				t.enter(sBegin)
 			}
 		case sTab:
 			if bytes[0] == '\t' {
@@ -115,7 +172,7 @@ func readDebugSymbols(debugFile string) (symbols debugSymbols, err error) {
 				t.enter(sMapKey)
 			} else if bytes[0] == '\n' {
 				t.enter(sBegin)
-				handleLine()
+				handle(t.line)
 			}
 		case sMapKey:
 			t.line.key = s.Text()
@@ -136,17 +193,12 @@ func readDebugSymbols(debugFile string) (symbols debugSymbols, err error) {
 			}
 		}
 	}
-	if err = s.Err(); err != nil {
-		return
-	}
-
-	return
+	return s.Err()
 }
 
 // Tokenizer states.
 const (
 	sBegin     = iota // initial state
-	sReject           // line is being rejected
 	sTab              // expect tab
 	sNameOrMap        // expecting name in old format, map in new format.
 	sMap              // expecting ,key=value,key=value
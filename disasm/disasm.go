@@ -0,0 +1,228 @@
+/*
+	Package disasm disassembles 6502 machine code into ca65 syntax, e.g.
+
+		LDA #$10
+		STA ($20),Y
+		BNE loop
+
+	Address operands are shown as labels where they're known, e.g. from an
+	ld65 debug file, and relative branches as their targets. Source written
+	by WriteSource may be assembled again with ca65.
+*/
+package disasm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pda/go6502/cpu"
+)
+
+// Labels resolves addresses to labels. debugger.Symbols is Labels read from
+// an ld65 debug file.
+type Labels interface {
+	Label(address uint16) (string, bool)
+}
+
+// Disassembler disassembles the instruction set of a CPU variant.
+type Disassembler struct {
+	Variant cpu.Variant
+
+	// Labels, if not nil, are shown in place of the addresses they label.
+	Labels Labels
+}
+
+// A Line is a disassembled instruction, or a .byte directive for a byte
+// which doesn't start an instruction of the variant, or for an instruction
+// which ca65 would assemble to other bytes, e.g. an undocumented NOP.
+type Line struct {
+	Address uint16
+	Bytes   []byte
+	Label   string // the label of Address, if any.
+	Text    string // e.g. "LDA #$10".
+}
+
+// String formats the line as a listing, e.g. "F000  A9 10     LDA #$10".
+func (l Line) String() string {
+	s := fmt.Sprintf("%04X  %-10s%s", l.Address, hexBytes(l.Bytes), l.Text)
+	if l.Label != "" {
+		s += " ; " + l.Label
+	}
+	return s
+}
+
+// ca65Names are the mnemonics ca65 knows by other names than go6502.
+var ca65Names = map[string]string{
+	"SBX": "AXS",
+}
+
+// Instruction disassembles in, which was read from pc.
+func (d *Disassembler) Instruction(in cpu.Instruction, pc uint16) string {
+	return d.instruction(in, pc, nil)
+}
+
+// instruction disassembles in, telling ref of each label it uses.
+func (d *Disassembler) instruction(in cpu.Instruction, pc uint16, ref func(uint16, string)) string {
+	s := in.DisassembleWith(pc, func(address uint16, kind cpu.AddressKind) string {
+		if label, ok := d.label(address); ok {
+			if ref != nil {
+				ref(address, label)
+			}
+			if kind == cpu.AbsoluteAddress && address < 0x100 {
+				return "a:" + label
+			}
+			return label
+		}
+		if kind == cpu.ZeropageAddress {
+			return fmt.Sprintf("$%02X", address)
+		}
+		if kind == cpu.AbsoluteAddress && address < 0x100 {
+			// ca65 would otherwise assemble zero-page addressing.
+			return fmt.Sprintf("a:$%04X", address)
+		}
+		return fmt.Sprintf("$%04X", address)
+	})
+	name := in.Name()
+	if ca65, ok := ca65Names[name]; ok {
+		s = ca65 + s[len(name):]
+	}
+	return s
+}
+
+func (d *Disassembler) label(address uint16) (string, bool) {
+	if d.Labels == nil {
+		return "", false
+	}
+	return d.Labels.Label(address)
+}
+
+// Disassemble disassembles code, which is loaded at origin, a line per
+// instruction. Bytes which don't start an instruction of the variant, and
+// instructions cut short by the end of code, become .byte directives, as do
+// instructions whose opcode isn't the one ca65 assembles for them.
+func (d *Disassembler) Disassemble(code []byte, origin uint16) []Line {
+	return d.disassemble(code, origin, nil)
+}
+
+func (d *Disassembler) disassemble(code []byte, origin uint16, ref func(uint16, string)) (lines []Line) {
+	for i := 0; i < len(code); {
+		pc := origin + uint16(i)
+		line := Line{Address: pc}
+		line.Label, _ = d.label(pc)
+		in, err := d.Variant.DecodeInstruction(pc, code[i:])
+		if err != nil {
+			// Illegal or truncated.
+			line.Bytes = code[i : i+1]
+			line.Text = byteDirective(line.Bytes)
+		} else if !canonical(d.Variant, in.OpType) {
+			line.Bytes = code[i : i+int(in.Bytes)]
+			line.Text = byteDirective(line.Bytes)
+		} else {
+			line.Bytes = code[i : i+int(in.Bytes)]
+			line.Text = d.instruction(in, pc, ref)
+		}
+		lines = append(lines, line)
+		i += len(line.Bytes)
+	}
+	return lines
+}
+
+// canonical is true if ot's opcode is the one ca65 assembles for its mnemonic
+// and addressing mode: the NMOS 6502's documented opcode if there is one, or
+// else the lowest. ca65 knows no NOP but $EA outside the 6502X.
+func canonical(v cpu.Variant, ot cpu.OpType) bool {
+	if ot.Name() == "NOP" && ot.Opcode != 0xEA && v != cpu.NMOS6502X {
+		return false
+	}
+	for opcode := 0; opcode < 0x100; opcode++ {
+		other, ok := v.Lookup(uint8(opcode))
+		if !ok || other.Opcode == ot.Opcode || other.Name() != ot.Name() || other.Addressing() != ot.Addressing() {
+			continue
+		}
+		if documented(other) || !documented(ot) && other.Opcode < ot.Opcode {
+			return false
+		}
+	}
+	return true
+}
+
+// documented is true if ot is in the NMOS 6502's documented instruction set.
+func documented(ot cpu.OpType) bool {
+	nmos, ok := cpu.NMOS6502.Lookup(ot.Opcode)
+	return ok && nmos == ot
+}
+
+// byteDirective returns a .byte directive for bytes, e.g. ".byte $44, $10".
+func byteDirective(bytes []byte) string {
+	hex := make([]string, len(bytes))
+	for i, b := range bytes {
+		hex[i] = fmt.Sprintf("$%02X", b)
+	}
+	return ".byte " + strings.Join(hex, ", ")
+}
+
+// SetCPU returns the ca65 .setcpu name for a variant.
+func SetCPU(v cpu.Variant) string {
+	switch v {
+	case cpu.NMOS6502X:
+		return "6502X"
+	case cpu.CMOS65C02:
+		return "65SC02"
+	case cpu.Rockwell65C02:
+		return "65C02"
+	case cpu.WDC65C02:
+		return "W65C02"
+	}
+	return "6502"
+}
+
+// WriteSource writes the disassembly of code, which is loaded at origin, as
+// ca65 source. Labels used as operands but not falling on the start of a
+// line are defined as constants. Each line is commented with its address
+// and bytes.
+func (d *Disassembler) WriteSource(w io.Writer, code []byte, origin uint16) error {
+	refs := make(map[string]uint16)
+	var order []string
+	lines := d.disassemble(code, origin, func(address uint16, label string) {
+		if _, ok := refs[label]; !ok {
+			refs[label] = address
+			order = append(order, label)
+		}
+	})
+	for _, l := range lines {
+		if l.Label != "" {
+			delete(refs, l.Label)
+		}
+	}
+
+	var err error
+	printf := func(format string, args ...any) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+	printf("\t.setcpu\t%q\n", SetCPU(d.Variant))
+	for _, label := range order {
+		if address, ok := refs[label]; ok {
+			printf("%s = $%04X\n", label, address)
+		}
+	}
+	printf("\t.org\t$%04X\n", origin)
+	for _, l := range lines {
+		if l.Label != "" {
+			printf("%s:\n", l.Label)
+		}
+		printf("\t%-24s; %04X  %s\n", l.Text, l.Address, hexBytes(l.Bytes))
+	}
+	return err
+}
+
+// hexBytes formats bytes in hex, space separated.
+func hexBytes(bytes []byte) string {
+	hex := make([]string, len(bytes))
+	for i, b := range bytes {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hex, " ")
+}
@@ -0,0 +1,111 @@
+package disasm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pda/go6502/cpu"
+)
+
+type labels map[uint16]string
+
+func (l labels) Label(address uint16) (string, bool) {
+	label, ok := l[address]
+	return label, ok
+}
+
+func TestDisassemble(t *testing.T) {
+	d := &Disassembler{
+		Variant: cpu.NMOS6502,
+		Labels:  labels{0x0200: "loop", 0x0010: "ptr", 0x1234: "data"},
+	}
+	code := []byte{
+		0xA9, 0x10, // LDA #$10
+		0x91, 0x10, // STA (ptr),Y
+		0xAD, 0x20, 0x00, // LDA a:$0020
+		0x8D, 0x34, 0x12, // STA data
+		0xD0, 0xF4, // BNE loop
+		0xFF, // illegal on the NMOS 6502
+		0x20, // JSR, truncated
+		0x00, // BRK
+	}
+	expected := []Line{
+		{0x0200, code[0:2], "loop", "LDA #$10"},
+		{0x0202, code[2:4], "", "STA (ptr),Y"},
+		{0x0204, code[4:7], "", "LDA a:$0020"},
+		{0x0207, code[7:10], "", "STA data"},
+		{0x020A, code[10:12], "", "BNE loop"},
+		{0x020C, code[12:13], "", ".byte $FF"},
+		{0x020D, code[13:14], "", ".byte $20"},
+		{0x020E, code[14:15], "", "BRK"},
+	}
+	lines := d.Disassemble(code, 0x0200)
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %d: %v", len(expected), len(lines), lines)
+	}
+	for i, l := range lines {
+		e := expected[i]
+		if l.Address != e.Address || string(l.Bytes) != string(e.Bytes) || l.Label != e.Label || l.Text != e.Text {
+			t.Errorf("line %d: expected %v, got %v", i, e, l)
+		}
+	}
+}
+
+func TestInstructionNames(t *testing.T) {
+	d := &Disassembler{Variant: cpu.NMOS6502X}
+	in, err := d.Variant.DecodeInstruction(0x0200, []byte{0xCB, 0x05})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := d.Instruction(in, 0x0200); s != "AXS #$05" {
+		t.Errorf("expected AXS #$05, got %s", s)
+	}
+}
+
+func TestNonCanonicalOpcodes(t *testing.T) {
+	tests := []struct {
+		variant  cpu.Variant
+		code     []byte
+		expected string
+	}{
+		{cpu.CMOS65C02, []byte{0xEA}, "NOP"},
+		{cpu.CMOS65C02, []byte{0x03}, ".byte $03"},
+		{cpu.WDC65C02, []byte{0xFB}, ".byte $FB"},
+		{cpu.CMOS65C02, []byte{0x02, 0x10}, ".byte $02, $10"},
+		{cpu.CMOS65C02, []byte{0x44, 0x10}, ".byte $44, $10"},
+		{cpu.CMOS65C02, []byte{0xDC, 0x34, 0x12}, ".byte $DC, $34, $12"},
+		{cpu.NMOS6502X, []byte{0x1A}, ".byte $1A"},
+		{cpu.NMOS6502X, []byte{0x04, 0x10}, "NOP $10"},
+		{cpu.NMOS6502X, []byte{0x44, 0x10}, ".byte $44, $10"},
+		{cpu.NMOS6502X, []byte{0xEB, 0x10}, ".byte $EB, $10"},
+	}
+	for _, tt := range tests {
+		d := &Disassembler{Variant: tt.variant}
+		lines := d.Disassemble(tt.code, 0x0200)
+		if len(lines) != 1 || lines[0].Text != tt.expected {
+			t.Errorf("%v % X: expected %q, got %v", tt.variant, tt.code, tt.expected, lines)
+		}
+	}
+}
+
+func TestWriteSource(t *testing.T) {
+	d := &Disassembler{
+		Variant: cpu.WDC65C02,
+		Labels:  labels{0xF000: "reset", 0x9000: "via"},
+	}
+	var b strings.Builder
+	err := d.WriteSource(&b, []byte{0x8D, 0x00, 0x90, 0x80, 0xFB}, 0xF000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "" +
+		"\t.setcpu\t\"W65C02\"\n" +
+		"via = $9000\n" +
+		"\t.org\t$F000\n" +
+		"reset:\n" +
+		"\tSTA via                 ; F000  8D 00 90\n" +
+		"\tBRA reset               ; F003  80 FB\n"
+	if b.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
@@ -8,20 +8,31 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
 
 	"github.com/pda/go6502/bus"
 	"github.com/pda/go6502/cli"
+	"github.com/pda/go6502/coverage"
 	"github.com/pda/go6502/cpu"
 	"github.com/pda/go6502/debugger"
+	"github.com/pda/go6502/disasm"
+	"github.com/pda/go6502/host"
 	"github.com/pda/go6502/ili9340"
 	"github.com/pda/go6502/memory"
+	"github.com/pda/go6502/profiler"
 	"github.com/pda/go6502/sd"
+	"github.com/pda/go6502/sim65"
 	"github.com/pda/go6502/speedometer"
 	"github.com/pda/go6502/spi"
 	"github.com/pda/go6502/ssd1306"
+	"github.com/pda/go6502/throttle"
+	"github.com/pda/go6502/tracer"
 	"github.com/pda/go6502/via6522"
 )
 
@@ -31,6 +42,16 @@ const (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "coverage":
+			os.Exit(coverageReturningStatus(os.Args[2:]))
+		case "disasm":
+			os.Exit(disasmReturningStatus(os.Args[2:]))
+		case "sim65":
+			os.Exit(sim65ReturningStatus(os.Args[2:]))
+		}
+	}
 	os.Exit(mainReturningStatus())
 }
 
@@ -38,6 +59,24 @@ func mainReturningStatus() int {
 
 	options := cli.ParseFlags()
 
+	variant, err := cpu.ParseVariant(options.Cpu)
+	if err != nil {
+		panic(err)
+	}
+
+	faultPolicy, err := cpu.ParseFaultPolicy(options.OnFault)
+	if err != nil {
+		panic(err)
+	}
+
+	var clockHz uint64
+	if len(options.Clock) > 0 {
+		clockHz, err = throttle.ParseFrequency(options.Clock)
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	// Create addressable devices.
 
 	kernal, err := memory.RomFromFile(kernalPath)
@@ -97,51 +136,314 @@ func mainReturningStatus() int {
 	// Attach devices to address bus.
 
 	addressBus, _ := bus.CreateBus()
-	addressBus.Attach(ram, "ram", 0x0000)
-	addressBus.Attach(via, "VIA", 0x9000)
-	addressBus.Attach(charRom, "char", 0xB000)
-	addressBus.Attach(kernal, "kernal", 0xF000)
+	mustAttach(addressBus.Attach, ram, "ram", 0x0000)
+	mustAttach(addressBus.Attach, via, "VIA", 0x9000)
+	mustAttach(addressBus.Attach, charRom, "char", 0xB000)
+	// The kernal ends at $FFFF, with the vectors; it's 8K on the pda6502.
+	mustAttach(addressBus.Attach, kernal, "kernal", uint16(0x10000-kernal.Size()))
 
-	exitChan := make(chan int, 0)
+	c := &cpu.Cpu{
+		Bus:           addressBus,
+		Variant:       variant,
+		CycleAccurate: options.CycleAccurate,
+		FaultPolicy:   faultPolicy,
+	}
+	defer c.Shutdown()
+	if options.HostServices >= 0 {
+		if options.HostServices > 0xFFFF {
+			panic(fmt.Sprintf("Host services address 0x%X out of range", options.HostServices))
+		}
+		services := host.NewServices(c, host.Options{Seed: options.HostSeed})
+		attach := addressBus.Attach
+		if options.BusOverlay {
+			attach = addressBus.AttachOverlay
+		}
+		mustAttach(attach, services, "host", uint16(options.HostServices))
+	}
+	if options.Debug {
+		debugger := debugger.NewDebugger(c, options.DebugSymbolFile)
+		debugger.QueueCommands(options.DebugCmds)
+		c.AttachMonitor(debugger)
+	}
+	if options.Lockstep {
+		c.AttachMonitor(cpu.NewLockstep(c))
+	}
+	if options.Speedometer {
+		speedo := speedometer.NewSpeedometer(c)
+		speedo.TargetHz = clockHz
+		c.AttachMonitor(speedo)
+	}
+	if len(options.Trace) > 0 {
+		traceFile, err := os.Create(options.Trace)
+		if err != nil {
+			panic(err)
+		}
+		trace := tracer.NewTracer(c, traceFile)
+		if len(options.TraceCompare) > 0 {
+			reference, err := os.Open(options.TraceCompare)
+			if err != nil {
+				panic(err)
+			}
+			trace.CompareWith(reference)
+		}
+		c.AttachMonitor(trace)
+	}
+	var cover *coverage.Coverage
+	if len(options.Coverage) > 0 {
+		cover = coverage.NewCoverage()
+		c.AttachMonitor(cover)
+	}
+	var profile *profiler.Profiler
+	if len(options.Profile) > 0 || len(options.ProfileFolded) > 0 {
+		profile = profiler.NewProfiler(c)
+		if len(options.DebugSymbolFile) > 0 {
+			symbols, err := debugger.ReadSymbols(options.DebugSymbolFile)
+			if err != nil {
+				panic(err)
+			}
+			profile.Symbols = symbols
+		}
+		c.AttachMonitor(profile)
+	}
+	c.Reset()
+
+	// Run the CPU until the program exits, it halts on a fault, or we're
+	// interrupted. Run has returned by the time CPU state is read below.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if clockHz > 0 {
+		err = throttle.NewThrottle(c, clockHz).Run(ctx)
+	} else {
+		err = c.Run(ctx)
+	}
+	exitStatus, exited := exitStatusOf(err)
+	switch {
+	case exited:
+		// pass
+	case ctx.Err() != nil:
+		fmt.Println("\nGot signal:", os.Interrupt)
+		exitStatus = 1
+	default:
+		fmt.Println("\nHalted:", err)
+		exitStatus = 2
+	}
+
+	fmt.Println(c)
+	if cover != nil {
+		if err := mergeCoverageFile(cover, options.Coverage); err != nil && !errors.Is(err, os.ErrNotExist) {
+			panic(err)
+		}
+		writeFile(options.Coverage, cover.Write)
+	}
+	if profile != nil {
+		writeFile(options.Profile, profile.WriteProfile)
+		writeFile(options.ProfileFolded, profile.WriteFolded)
+	}
+	fmt.Println("Dumping RAM into core file")
+	ram.Dump("core")
 
-	cpu := &cpu.Cpu{Bus: addressBus, ExitChan: exitChan}
+	return exitStatus
+}
+
+// disasmReturningStatus runs the disasm subcommand, writing the disassembly
+// of a binary file to stdout.
+func disasmReturningStatus(args []string) int {
+	options, err := cli.ParseDisasmFlags(args)
+	if err != nil {
+		return 2
+	}
+
+	variant, err := cpu.ParseVariant(options.Cpu)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	code, err := os.ReadFile(options.File)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	origin := options.Origin
+	if origin < 0 {
+		origin = 0x10000 - len(code)
+	}
+	if origin < 0 || origin+len(code) > 0x10000 {
+		fmt.Fprintf(os.Stderr, "%s is %d bytes; too big to load at $%04X\n", options.File, len(code), origin)
+		return 1
+	}
+
+	d := &disasm.Disassembler{Variant: variant}
+	if len(options.DebugSymbolFile) > 0 {
+		symbols, err := debugger.ReadSymbols(options.DebugSymbolFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		d.Labels = symbols
+	}
+
+	if options.Listing {
+		for _, line := range d.Disassemble(code, uint16(origin)) {
+			fmt.Println(line)
+		}
+		return 0
+	}
+	if err := d.WriteSource(os.Stdout, code, uint16(origin)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// sim65ReturningStatus runs the sim65 subcommand, running a program built
+// for cc65's sim65 simulator until it exits, with its exit status.
+func sim65ReturningStatus(args []string) int {
+	options, err := cli.ParseSim65Flags(args)
+	if err != nil {
+		return 2
+	}
+
+	f, err := os.Open(options.Program)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	program, err := sim65.ReadProgram(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", options.Program, err)
+		return 1
+	}
+	variant, _ := program.Variant()
+
+	// sim65 programs have 64K of RAM.
+	addressBus, _ := bus.CreateBus()
+	mustAttach(addressBus.Attach, &memory.Ram{}, "ram", 0x0000)
+	mustAttach(addressBus.Attach, &memory.Ram{}, "ram", 0x8000)
+	program.Load(addressBus)
+
+	cpu := &cpu.Cpu{Bus: addressBus, Variant: variant}
 	defer cpu.Shutdown()
 	if options.Debug {
 		debugger := debugger.NewDebugger(cpu, options.DebugSymbolFile)
 		debugger.QueueCommands(options.DebugCmds)
 		cpu.AttachMonitor(debugger)
-	} else if options.Speedometer {
-		speedo := speedometer.NewSpeedometer()
-		cpu.AttachMonitor(speedo)
 	}
+	if len(options.Trace) > 0 {
+		traceFile, err := os.Create(options.Trace)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		cpu.AttachMonitor(tracer.NewTracer(cpu, traceFile))
+	}
+	cpu.AttachMonitor(sim65.NewParavirt(cpu, program.SP, sim65.Options{Args: options.Args}))
 	cpu.Reset()
 
-	// Dispatch CPU in a goroutine.
-	go func() {
-		for {
-			cpu.Step()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err = cpu.Run(ctx)
+	if options.Cycles {
+		fmt.Fprintf(os.Stderr, "%d cycles\n", cpu.Cycles)
+	}
+	exitStatus, exited := exitStatusOf(err)
+	switch {
+	case exited:
+		return exitStatus
+	case ctx.Err() != nil:
+		fmt.Fprintln(os.Stderr, "Got signal:", os.Interrupt)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "Halted:", err)
+	fmt.Fprintln(os.Stderr, cpu)
+	return 2
+}
+
+// coverageReturningStatus runs the coverage subcommand, merging coverage
+// files and reporting on them.
+func coverageReturningStatus(args []string) int {
+	options, err := cli.ParseCoverageFlags(args)
+	if err != nil {
+		return 2
+	}
+
+	cover := coverage.NewCoverage()
+	for _, path := range options.Files {
+		if err := mergeCoverageFile(cover, path); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
 		}
-	}()
+	}
+	if len(options.Merged) > 0 {
+		writeFile(options.Merged, cover.Write)
+	}
+	if len(options.DebugSymbolFile) == 0 {
+		return 0
+	}
 
-	var (
-		sig        os.Signal
-		exitStatus int
-	)
+	info, err := debugger.ReadDebugInfo(options.DebugSymbolFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	report := coverage.NewReport(cover, info)
+	readSource := func(name string) ([]byte, error) {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(options.SourceDir, name)
+		}
+		return os.ReadFile(name)
+	}
+	if err := report.WriteAnnotated(os.Stdout, readSource); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(options.Html) > 0 {
+		writeFile(options.Html, report.WriteHTML)
+	}
+	return 0
+}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
+// mergeCoverageFile merges the coverage file at path into c.
+func mergeCoverageFile(c *coverage.Coverage, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.Merge(f)
+}
 
-	select {
-	case exitStatus = <-exitChan:
-		// pass
-	case sig = <-sigChan:
-		fmt.Println("\nGot signal:", sig)
-		exitStatus = 1
+// writeFile creates the file at path, if path isn't empty, and writes it.
+func writeFile(path string, write func(io.Writer) error) {
+	if len(path) == 0 {
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		panic(err)
 	}
+	defer f.Close()
+	if err := write(f); err != nil {
+		panic(err)
+	}
+}
 
-	fmt.Println(cpu)
-	fmt.Println("Dumping RAM into core file")
-	ram.Dump("core")
+// mustAttach attaches mem to the bus with attach, e.g. Bus.Attach or
+// Bus.AttachOverlay, panicking if the memory map is bad.
+func mustAttach(attach func(memory.Memory, string, uint16) error, mem memory.Memory, name string, offset uint16) {
+	if err := attach(mem, name, offset); err != nil {
+		panic(err)
+	}
+}
 
-	return exitStatus
+// exitStatusOf returns the exit status if err is from the program exiting.
+func exitStatusOf(err error) (int, bool) {
+	var exit *cpu.ExitError
+	if errors.As(err, &exit) {
+		return exit.Status, true
+	}
+	return 0, false
 }
@@ -0,0 +1,202 @@
+/*
+	Package host provides a memory-mapped device through which a program may
+	use services of the host running go6502: exiting with a status, character
+	I/O on stdin and stdout, the cycle counter, wall-clock time and a random
+	seed. It may be attached to the bus at any address.
+
+	Registers, as offsets from the device's address:
+
+		$00     EXIT     write: exit with the status written.
+		$01     PUTCHAR  write: write the byte to the output.
+		$02     GETCHAR  read: read a byte from the input, or zero if there's
+		                 none ready yet, or at the end of the input.
+		$03     STATUS   read: bit 0 is set once GETCHAR reached the end of
+		                 the input, and bit 1 if the latest GETCHAR found no
+		                 input ready.
+		$08-$0F CYCLES   read: the CPU cycle count, 64-bit little-endian.
+		$10-$17 TIME     read: milliseconds since the Unix epoch, 64-bit
+		                 little-endian.
+		$18-$1B SEED     read: a random number, 32-bit little-endian.
+
+	Reading the low byte of CYCLES, TIME or SEED latches the whole value, so
+	its other bytes are consistent with it. Other registers read as zero, like
+	an open bus, and other writes fault.
+*/
+package host
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/pda/go6502/cpu"
+)
+
+// Register offsets.
+const (
+	Exit    = 0x00
+	Putchar = 0x01
+	Getchar = 0x02
+	Status  = 0x03
+	Cycles  = 0x08
+	Time    = 0x10
+	Seed    = 0x18
+)
+
+// STATUS bits.
+const (
+	StatusEOF      = 0x01 // GETCHAR reached the end of the input.
+	StatusNotReady = 0x02 // the latest GETCHAR found no input ready.
+)
+
+// Options configure the host services.
+type Options struct {
+	In   io.Reader // GETCHAR input; os.Stdin if nil.
+	Out  io.Writer // PUTCHAR output; os.Stdout if nil.
+	Seed int64     // seeds SEED's random numbers; seeded by the time if zero.
+}
+
+// Services is the host services device, as memory.Memory.
+type Services struct {
+	cpu    *cpu.Cpu
+	in     io.Reader
+	input  chan byte // bytes read from in; closed at its end.
+	out    *bufio.Writer
+	rand   *rand.Rand
+	now    func() time.Time
+	status byte
+	cycles [8]byte // latched CYCLES.
+	time   [8]byte // latched TIME.
+	seed   [4]byte // latched SEED.
+}
+
+// NewServices returns host services for the program running on c.
+func NewServices(c *cpu.Cpu, o Options) *Services {
+	if o.In == nil {
+		o.In = os.Stdin
+	}
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+	if o.Seed == 0 {
+		o.Seed = time.Now().UnixNano()
+	}
+	return &Services{
+		cpu:  c,
+		in:   o.In,
+		out:  bufio.NewWriter(o.Out),
+		rand: rand.New(rand.NewSource(o.Seed)),
+		now:  time.Now,
+	}
+}
+
+// CheckRead allows all reads. Write-only and unused registers read as zero,
+// like an open bus, rather than faulting: the processor makes dummy reads of
+// them, e.g. for indexed stores in cycle-accurate mode, which a program can't
+// avoid.
+func (s *Services) CheckRead(a uint16) error {
+	return nil
+}
+
+// CheckWrite refuses writes to read-only and unused registers.
+func (s *Services) CheckWrite(a uint16) error {
+	if a != Exit && a != Putchar {
+		return fmt.Errorf("write to 0x%X not handled by host services", a)
+	}
+	return nil
+}
+
+// Read the register at offset a.
+func (s *Services) Read(a uint16) byte {
+	switch {
+	case a == Getchar:
+		return s.getchar()
+	case a == Status:
+		return s.status
+	case a >= Cycles && a < Cycles+8:
+		if a == Cycles {
+			binary.LittleEndian.PutUint64(s.cycles[:], s.cpu.Cycles)
+		}
+		return s.cycles[a-Cycles]
+	case a >= Time && a < Time+8:
+		if a == Time {
+			binary.LittleEndian.PutUint64(s.time[:], uint64(s.now().UnixMilli()))
+		}
+		return s.time[a-Time]
+	case a >= Seed && a < Seed+4:
+		if a == Seed {
+			binary.LittleEndian.PutUint32(s.seed[:], s.rand.Uint32())
+		}
+		return s.seed[a-Seed]
+	}
+	return 0
+}
+
+// getchar returns the next byte of input, without waiting for it; the input
+// is read on another goroutine, from the first GETCHAR on.
+func (s *Services) getchar() byte {
+	// The program may have prompted for the input.
+	s.out.Flush()
+	if s.input == nil {
+		s.input = make(chan byte, 256)
+		go s.readInput()
+	}
+	select {
+	case b, ok := <-s.input:
+		s.status &^= StatusNotReady
+		if !ok {
+			s.status |= StatusEOF
+			return 0
+		}
+		return b
+	default:
+		s.status |= StatusNotReady
+		return 0
+	}
+}
+
+// readInput sends the input's bytes to s.input, closing it at the end of the
+// input.
+func (s *Services) readInput() {
+	r := bufio.NewReader(s.in)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			close(s.input)
+			return
+		}
+		s.input <- b
+	}
+}
+
+// Write to the register at offset a.
+func (s *Services) Write(a uint16, value byte) {
+	switch a {
+	case Exit:
+		s.out.Flush()
+		s.cpu.Exit(int(value))
+	case Putchar:
+		s.out.WriteByte(value)
+		if value == '\n' {
+			s.out.Flush()
+		}
+	}
+}
+
+// Size of the device's address space.
+func (s *Services) Size() int {
+	return 0x20
+}
+
+// Shutdown flushes any output.
+func (s *Services) Shutdown() {
+	s.out.Flush()
+}
+
+func (s *Services) String() string {
+	return "host services"
+}
@@ -0,0 +1,135 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pda/go6502/asm"
+	"github.com/pda/go6502/bus"
+	"github.com/pda/go6502/cpu"
+	"github.com/pda/go6502/memory"
+)
+
+// createCpu returns a CPU with RAM, and host services at $8000, running
+// source assembled at $0200. There's no reset vector, so it isn't reset.
+func createCpu(t *testing.T, o Options, source string) (*cpu.Cpu, *Services) {
+	ram := &memory.Ram{}
+	if _, err := asm.AssembleInto(ram, cpu.NMOS6502, 0x0200, source); err != nil {
+		t.Fatal(err)
+	}
+	addressBus, _ := bus.CreateBus()
+	addressBus.Attach(ram, "ram", 0x0000)
+	c := &cpu.Cpu{Bus: addressBus}
+	s := NewServices(c, o)
+	addressBus.Attach(s, "host", 0x8000)
+	c.PC = 0x0200
+	c.SP = 0xFF
+	return c, s
+}
+
+func TestEchoAndExit(t *testing.T) {
+	out := &bytes.Buffer{}
+	c, _ := createCpu(t, Options{In: strings.NewReader("hi"), Out: out}, `
+	loop:	LDA $8002	; GETCHAR
+		LDX $8003	; STATUS
+		BEQ echo
+		CPX #2		; no input ready yet
+		BEQ loop
+		LDA #7
+		STA $8000	; EXIT
+		NOP
+	echo:	STA $8001	; PUTCHAR
+		JMP loop
+	`)
+
+	err := c.Run(context.Background())
+	var exit *cpu.ExitError
+	if !errors.As(err, &exit) || exit.Status != 7 {
+		t.Fatalf("expected exit status 7, got %v", err)
+	}
+	if out.String() != "hi" {
+		t.Errorf("expected output %q, got %q", "hi", out.String())
+	}
+	if c.PC != 0x0211 {
+		t.Errorf("expected to exit after STA, PC $%04X", c.PC)
+	}
+}
+
+func TestGetcharDoesntWait(t *testing.T) {
+	r, w := io.Pipe()
+	c, _ := createCpu(t, Options{In: r}, "NOP")
+	defer w.Close()
+	if v := c.Bus.Read(0x8000 + Getchar); v != 0 {
+		t.Errorf("expected GETCHAR 0 with no input ready, got $%02X", v)
+	}
+	if v := c.Bus.Read(0x8000 + Status); v != StatusNotReady {
+		t.Errorf("expected STATUS not ready, got $%02X", v)
+	}
+
+	go w.Write([]byte{'x'})
+	var v byte
+	for deadline := time.Now().Add(time.Second); v == 0 && time.Now().Before(deadline); {
+		v = c.Bus.Read(0x8000 + Getchar)
+	}
+	if v != 'x' {
+		t.Fatalf("expected GETCHAR x once written, got $%02X", v)
+	}
+	if v := c.Bus.Read(0x8000 + Status); v != 0 {
+		t.Errorf("expected STATUS 0 once input was read, got $%02X", v)
+	}
+}
+
+func TestLatchedRegisters(t *testing.T) {
+	c, s := createCpu(t, Options{Seed: 1}, "NOP")
+	s.now = func() time.Time { return time.UnixMilli(0x0102030405) }
+	c.Cycles = 0x1122334455667788
+
+	read := func(a uint16, n int) (v uint64) {
+		for i := 0; i < n; i++ {
+			v |= uint64(c.Bus.Read(a+uint16(i))) << (8 * i)
+		}
+		return
+	}
+	if v := read(0x8000+Cycles, 8); v != 0x1122334455667788 {
+		t.Errorf("expected CYCLES $1122334455667788, got $%X", v)
+	}
+	c.Cycles = 0
+	if v := read(0x8000+Cycles+1, 7); v != 0x11223344556677 {
+		t.Errorf("expected CYCLES to stay latched, got $%X", v)
+	}
+	if v := read(0x8000+Time, 8); v != 0x0102030405 {
+		t.Errorf("expected TIME $0102030405, got $%X", v)
+	}
+
+	seed := read(0x8000+Seed, 4)
+	other, _ := createCpu(t, Options{Seed: 1}, "NOP")
+	if v := other.Bus.Read(0x8000 + Seed); v != byte(seed) {
+		t.Errorf("expected the same seed for the same Options.Seed, got $%02X not $%02X", v, byte(seed))
+	}
+	if c.Bus.TakeFault() != nil {
+		t.Error("unexpected fault")
+	}
+}
+
+func TestRefusedAccesses(t *testing.T) {
+	c, _ := createCpu(t, Options{In: strings.NewReader("")}, "NOP")
+	for _, a := range []uint16{Exit, Putchar, 0x04, Seed + 4} {
+		if v := c.Bus.Read(0x8000 + a); v != 0 {
+			t.Errorf("expected read of $%02X to be 0, as open bus, got $%02X", a, v)
+		}
+		if err := c.Bus.TakeFault(); err != nil {
+			t.Errorf("expected read of $%02X to be allowed: %v", a, err)
+		}
+	}
+	for _, a := range []uint16{Getchar, Status, Cycles, Time, Seed} {
+		c.Bus.Write(0x8000+a, 0)
+		if c.Bus.TakeFault() == nil {
+			t.Errorf("expected write to $%02X to fault", a)
+		}
+	}
+}
@@ -3,6 +3,11 @@
 */
 package memory
 
+import "errors"
+
+// ErrReadOnly is the reason for refusing writes to read-only memory.
+var ErrReadOnly = errors.New("Read-only memory")
+
 // Memory is a general interface for reading and writing bytes to and from
 // 16-bit addresses.
 type Memory interface {
@@ -11,3 +16,28 @@ type Memory interface {
 	Write(uint16, byte)
 	Size() int
 }
+
+// Static is implemented by Memory whose contents only change when written
+// through the bus, or loaded directly, e.g. RAM and ROM but not I/O devices.
+// Reads from static memory may be cached, e.g. as decoded instructions;
+// whatever loads it directly must flush such caches, e.g. with
+// cpu.Cpu.FlushDecoded.
+type Static interface {
+	Static() bool
+}
+
+// Inert is implemented by Memory which reading has no effect on, e.g. RAM
+// and ROM but not I/O devices, whose registers may change when read. Inert
+// memory may be peeked, e.g. by monitors, without making a bus access.
+type Inert interface {
+	Inert() bool
+}
+
+// A Checker is Memory which refuses some accesses, e.g. ROM refusing writes,
+// or a device refusing registers it doesn't implement. The bus checks each
+// access before making it, and records a fault instead of making a refused
+// access.
+type Checker interface {
+	CheckRead(uint16) error
+	CheckWrite(uint16) error
+}
@@ -23,6 +23,16 @@ func (mem *Ram) Write(a uint16, value byte) {
 	mem[a] = value
 }
 
+// Static is true; RAM only changes when written, or loaded directly.
+func (mem *Ram) Static() bool {
+	return true
+}
+
+// Inert is true; reading RAM doesn't change it.
+func (mem *Ram) Inert() bool {
+	return true
+}
+
 // Size of the RAM in bytes.
 func (mem *Ram) Size() int {
 	return 0x8000 // 32K
@@ -32,6 +32,16 @@ func RomFromFile(path string) (*Rom, error) {
 	return &Rom{name: path, size: len(data), data: data}, nil
 }
 
+// Static is true; ROM never changes.
+func (r *Rom) Static() bool {
+	return true
+}
+
+// Inert is true; reading ROM doesn't change it.
+func (r *Rom) Inert() bool {
+	return true
+}
+
 // Size of the Rom in bytes.
 func (r *Rom) Size() int {
 	return r.size
@@ -45,8 +55,17 @@ func (r *Rom) String() string {
 		hex.EncodeToString(r.data[len(r.data)-2:]))
 }
 
-// Rom meets the go6502.Memory interface, but Write is not supported, and will
-// cause an error.
+// Rom meets the go6502.Memory interface, but Write has no effect; writes are
+// refused by CheckWrite.
 func (r *Rom) Write(_ uint16, _ byte) {
-	panic(fmt.Sprintf("%v is read-only", r))
+}
+
+// CheckRead allows all reads.
+func (r *Rom) CheckRead(_ uint16) error {
+	return nil
+}
+
+// CheckWrite refuses all writes with ErrReadOnly.
+func (r *Rom) CheckWrite(_ uint16) error {
+	return fmt.Errorf("%v: %w", r, ErrReadOnly)
 }
@@ -0,0 +1,176 @@
+package profiler
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// The pprof profile format is a gzipped protocol buffer, described by
+// https://github.com/google/pprof/blob/main/proto/profile.proto. It's
+// encoded here by hand, rather than importing the protobuf packages for so
+// little of them.
+
+// Field numbers of the messages written.
+const (
+	profileSampleType  = 1
+	profileSample      = 2
+	profileLocation    = 4
+	profileFunction    = 5
+	profileStringTable = 6
+	profilePeriodType  = 11
+	profilePeriod      = 12
+	profileDefaultType = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID      = 1
+	locationAddress = 3
+	locationLine    = 4
+
+	lineFunctionID = 1
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+)
+
+// protobuf is a protocol buffer message being encoded.
+type protobuf []byte
+
+func (b *protobuf) varint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+// uint encodes a varint field; zero is the default, and is left out.
+func (b *protobuf) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.varint(uint64(field) << 3)
+	b.varint(v)
+}
+
+// bytes encodes a length-delimited field: a string, message or packed
+// repeated varints.
+func (b *protobuf) bytes(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+// packed encodes repeated varints.
+func (b *protobuf) packed(field int, values []uint64) {
+	var p protobuf
+	for _, v := range values {
+		p.varint(v)
+	}
+	b.bytes(field, p)
+}
+
+// stringTable interns a profile's strings, the first of which must be empty.
+type stringTable struct {
+	strings []string
+	index   map[string]uint64
+}
+
+func (t *stringTable) id(s string) uint64 {
+	if t.index == nil {
+		t.index = map[string]uint64{"": 0}
+		t.strings = []string{""}
+	}
+	id, ok := t.index[s]
+	if !ok {
+		id = uint64(len(t.strings))
+		t.index[s] = id
+		t.strings = append(t.strings, s)
+	}
+	return id
+}
+
+// WriteProfile writes the profile in pprof's format, for go tool pprof.
+// Its samples are of cycles and instructions at each address in each call
+// stack; locations are the addresses, and functions the routines they're
+// in.
+func (p *Profiler) WriteProfile(w io.Writer) error {
+	var (
+		b         protobuf
+		strs      stringTable
+		locations = make(map[location]uint64)
+		functions = make(map[string]uint64)
+		locs      protobuf
+		funcs     protobuf
+	)
+
+	valueType := func(field int, typ, unit string) {
+		var vt protobuf
+		vt.uint(valueTypeType, strs.id(typ))
+		vt.uint(valueTypeUnit, strs.id(unit))
+		b.bytes(field, vt)
+	}
+	valueType(profileSampleType, "cycles", "count")
+	valueType(profileSampleType, "instructions", "count")
+
+	functionFor := func(name string) uint64 {
+		id, ok := functions[name]
+		if !ok {
+			id = uint64(len(functions) + 1)
+			functions[name] = id
+			var f protobuf
+			f.uint(functionID, id)
+			f.uint(functionName, strs.id(name))
+			f.uint(functionSystemName, strs.id(name))
+			funcs.bytes(profileFunction, f)
+		}
+		return id
+	}
+	locationFor := func(l location) uint64 {
+		id, ok := locations[l]
+		if !ok {
+			id = uint64(len(locations) + 1)
+			locations[l] = id
+			var line, loc protobuf
+			line.uint(lineFunctionID, functionFor(l.function))
+			loc.uint(locationID, id)
+			loc.uint(locationAddress, uint64(l.pc))
+			loc.bytes(locationLine, line)
+			locs.bytes(profileLocation, loc)
+		}
+		return id
+	}
+
+	for _, s := range p.samples() {
+		ids := make([]uint64, len(s.stack))
+		for i, l := range s.stack {
+			ids[i] = locationFor(l)
+		}
+		var sm protobuf
+		sm.packed(sampleLocationID, ids)
+		sm.packed(sampleValue, []uint64{uint64(s.cycles), uint64(s.instructions)})
+		b.bytes(profileSample, sm)
+	}
+	b = append(b, locs...)
+	b = append(b, funcs...)
+	for _, s := range strs.strings {
+		b.bytes(profileStringTable, []byte(s))
+	}
+	var period protobuf
+	period.uint(valueTypeType, strs.id("cycles"))
+	period.uint(valueTypeUnit, strs.id("count"))
+	b.bytes(profilePeriodType, period)
+	b.uint(profilePeriod, 1)
+	b.uint(profileDefaultType, strs.id("cycles"))
+
+	z := gzip.NewWriter(w)
+	if _, err := z.Write(b); err != nil {
+		return err
+	}
+	return z.Close()
+}
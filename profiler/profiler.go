@@ -0,0 +1,231 @@
+/*
+	Package profiler attributes the cycles a cpu.Cpu spends to the addresses
+	of the instructions it executes, and to the routines they're in, for
+	`go tool pprof` and flame graphs.
+
+	Routines are followed by their JSR and RTS, and interrupt handlers by
+	their entry and RTI, so that a routine's inclusive cycles include those
+	of the routines it calls. A routine is named by the ld65 debug symbol at
+	its entry point, e.g. the JSR's target, or else by its entry address;
+	local labels within it don't split it.
+*/
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pda/go6502/cpu"
+)
+
+// Symbols names code addresses. debugger.Symbols is Symbols read from an
+// ld65 debug file.
+type Symbols interface {
+	// Enclosing returns the name of the nearest symbol at or below address.
+	Enclosing(address uint16) (string, bool)
+}
+
+// Profiler is a cpu.ExecuteMonitor which profiles the cycles spent by each
+// instruction, in the call stack it ran in.
+type Profiler struct {
+	// Symbols, if not nil, name the routines in the profile.
+	Symbols Symbols
+
+	cpu     *cpu.Cpu
+	root    *node
+	stack   []frame
+	started bool
+	last    *counts           // the previous instruction's counts.
+	end     uint64            // the cycle count after the previous instruction.
+	after   cpu.Registers     // the registers after the previous instruction.
+	names   map[uint16]string // routines' names, by entry point.
+}
+
+// A node is a routine in a call stack, with the counts of the instructions
+// run in it, and the routines it called.
+type node struct {
+	parent   *node
+	site     uint16 // the address in parent the routine was called from.
+	entry    uint16 // the routine's address.
+	children map[[2]uint16]*node
+	pcs      map[uint16]*counts
+}
+
+// counts are the cycles and instructions spent at an address.
+type counts struct {
+	cycles       int64
+	instructions int64
+}
+
+// frame is a routine running, and the stack pointer after its return
+// address was pushed; once SP rises above it, the routine has returned.
+type frame struct {
+	node *node
+	sp   int
+}
+
+// NewProfiler returns a Profiler, to be attached to c as a monitor.
+func NewProfiler(c *cpu.Cpu) *Profiler {
+	return &Profiler{cpu: c}
+}
+
+// BeforeExecute meets the cpu.Monitor interface; instructions are counted
+// once they've executed, and their cycles are known.
+func (p *Profiler) BeforeExecute(in cpu.Instruction) {
+}
+
+// AfterExecute counts the cycles in took, in the current call stack, and
+// follows calls and returns.
+func (p *Profiler) AfterExecute(in cpu.Instruction, e *cpu.Effects) {
+	pc := e.Before.PC
+	if !p.started {
+		p.root = newNode(nil, pc, pc)
+		p.stack = []frame{{p.root, 0x100}} // never returns.
+		p.end = e.Cycles
+		p.started = true
+	} else if e.Before.SP == p.after.SP-3 && pc != p.after.PC {
+		// An interrupt was taken; its handler is running.
+		p.call(p.after.PC, pc, e.Before.SP)
+	}
+
+	// Cycles between instructions, spent waiting or taking an interrupt,
+	// are counted to the instruction before.
+	if p.last != nil {
+		p.last.cycles += int64(e.Cycles - p.end)
+	}
+	top := p.stack[len(p.stack)-1].node
+	c := top.pcs[pc]
+	if c == nil {
+		c = &counts{}
+		top.pcs[pc] = c
+	}
+	c.cycles += int64(p.cpu.Cycles - e.Cycles)
+	c.instructions++
+	p.last = c
+	p.end = p.cpu.Cycles
+	p.after = e.After
+
+	for len(p.stack) > 1 && p.stack[len(p.stack)-1].sp < int(e.After.SP) {
+		p.stack = p.stack[:len(p.stack)-1]
+	}
+	switch in.Name() {
+	case "JSR", "BRK":
+		p.call(pc, e.After.PC, e.After.SP)
+	}
+}
+
+// call enters the routine at entry, called from site.
+func (p *Profiler) call(site, entry uint16, sp byte) {
+	parent := p.stack[len(p.stack)-1].node
+	key := [2]uint16{site, entry}
+	n := parent.children[key]
+	if n == nil {
+		n = newNode(parent, site, entry)
+		parent.children[key] = n
+	}
+	p.stack = append(p.stack, frame{n, int(sp)})
+}
+
+func newNode(parent *node, site, entry uint16) *node {
+	return &node{
+		parent:   parent,
+		site:     site,
+		entry:    entry,
+		children: make(map[[2]uint16]*node),
+		pcs:      make(map[uint16]*counts),
+	}
+}
+
+// Shutdown meets the cpu.Monitor interface.
+func (p *Profiler) Shutdown() {
+}
+
+// function returns the name of the routine n: the symbol at its entry
+// point, or the nearest below it if it has none of its own.
+func (p *Profiler) function(n *node) string {
+	if p.Symbols != nil {
+		if p.names == nil {
+			p.names = make(map[uint16]string)
+		}
+		name, ok := p.names[n.entry]
+		if !ok {
+			name, _ = p.Symbols.Enclosing(n.entry)
+			p.names[n.entry] = name
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return fmt.Sprintf("$%04X", n.entry)
+}
+
+// A sample is the counts for an address, and its call stack.
+type sample struct {
+	stack []location // leaf first.
+	counts
+}
+
+// A location is an address in a routine.
+type location struct {
+	pc       uint16
+	function string
+}
+
+// samples returns the profile's samples, in a stable order.
+func (p *Profiler) samples() (samples []sample) {
+	if p.root == nil {
+		return nil
+	}
+	var walk func(n *node)
+	walk = func(n *node) {
+		var callers []location
+		for caller := n; caller.parent != nil; caller = caller.parent {
+			callers = append(callers, location{caller.site, p.function(caller.parent)})
+		}
+		for pc, c := range n.pcs {
+			stack := append([]location{{pc, p.function(n)}}, callers...)
+			samples = append(samples, sample{stack, *c})
+		}
+		for _, child := range n.children {
+			walk(child)
+		}
+	}
+	walk(p.root)
+	sort.Slice(samples, func(i, j int) bool {
+		a, b := samples[i].stack, samples[j].stack
+		for k := 1; k <= len(a) && k <= len(b); k++ {
+			if x, y := a[len(a)-k], b[len(b)-k]; x != y {
+				return x.pc < y.pc || x.pc == y.pc && x.function < y.function
+			}
+		}
+		return len(a) < len(b)
+	})
+	return samples
+}
+
+// WriteFolded writes the cycles spent in each call stack, in the folded
+// format of Brendan Gregg's flamegraph.pl: a line per stack, of routines
+// from the outermost, separated by semicolons, and a count of cycles.
+func (p *Profiler) WriteFolded(w io.Writer) error {
+	cycles := make(map[string]int64)
+	for _, s := range p.samples() {
+		names := make([]string, len(s.stack))
+		for i, l := range s.stack {
+			names[len(names)-1-i] = l.function
+		}
+		cycles[strings.Join(names, ";")] += s.cycles
+	}
+	stacks := make([]string, 0, len(cycles))
+	for stack := range cycles {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(w, "%s %d\n", stack, cycles[stack]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
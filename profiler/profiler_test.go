@@ -0,0 +1,240 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pda/go6502/asm"
+	"github.com/pda/go6502/bus"
+	"github.com/pda/go6502/cpu"
+	"github.com/pda/go6502/memory"
+)
+
+type symbols map[uint16]string
+
+func (s symbols) Enclosing(address uint16) (string, bool) {
+	for a := int(address); a >= 0; a-- {
+		if name, ok := s[uint16(a)]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// run profiles source, assembled at $0200, until it reaches the label done.
+func run(t *testing.T, source string, syms Symbols) *Profiler {
+	ram := &memory.Ram{}
+	p, err := asm.AssembleInto(ram, cpu.NMOS6502, 0x0200, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := bus.CreateBus()
+	b.Attach(ram, "ram", 0x0000)
+	c := &cpu.Cpu{Bus: b}
+	c.PC, c.SP = 0x0200, 0xFF
+	profiler := NewProfiler(c)
+	profiler.Symbols = syms
+	c.AttachMonitor(profiler)
+	for i := 0; i < 1000 && c.PC != p.Symbols["done"]; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return profiler
+}
+
+const program = `
+main:	JSR outer	; 6
+	JSR inner	; 6
+done:	NOP
+outer:	JSR inner	; 6
+	RTS		; 6
+inner:	LDX #2		; 2
+loop:	DEX		; 2, twice
+	BNE loop	; 3 taken, then 2
+	RTS		; 6
+`
+
+func TestFolded(t *testing.T) {
+	var b strings.Builder
+	p := run(t, program, nil)
+	if err := p.WriteFolded(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := "" +
+		"$0200 12\n" +
+		"$0200;$0207 12\n" +
+		"$0200;$0207;$020B 17\n" +
+		"$0200;$020B 17\n"
+	if b.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+
+	b.Reset()
+	p.Symbols = symbols{0x0200: "main", 0x0207: "outer", 0x020B: "inner", 0x020D: "inner_loop"}
+	if err := p.WriteFolded(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected = "" +
+		"main 12\n" +
+		"main;inner 17\n" +
+		"main;outer 12\n" +
+		"main;outer;inner 17\n"
+	if b.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
+
+// field is a protocol buffer field, as a varint or length-delimited bytes.
+type field struct {
+	number int
+	value  uint64
+	data   []byte
+}
+
+// decode returns the fields of a protocol buffer message, which has only
+// varint and length-delimited fields.
+func decode(t *testing.T, message []byte) (fields []field) {
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		message = message[n:]
+		f := field{number: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			f.value, n = binary.Uvarint(message)
+			message = message[n:]
+		case 2:
+			size, n := binary.Uvarint(message)
+			f.data = message[n : n+int(size)]
+			message = message[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// varints decodes packed repeated varints.
+func varints(data []byte) (values []uint64) {
+	for len(data) > 0 {
+		v, n := binary.Uvarint(data)
+		values = append(values, v)
+		data = data[n:]
+	}
+	return values
+}
+
+func TestWriteProfile(t *testing.T) {
+	var b bytes.Buffer
+	p := run(t, program, symbols{0x0200: "main", 0x0207: "outer", 0x020B: "inner", 0x020D: "inner_loop"})
+	if err := p.WriteProfile(&b); err != nil {
+		t.Fatal(err)
+	}
+	z, err := gzip.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(z)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		strs      []string
+		functions = make(map[uint64]uint64)    // name, by ID.
+		locations = make(map[uint64][2]uint64) // address and function ID, by ID.
+		samples   []struct{ ids, values []uint64 }
+		typeNames [][2]uint64
+	)
+	for _, f := range decode(t, data) {
+		switch f.number {
+		case profileSampleType:
+			var vt [2]uint64
+			for _, g := range decode(t, f.data) {
+				vt[g.number-1] = g.value
+			}
+			typeNames = append(typeNames, vt)
+		case profileSample:
+			var ids, values []uint64
+			for _, g := range decode(t, f.data) {
+				switch g.number {
+				case sampleLocationID:
+					ids = varints(g.data)
+				case sampleValue:
+					values = varints(g.data)
+				}
+			}
+			samples = append(samples, struct{ ids, values []uint64 }{ids, values})
+		case profileLocation:
+			var id, address, function uint64
+			for _, g := range decode(t, f.data) {
+				switch g.number {
+				case locationID:
+					id = g.value
+				case locationAddress:
+					address = g.value
+				case locationLine:
+					function = decode(t, g.data)[0].value
+				}
+			}
+			locations[id] = [2]uint64{address, function}
+		case profileFunction:
+			var id, name uint64
+			for _, g := range decode(t, f.data) {
+				switch g.number {
+				case functionID:
+					id = g.value
+				case functionName:
+					name = g.value
+				}
+			}
+			functions[id] = name
+		case profileStringTable:
+			strs = append(strs, string(f.data))
+		}
+	}
+
+	if len(typeNames) != 2 || strs[typeNames[0][0]] != "cycles" || strs[typeNames[1][0]] != "instructions" {
+		t.Fatalf("expected cycles and instructions sample types, got %v", typeNames)
+	}
+	got := make(map[string][]uint64)
+	for _, s := range samples {
+		var stack []string
+		for _, id := range s.ids {
+			l, ok := locations[id]
+			if !ok {
+				t.Fatalf("no location %d", id)
+			}
+			stack = append(stack, fmt.Sprintf("%s@$%04X", strs[functions[l[1]]], l[0]))
+		}
+		got[strings.Join(stack, " ")] = s.values
+	}
+	expected := map[string][]uint64{
+		"main@$0200":                         {6, 1},
+		"main@$0203":                         {6, 1},
+		"outer@$0207 main@$0200":             {6, 1},
+		"outer@$020A main@$0200":             {6, 1},
+		"inner@$020B outer@$0207 main@$0200": {2, 1},
+		"inner@$020D outer@$0207 main@$0200": {4, 2},
+		"inner@$020E outer@$0207 main@$0200": {5, 2},
+		"inner@$0210 outer@$0207 main@$0200": {6, 1},
+		"inner@$020B main@$0203":             {2, 1},
+		"inner@$020D main@$0203":             {4, 2},
+		"inner@$020E main@$0203":             {5, 2},
+		"inner@$0210 main@$0203":             {6, 1},
+	}
+	if len(got) != len(expected) {
+		t.Errorf("expected %d samples, got %d: %v", len(expected), len(got), got)
+	}
+	for stack, values := range expected {
+		if fmt.Sprint(got[stack]) != fmt.Sprint(values) {
+			t.Errorf("%s: expected cycles and instructions %v, got %v", stack, values, got[stack])
+		}
+	}
+}
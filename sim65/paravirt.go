@@ -0,0 +1,263 @@
+package sim65
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/pda/go6502/cpu"
+)
+
+// hooksStart is the address of the first paravirtualization hook, called
+// with JSR as cc65's sim6502 library does.
+const hooksStart = 0xFFF4
+
+// hooks are the paravirtualization calls, from hooksStart.
+var hooks = [...]func(*Paravirt){
+	(*Paravirt).pvOpen,
+	(*Paravirt).pvClose,
+	(*Paravirt).pvRead,
+	(*Paravirt).pvWrite,
+	(*Paravirt).pvArgs,
+	(*Paravirt).pvExit,
+}
+
+// cc65's open flags, from fcntl.h.
+const (
+	oRdonly = 0x01
+	oWronly = 0x02
+	oRdwr   = 0x03
+	oCreat  = 0x10
+	oTrunc  = 0x20
+	oAppend = 0x40
+	oExcl   = 0x80
+)
+
+// Options configure the host side of the paravirtualization calls.
+type Options struct {
+	Args   []string  // the program's arguments, starting with its name.
+	Stdin  io.Reader // file 0; os.Stdin if nil.
+	Stdout io.Writer // file 1; os.Stdout if nil.
+	Stderr io.Writer // file 2; os.Stderr if nil.
+}
+
+// Paravirt is a cpu.Monitor which handles the paravirtualization calls of a
+// sim65 program, as sim65 does, then lets the RTS at the hook return to the
+// caller. Arguments are passed as cc65 passes them to fastcall functions;
+// the last in A and X, the rest on the C stack.
+type Paravirt struct {
+	cpu   *cpu.Cpu
+	sp    uint16 // zero page address of the C stack pointer.
+	args  []string
+	files map[int]any // open files, by file descriptor.
+}
+
+// NewParavirt returns a Paravirt for the program running on c, whose C stack
+// pointer is at the zero page address sp.
+func NewParavirt(c *cpu.Cpu, sp uint8, o Options) *Paravirt {
+	if o.Stdin == nil {
+		o.Stdin = os.Stdin
+	}
+	if o.Stdout == nil {
+		o.Stdout = os.Stdout
+	}
+	if o.Stderr == nil {
+		o.Stderr = os.Stderr
+	}
+	return &Paravirt{
+		cpu:   c,
+		sp:    uint16(sp),
+		args:  o.Args,
+		files: map[int]any{0: o.Stdin, 1: o.Stdout, 2: o.Stderr},
+	}
+}
+
+// BeforeExecute handles the call if the CPU is at a hook.
+func (p *Paravirt) BeforeExecute(in cpu.Instruction) {
+	if pc := int(p.cpu.PC); pc >= hooksStart && pc < hooksStart+len(hooks) {
+		hooks[pc-hooksStart](p)
+	}
+}
+
+// Shutdown closes the files the program left open.
+func (p *Paravirt) Shutdown() {
+	for fd := range p.files {
+		if fd > 2 {
+			p.closeFile(fd)
+		}
+	}
+}
+
+// ax returns the 16-bit value in A and X.
+func (p *Paravirt) ax() uint16 {
+	return uint16(p.cpu.X)<<8 | uint16(p.cpu.AC)
+}
+
+// setAX returns v in A and X.
+func (p *Paravirt) setAX(v int) {
+	p.cpu.AC = byte(v)
+	p.cpu.X = byte(v >> 8)
+}
+
+// popParam returns the word at the top of the C stack, then drops n bytes.
+func (p *Paravirt) popParam(n uint16) uint16 {
+	b := p.cpu.Bus
+	sp := b.Read16(p.sp)
+	v := b.Read16(sp)
+	b.Write16(p.sp, sp+n)
+	return v
+}
+
+// pvOpen: int open(const char* name, int flags, ...)
+// It's variadic, so all its arguments are on the C stack, and Y is their
+// size; the mode is optional.
+func (p *Paravirt) pvOpen() {
+	optional := uint16(p.cpu.Y) - 4
+	mode := p.popParam(optional)
+	flags := p.popParam(2)
+	name := p.popParam(2)
+	if optional < 2 {
+		mode = 0x01 | 0x02
+	}
+
+	var path []byte
+	for b := p.cpu.Bus.Read(name); b != 0; b = p.cpu.Bus.Read(name) {
+		path = append(path, b)
+		name++
+	}
+
+	var flag int
+	switch flags & 0x03 {
+	case oRdonly:
+		flag = os.O_RDONLY
+	case oWronly:
+		flag = os.O_WRONLY
+	case oRdwr:
+		flag = os.O_RDWR
+	}
+	for cc65, host := range map[uint16]int{oCreat: os.O_CREATE, oTrunc: os.O_TRUNC, oAppend: os.O_APPEND, oExcl: os.O_EXCL} {
+		if flags&cc65 != 0 {
+			flag |= host
+		}
+	}
+	var perm os.FileMode
+	if mode&0x01 != 0 {
+		perm |= 0400
+	}
+	if mode&0x02 != 0 {
+		perm |= 0200
+	}
+
+	f, err := os.OpenFile(string(path), flag, perm)
+	if err != nil {
+		p.setAX(-1)
+		return
+	}
+	fd := 0
+	for p.files[fd] != nil {
+		fd++
+	}
+	p.files[fd] = f
+	p.setAX(fd)
+}
+
+// pvClose: int close(int fd)
+func (p *Paravirt) pvClose() {
+	fd := int(p.ax())
+	if p.files[fd] == nil {
+		p.setAX(-1)
+		return
+	}
+	if err := p.closeFile(fd); err != nil {
+		p.setAX(-1)
+		return
+	}
+	p.setAX(0)
+}
+
+// closeFile closes the file fd, unless it's one of the standard streams,
+// which are only forgotten.
+func (p *Paravirt) closeFile(fd int) error {
+	f := p.files[fd]
+	delete(p.files, fd)
+	if c, ok := f.(io.Closer); ok && fd > 2 {
+		return c.Close()
+	}
+	return nil
+}
+
+// pvRead: int read(int fd, void* buf, unsigned count)
+func (p *Paravirt) pvRead() {
+	count := p.ax()
+	buf := p.popParam(2)
+	fd := int(p.popParam(2))
+	r, ok := p.files[fd].(io.Reader)
+	if !ok {
+		p.setAX(-1)
+		return
+	}
+	data := make([]byte, count)
+	n, err := r.Read(data)
+	if err != nil && !errors.Is(err, io.EOF) {
+		p.setAX(-1)
+		return
+	}
+	for _, b := range data[:n] {
+		p.cpu.Bus.Write(buf, b)
+		buf++
+	}
+	p.setAX(n)
+}
+
+// pvWrite: int write(int fd, const void* buf, unsigned count)
+func (p *Paravirt) pvWrite() {
+	count := p.ax()
+	buf := p.popParam(2)
+	fd := int(p.popParam(2))
+	w, ok := p.files[fd].(io.Writer)
+	if !ok {
+		p.setAX(-1)
+		return
+	}
+	data := make([]byte, count)
+	for i := range data {
+		data[i] = p.cpu.Bus.Read(buf + uint16(i))
+	}
+	n, err := w.Write(data)
+	if err != nil {
+		p.setAX(-1)
+		return
+	}
+	p.setAX(n)
+}
+
+// pvArgs: int args(char*** argv)
+// Copies the arguments below the C stack, and stores argv, returning argc.
+func (p *Paravirt) pvArgs() {
+	b := p.cpu.Bus
+	argv := p.ax()
+	sp := b.Read16(p.sp)
+	pointers := sp - uint16(len(p.args)+1)*2
+	b.Write16(argv, pointers)
+
+	sp = pointers
+	for i, arg := range p.args {
+		sp -= uint16(len(arg) + 1)
+		for j := 0; j < len(arg); j++ {
+			b.Write(sp+uint16(j), arg[j])
+		}
+		b.Write(sp+uint16(len(arg)), 0)
+		b.Write16(pointers+uint16(i)*2, sp)
+	}
+	b.Write16(pointers+uint16(len(p.args))*2, 0)
+	b.Write16(p.sp, sp)
+	p.setAX(len(p.args))
+	// Like sim65, the arguments are only given once.
+	p.args = nil
+}
+
+// pvExit: void exit(int status)
+// The status is A; the RTS completes, then the CPU stops.
+func (p *Paravirt) pvExit() {
+	p.cpu.Exit(int(p.cpu.AC))
+}
@@ -0,0 +1,100 @@
+/*
+	Package sim65 runs programs built for cc65's sim65 simulator, i.e. linked
+	for the sim6502 or sim65c02 targets, so their tests can run under go6502
+	and its debugger.
+
+	A sim65 program starts with a header naming its CPU, where it's loaded
+	and where it starts. It runs in 64K of RAM, and calls the host through
+	paravirtualization hooks at $FFF4..$FFF9 to open, close, read and write
+	files, fetch its arguments, and exit.
+*/
+package sim65
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/pda/go6502/bus"
+	"github.com/pda/go6502/cpu"
+)
+
+// magic starts the header of a sim65 program.
+var magic = []byte("sim65")
+
+// headerSize is the size of a version 2 header.
+const headerSize = 12
+
+// Header is the header of a sim65 program.
+type Header struct {
+	Version      uint8
+	Cpu          uint8  // 0 for the 6502, 1 for the 65C02, 2 for the 6502X.
+	SP           uint8  // zero page address of cc65's C stack pointer.
+	LoadAddress  uint16 // address the code is loaded at.
+	ResetAddress uint16 // address execution starts at.
+}
+
+// Program is a sim65 program.
+type Program struct {
+	Header
+	Code []byte
+}
+
+// ReadProgram reads a sim65 program, as written by ld65 for the sim6502 and
+// sim65c02 targets. Only version 2 headers, from cc65 2.18 on, are read.
+func ReadProgram(r io.Reader) (*Program, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < headerSize || !bytes.Equal(data[:len(magic)], magic) {
+		return nil, fmt.Errorf("Not a sim65 program")
+	}
+	p := &Program{
+		Header: Header{
+			Version:      data[5],
+			Cpu:          data[6],
+			SP:           data[7],
+			LoadAddress:  uint16(data[8]) | uint16(data[9])<<8,
+			ResetAddress: uint16(data[10]) | uint16(data[11])<<8,
+		},
+		Code: data[headerSize:],
+	}
+	if p.Version != 2 {
+		return nil, fmt.Errorf("Unsupported sim65 header version %d", p.Version)
+	}
+	if _, err := p.Variant(); err != nil {
+		return nil, err
+	}
+	if int(p.LoadAddress)+len(p.Code) > hooksStart {
+		return nil, fmt.Errorf("sim65 program of %d bytes at $%04X overlaps the paravirtualization hooks at $%04X",
+			len(p.Code), p.LoadAddress, hooksStart)
+	}
+	return p, nil
+}
+
+// Variant is the CPU variant the program was built for.
+func (p *Program) Variant() (cpu.Variant, error) {
+	switch p.Cpu {
+	case 0:
+		return cpu.NMOS6502, nil
+	case 1:
+		return cpu.CMOS65C02, nil
+	case 2:
+		return cpu.NMOS6502X, nil
+	}
+	return 0, fmt.Errorf("Unknown sim65 CPU type %d", p.Cpu)
+}
+
+// Load writes the program into memory through b, with the reset vector set
+// to its start, and an RTS at each paravirtualization hook, which returns to
+// the caller once Paravirt has handled the call.
+func (p *Program) Load(b *bus.Bus) {
+	for i, v := range p.Code {
+		b.Write(p.LoadAddress+uint16(i), v)
+	}
+	for a := hooksStart; a < hooksStart+len(hooks); a++ {
+		b.Write(uint16(a), 0x60) // RTS
+	}
+	b.Write16(cpu.ResetVector, p.ResetAddress)
+}
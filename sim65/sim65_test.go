@@ -0,0 +1,195 @@
+package sim65
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pda/go6502/asm"
+	"github.com/pda/go6502/bus"
+	"github.com/pda/go6502/cpu"
+	"github.com/pda/go6502/memory"
+)
+
+// runtime is the part of cc65's runtime the test programs need.
+const runtime = `
+	sp = $00	; C stack pointer.
+	open = $FFF4
+	close = $FFF5
+	read = $FFF6
+	write = $FFF7
+	args = $FFF8
+	exit = $FFF9
+
+	.org $0200
+	LDA #$00
+	STA sp
+	LDA #$C0
+	STA sp+1
+	JMP main
+
+; pushax pushes A and X onto the C stack.
+pushax:	PHA
+	LDA sp
+	SEC
+	SBC #2
+	STA sp
+	BCS nb
+	DEC sp+1
+nb:	LDY #1
+	TXA
+	STA (sp),Y
+	PLA
+	DEY
+	STA (sp),Y
+	RTS
+`
+
+// build returns a sim65 program of source, loaded and starting at $0200.
+func build(t *testing.T, source string) []byte {
+	p, err := asm.Assemble(cpu.NMOS6502, 0x0200, runtime+source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := []byte{'s', 'i', 'm', '6', '5', 2, 0, 0x00, 0x00, 0x02, 0x00, 0x02}
+	return append(header, p.Bytes()...)
+}
+
+// run runs a sim65 program to its exit.
+func run(t *testing.T, binary []byte, o Options) (*cpu.Cpu, int) {
+	p, err := ReadProgram(bytes.NewReader(binary))
+	if err != nil {
+		t.Fatal(err)
+	}
+	variant, err := p.Variant()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addressBus, _ := bus.CreateBus()
+	addressBus.Attach(&memory.Ram{}, "ram", 0x0000)
+	addressBus.Attach(&memory.Ram{}, "ram", 0x8000)
+	c := &cpu.Cpu{Bus: addressBus, Variant: variant}
+	p.Load(addressBus)
+	pv := NewParavirt(c, p.SP, o)
+	c.AttachMonitor(pv)
+	defer pv.Shutdown()
+	c.Reset()
+
+	err = c.Run(context.Background())
+	var exit *cpu.ExitError
+	if !errors.As(err, &exit) {
+		t.Fatalf("expected the program to exit, got %v", err)
+	}
+	return c, exit.Status
+}
+
+func TestWriteArgsAndExit(t *testing.T) {
+	binary := build(t, `
+main:	LDA #<argv
+	LDX #>argv
+	JSR args
+	STA argc
+	LDA #1
+	LDX #0
+	JSR pushax
+	LDA #<msg
+	LDX #>msg
+	JSR pushax
+	LDA #6
+	LDX #0
+	JSR write
+	STA written
+	LDA argc
+	JSR exit
+	BRK
+msg:	.byte "hello", 10
+argv:	.word 0
+argc:	.byte 0
+written: .byte 0
+`)
+	out := &bytes.Buffer{}
+	c, status := run(t, binary, Options{Args: []string{"prog", "two"}, Stdout: out})
+	if status != 2 {
+		t.Errorf("expected exit status argc 2, got %d", status)
+	}
+	if out.String() != "hello\n" {
+		t.Errorf("expected hello, got %q", out.String())
+	}
+
+	// argv is the last word of the program, before argc and written.
+	b := c.Bus
+	argv := b.Read16(0x0200 + uint16(len(binary)-12) - 4)
+	if argv != 0xC000-6 {
+		t.Fatalf("expected argv just below the C stack at $%04X, got $%04X", 0xC000-6, argv)
+	}
+	for i, expected := range []string{"prog", "two"} {
+		var arg []byte
+		for a := b.Read16(argv + uint16(i)*2); b.Read(a) != 0; a++ {
+			arg = append(arg, b.Read(a))
+		}
+		if string(arg) != expected {
+			t.Errorf("expected argv[%d] %q, got %q", i, expected, arg)
+		}
+	}
+	if b.Read16(argv+4) != 0 {
+		t.Error("expected argv to end with NULL")
+	}
+}
+
+func TestOpenReadClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(path, []byte("xyz"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	binary := build(t, `
+main:	LDA #<name
+	LDX #>name
+	JSR pushax
+	LDA #$01	; O_RDONLY
+	LDX #0
+	JSR pushax
+	LDY #4
+	JSR open
+	STA fd
+	LDX #0
+	JSR pushax
+	LDA #<buf
+	LDX #>buf
+	JSR pushax
+	LDA #16
+	LDX #0
+	JSR read
+	STA count
+	LDA fd
+	LDX #0
+	JSR close
+	ORA count	; 0 from close, 3 from read.
+	JSR exit
+fd:	.byte 0
+count:	.byte 0
+buf:	.res 16
+name:	.byte "`+path+`", 0
+`)
+	_, status := run(t, binary, Options{})
+	if status != 3 {
+		t.Errorf("expected to read 3 bytes and close, got status %d", status)
+	}
+}
+
+func TestReadProgramErrors(t *testing.T) {
+	for _, binary := range [][]byte{
+		[]byte("sim6"),
+		[]byte("xim65\x02\x00\x00\x00\x02\x00\x02"),
+		[]byte("sim65\x01\x00\x00\x00\x02\x00\x02"),
+		[]byte("sim65\x02\x09\x00\x00\x02\x00\x02"),
+		[]byte("sim65\x02\x00\x00\xF0\xFF\x00\x02" + strings.Repeat("\xEA", 8)),
+	} {
+		if _, err := ReadProgram(bytes.NewReader(binary)); err == nil {
+			t.Errorf("expected error reading % X", binary)
+		}
+	}
+}
@@ -10,44 +10,49 @@ import (
 // Speedometer tracks how many instructions and cycles have executed in how
 // much time, to calculate an effective MHz etc.
 type Speedometer struct {
-	cycles       uint64
+	// TargetHz is the clock frequency the CPU is throttled to, if any.
+	// The report then includes drift; how far the CPU fell behind a real
+	// processor at that frequency.
+	TargetHz uint64
+
+	cpu          *cpu.Cpu
+	cyclesStart  uint64
 	instructions uint64
 	timeStart    time.Time
-	cycleChan    chan uint8
 }
 
-// NewSpeedometer creates a Speedometer, and starts a goroutine to receive
-// cycle counts from Speedometer.BeforeExecute().
-func NewSpeedometer() *Speedometer {
-	s := &Speedometer{
-		timeStart: time.Now(),
-		cycleChan: make(chan uint8),
+// NewSpeedometer creates a Speedometer, measuring from now. Cycles are
+// counted by the cpu.Cpu, including page-crossing and branch penalties.
+func NewSpeedometer(c *cpu.Cpu) *Speedometer {
+	return &Speedometer{
+		cpu:         c,
+		cyclesStart: c.Cycles,
+		timeStart:   time.Now(),
 	}
-	go func() {
-		for {
-			s.cycles += uint64(<-s.cycleChan)
-			s.instructions++
-		}
-	}()
-	return s
 }
 
 // BeforeExecute meets go6502.Monitor interface.
 func (s *Speedometer) BeforeExecute(in cpu.Instruction) {
-	s.cycleChan <- in.Cycles
+	s.instructions++
 }
 
 // Shutdown the Speedometer session, reporting stats to stdout.
 func (s *Speedometer) Shutdown() {
 	duration := time.Since(s.timeStart)
 	us := float64(duration) / float64(time.Microsecond)
+	cycles := s.cpu.Cycles - s.cyclesStart
 
 	fmt.Printf("Speedometer\n")
 	fmt.Printf("----------------------------------\n")
 	fmt.Printf("Instructions: % 20d\n", s.instructions)
-	fmt.Printf("Cycles:       % 20d\n", s.cycles)
+	fmt.Printf("Cycles:       % 20d\n", cycles)
 	fmt.Printf("Seconds:      % 20.2f\n", duration.Seconds())
-	fmt.Printf("MHz:          % 20.2f\n", float64(s.cycles)/us)
+	fmt.Printf("MHz:          % 20.2f\n", float64(cycles)/us)
 	fmt.Printf("MIPS:         % 20.2f\n", float64(s.instructions)/us)
+	if s.TargetHz > 0 {
+		expected := time.Duration(float64(cycles) / float64(s.TargetHz) * float64(time.Second))
+		fmt.Printf("Target MHz:   % 20.2f\n", float64(s.TargetHz)/1e6)
+		fmt.Printf("Drift:        % 20s\n", (duration - expected).Round(time.Millisecond))
+	}
 	fmt.Printf("----------------------------------\n")
 }
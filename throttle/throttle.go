@@ -0,0 +1,90 @@
+/*
+	Package throttle paces a cpu.Cpu to a target clock frequency, so that
+	timing loops and animations run at the speed of the real hardware.
+*/
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pda/go6502/cpu"
+)
+
+const (
+	// interval is how often the CPU is paced against the wall clock; it runs
+	// an interval's worth of cycles at full speed, then sleeps.
+	interval = 10 * time.Millisecond
+
+	// maxLag is how far the CPU may fall behind the wall clock, e.g. when
+	// the host is too slow, or while paused in the debugger. Beyond that,
+	// pacing restarts from the present rather than racing to catch up.
+	maxLag = 100 * time.Millisecond
+)
+
+// Throttle runs a cpu.Cpu at a target clock frequency.
+type Throttle struct {
+	cpu *cpu.Cpu
+	hz  uint64
+}
+
+// NewThrottle creates a Throttle running c at hz cycles per second.
+func NewThrottle(c *cpu.Cpu, hz uint64) *Throttle {
+	return &Throttle{cpu: c, hz: hz}
+}
+
+// Run runs the CPU as for cpu.Cpu.Run, in batches of cycles, sleeping
+// between batches whenever it's ahead of the wall clock.
+func (t *Throttle) Run(ctx context.Context) error {
+	batch := t.hz * uint64(interval) / uint64(time.Second)
+	if batch == 0 {
+		batch = 1
+	}
+	start, startCycles := time.Now(), t.cpu.Cycles
+	for {
+		if err := t.cpu.RunCycles(ctx, batch); err != nil {
+			return err
+		}
+		ahead := time.Until(start.Add(t.duration(t.cpu.Cycles - startCycles)))
+		switch {
+		case ahead > 0:
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(ahead):
+			}
+		case ahead < -maxLag:
+			start, startCycles = time.Now(), t.cpu.Cycles
+		}
+	}
+}
+
+// duration returns the time taken by the given number of cycles.
+func (t *Throttle) duration(cycles uint64) time.Duration {
+	return time.Duration(float64(cycles) / float64(t.hz) * float64(time.Second))
+}
+
+// ParseFrequency parses a frequency in Hz, kHz or MHz, e.g. "1MHz",
+// "1.8432MHz", "500kHz" or "1000000"; units are case-insensitive.
+func ParseFrequency(s string) (uint64, error) {
+	number, multiplier := strings.TrimSpace(s), 1.0
+	lower := strings.ToLower(number)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier float64
+	}{{"mhz", 1e6}, {"khz", 1e3}, {"hz", 1}} {
+		if strings.HasSuffix(lower, unit.suffix) {
+			number = strings.TrimSpace(number[:len(number)-len(unit.suffix)])
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil || f*multiplier < 1 {
+		return 0, fmt.Errorf("Invalid frequency %q; expected e.g. 1MHz", s)
+	}
+	return uint64(f * multiplier), nil
+}
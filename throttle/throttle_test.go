@@ -0,0 +1,62 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pda/go6502/bus"
+	"github.com/pda/go6502/cpu"
+	"github.com/pda/go6502/memory"
+)
+
+func TestParseFrequency(t *testing.T) {
+	tests := []struct {
+		input string
+		hz    uint64
+	}{
+		{"1MHz", 1000000},
+		{"1.8432MHz", 1843200},
+		{"500kHz", 500000},
+		{"500 khz", 500000},
+		{"100Hz", 100},
+		{"2000000", 2000000},
+	}
+	for _, test := range tests {
+		hz, err := ParseFrequency(test.input)
+		if err != nil || hz != test.hz {
+			t.Errorf("ParseFrequency(%q) = %d, %v; expected %d", test.input, hz, err, test.hz)
+		}
+	}
+	for _, input := range []string{"", "fast", "0MHz", "-1kHz"} {
+		if _, err := ParseFrequency(input); err == nil {
+			t.Errorf("ParseFrequency(%q) expected error", input)
+		}
+	}
+}
+
+func TestThrottleLimitsSpeed(t *testing.T) {
+	addressBus, _ := bus.CreateBus()
+	addressBus.Attach(&memory.Ram{}, "ram", 0x0000)
+	c := &cpu.Cpu{Bus: addressBus}
+	c.Bus.Write(0x0000, 0x4C) // JMP $0000
+	c.Bus.Write16(0x0001, 0x0000)
+
+	const hz = 100000
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := NewThrottle(c, hz).Run(ctx); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+
+	// Allow a batch ahead of the wall clock, and the host running slowly.
+	limit := uint64(elapsed.Seconds()*hz) + hz*uint64(interval)/uint64(time.Second)
+	if c.Cycles > limit {
+		t.Errorf("expected at most %d cycles in %v, got %d", limit, elapsed, c.Cycles)
+	}
+	if c.Cycles < limit/4 {
+		t.Errorf("expected at least %d cycles in %v, got %d", limit/4, elapsed, c.Cycles)
+	}
+}
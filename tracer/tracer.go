@@ -0,0 +1,155 @@
+/*
+	Package tracer logs each instruction a cpu.Cpu executes, one line each,
+	in the format of the widely used nestest.log:
+
+		C000  4C F5 C5  JMP $C5F5                       A:00 X:00 Y:00 P:24 SP:FD CYC:7
+
+	That's the address, the instruction's bytes and disassembly, then the
+	registers and cycle count before it executed. A trace may be compared
+	against a reference trace, e.g. from another emulator or a logic analyzer
+	capture, halting the CPU at the first line which differs.
+*/
+package tracer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pda/go6502/cpu"
+)
+
+// Tracer is a cpu.Monitor which writes a line per instruction.
+type Tracer struct {
+	cpu  *cpu.Cpu
+	w    *bufio.Writer
+	out  io.Writer
+	ref  *bufio.Scanner
+	refs io.Reader
+	line int
+}
+
+// MismatchError is the first difference between the trace and the reference.
+type MismatchError struct {
+	Line      int
+	Expected  string
+	Got       string
+	Different []string // names of the fields which differ.
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("Trace differs from reference at line %d in %s:\n\texpected: %s\n\tgot:      %s",
+		e.Line, strings.Join(e.Different, ", "), e.Expected, e.Got)
+}
+
+// NewTracer returns a Tracer writing to w, to be attached to c as a monitor.
+// Shutdown flushes the trace, and closes w if it's an io.Closer.
+func NewTracer(c *cpu.Cpu, w io.Writer) *Tracer {
+	return &Tracer{cpu: c, w: bufio.NewWriter(w), out: w}
+}
+
+// CompareWith compares each line traced with the next line of a reference
+// trace read from r, halting the CPU with a MismatchError at the first which
+// differs. Only the fields present in both lines are compared, and not the
+// disassembly, whose style varies between emulators. Comparison stops at the
+// end of the reference. Shutdown closes r if it's an io.Closer.
+func (t *Tracer) CompareWith(r io.Reader) {
+	t.ref = bufio.NewScanner(r)
+	t.refs = r
+}
+
+// BeforeExecute writes the line for in, and compares it with the reference,
+// halting the CPU before in executes if they differ.
+func (t *Tracer) BeforeExecute(in cpu.Instruction) {
+	line := Format(in, &cpu.Effects{Before: t.cpu.Registers(), Cycles: t.cpu.FetchCycles()})
+	t.line++
+	fmt.Fprintln(t.w, line)
+	if t.ref == nil {
+		return
+	}
+	if !t.ref.Scan() {
+		t.ref = nil
+		return
+	}
+	if different := compare(t.ref.Text(), line); len(different) > 0 {
+		t.w.Flush()
+		t.cpu.Halt(&MismatchError{
+			Line:      t.line,
+			Expected:  t.ref.Text(),
+			Got:       line,
+			Different: different,
+		})
+		t.ref = nil
+	}
+}
+
+// Shutdown flushes the trace, and closes its files.
+func (t *Tracer) Shutdown() {
+	t.w.Flush()
+	for _, f := range []any{t.out, t.refs} {
+		if c, ok := f.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// Format returns the trace line for an instruction, from the registers and
+// cycle count before it executed, e.Before and e.Cycles. The P register is
+// shown with the B flag clear, as it is in nestest.log; B isn't a real flag,
+// but go6502 keeps it set.
+func Format(in cpu.Instruction, e *cpu.Effects) string {
+	r := e.Before
+	bytes := []string{fmt.Sprintf("%02X", in.Opcode)}
+	switch in.Bytes {
+	case 2:
+		bytes = append(bytes, fmt.Sprintf("%02X", in.Op8))
+	case 3:
+		bytes = append(bytes, fmt.Sprintf("%02X", in.Op16&0xFF), fmt.Sprintf("%02X", in.Op16>>8))
+	}
+	return fmt.Sprintf("%04X  %-10s%-32sA:%02X X:%02X Y:%02X P:%02X SP:%02X CYC:%d",
+		r.PC, strings.Join(bytes, " "), in.Disassemble(r.PC),
+		r.AC, r.X, r.Y, r.SR&^0x10|0x20, r.SP, e.Cycles)
+}
+
+// traceFields matches the comparable fields of a trace line, after its
+// address.
+var traceFields = regexp.MustCompile(`\b(A|X|Y|P|SP|CYC):\s*([0-9A-Fa-f]+)`)
+
+// fields returns the address and named fields of a trace line.
+func fields(line string) map[string]string {
+	f := make(map[string]string)
+	if len(line) >= 4 {
+		f["PC"] = strings.ToUpper(line[:4])
+	}
+	for _, m := range traceFields.FindAllStringSubmatch(line, -1) {
+		f[m[1]] = strings.ToUpper(m[2])
+	}
+	return f
+}
+
+// compare returns the names of the fields present in both lines which
+// differ. P is compared ignoring bits 4 and 5, which aren't real flags.
+func compare(expected, got string) (different []string) {
+	e, g := fields(expected), fields(got)
+	for _, name := range []string{"PC", "A", "X", "Y", "P", "SP", "CYC"} {
+		ev, ok1 := e[name]
+		gv, ok2 := g[name]
+		if !ok1 || !ok2 {
+			continue
+		}
+		if name == "P" {
+			ep, err1 := strconv.ParseUint(ev, 16, 8)
+			gp, err2 := strconv.ParseUint(gv, 16, 8)
+			if err1 == nil && err2 == nil && (ep^gp)&^0x30 == 0 {
+				continue
+			}
+		}
+		if ev != gv {
+			different = append(different, name)
+		}
+	}
+	return different
+}
@@ -0,0 +1,87 @@
+package tracer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pda/go6502/bus"
+	"github.com/pda/go6502/cpu"
+	"github.com/pda/go6502/memory"
+)
+
+// createCpu returns a CPU at $0200, running:
+//
+//	LDX #$03
+//	DEX
+//	BNE $0202
+//	STX $0300
+func createCpu() *cpu.Cpu {
+	b, _ := bus.CreateBus()
+	b.Attach(&memory.Ram{}, "ram", 0x0000)
+	b.Attach(&memory.Ram{}, "ram", 0x8000)
+	c := &cpu.Cpu{Bus: b}
+	c.Reset()
+	c.PC = 0x0200
+	c.SP = 0xFD
+	for i, v := range []byte{0xA2, 0x03, 0xCA, 0xD0, 0xFD, 0x8E, 0x00, 0x03} {
+		c.Bus.Write(0x0200+uint16(i), v)
+	}
+	return c
+}
+
+const expectedTrace = `0200  A2 03     LDX #$03                        A:00 X:00 Y:00 P:24 SP:FD CYC:7
+0202  CA        DEX                             A:00 X:03 Y:00 P:24 SP:FD CYC:9
+0203  D0 FD     BNE $0202                       A:00 X:02 Y:00 P:24 SP:FD CYC:11
+`
+
+func TestTrace(t *testing.T) {
+	for _, accurate := range []bool{false, true} {
+		c := createCpu()
+		c.CycleAccurate = accurate
+		var out strings.Builder
+		tr := NewTracer(c, &out)
+		c.AttachMonitor(tr)
+		for i := 0; i < 3; i++ {
+			if err := c.Step(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tr.Shutdown()
+		if out.String() != expectedTrace {
+			t.Errorf("accurate %v, expected:\n%s\ngot:\n%s", accurate, expectedTrace, out.String())
+		}
+	}
+}
+
+func TestCompareWithReference(t *testing.T) {
+	// nestest.log style, with PPU timing and a different disassembly style.
+	reference := `0200  A2 03     LDX #$03                        A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7
+0202  CA        DEX                             A:00 X:03 Y:00 P:24 SP:FD PPU:  0, 27 CYC:9
+0203  D0 FD     BNE $0202 = A2                  A:00 X:02 Y:00 P:24 SP:FD PPU:  0, 33 CYC:11
+0202  CA        DEX                             A:00 X:02 Y:00 P:A4 SP:FD PPU:  0, 42 CYC:14
+`
+	c := createCpu()
+	var out strings.Builder
+	tr := NewTracer(c, &out)
+	tr.CompareWith(strings.NewReader(reference))
+	c.AttachMonitor(tr)
+
+	var err error
+	for i := 0; i < 4 && err == nil; i++ {
+		err = c.Step()
+	}
+	var mismatch *MismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected MismatchError, got %v", err)
+	}
+	if mismatch.Line != 4 || strings.Join(mismatch.Different, ",") != "P" {
+		t.Errorf("expected P to differ at line 4, got %v", err)
+	}
+	if c.PC != 0x0202 || c.X != 0x02 {
+		t.Errorf("expected halt before the differing DEX, PC $%04X X $%02X", c.PC, c.X)
+	}
+	if c.Step() != err {
+		t.Error("expected the CPU to stay halted")
+	}
+}
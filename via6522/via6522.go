@@ -181,13 +181,39 @@ func printAsciiByte(b uint8) {
 	}
 }
 
+// handled is true for the registers implemented so far.
+func handled(a uint16) bool {
+	switch a {
+	case 0x0, 0x1, 0x2, 0x3, 0xC:
+		return true
+	}
+	return false
+}
+
+// CheckRead allows all reads. Registers which aren't implemented read as
+// zero, like an open bus, rather than faulting: the processor makes dummy
+// reads of them, e.g. for indexed stores in cycle-accurate mode, which a
+// program can't avoid.
+func (via *Via6522) CheckRead(a uint16) error {
+	return nil
+}
+
+// CheckWrite refuses writes to registers which aren't implemented.
+func (via *Via6522) CheckWrite(a uint16) error {
+	if !handled(a) {
+		return fmt.Errorf("write to 0x%X not handled by Via6522", a)
+	}
+	return nil
+}
+
 // Read the register specified by the given 4-bit address (0x00..0x0F).
+// Registers which aren't implemented read as zero.
 // TODO: Unlike IRA, reading IRB actully returns bits from ORA for pins
 //       that are programmed as output.
 func (via *Via6522) Read(a uint16) byte {
 	switch a {
 	default:
-		panic(fmt.Sprintf("read from 0x%X not handled by Via6522", a))
+		return 0
 	case 0x0:
 		via.irb = 0x00
 		for _, p := range via.pbPeripherals {
@@ -239,10 +265,10 @@ func (via *Via6522) String() string {
 }
 
 // Write to register specified by the given 4-bit address (0x00..0x0F).
+// Writes to registers which aren't implemented are ignored.
 func (via *Via6522) Write(a uint16, data byte) {
 	switch a {
 	default:
-		panic(fmt.Sprintf("write to 0x%X not handled by Via6522", a))
 	case 0x0:
 		via.orb = data
 		via.handleDataWrite(data&via.ddrb, via.pbPeripherals)
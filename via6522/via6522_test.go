@@ -179,3 +179,16 @@ func (ff *flipflop) Write(in byte) {
 func (ff *flipflop) String() string {
 	return "flipflop test peripheral"
 }
+
+func TestViaRefusesUnhandledRegisterWrites(t *testing.T) {
+	via := via()
+	if err := via.CheckRead(ddra); err != nil {
+		t.Errorf("DDRA read refused: %v", err)
+	}
+	if err := via.CheckRead(0x4); err != nil || via.Read(0x4) != 0 {
+		t.Errorf("T1C-L read should be allowed, as open bus: %v", err)
+	}
+	if err := via.CheckWrite(0xF); err == nil {
+		t.Error("ORA (no handshake) write not refused")
+	}
+}